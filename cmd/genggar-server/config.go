@@ -0,0 +1,526 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/syariatifaris/genggar"
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/glog"
+	"github.com/syariatifaris/genggar/subscriber"
+	"gopkg.in/yaml.v2"
+)
+
+//envPrefix is the prefix of the environment variables overriding the config file
+const envPrefix = "GENGGAR_"
+
+//Config is the broker configuration, read from yaml or toml file and overridden by the environment variables
+type Config struct {
+	Listen           ListenConfig    `yaml:"listen" toml:"listen"`
+	BufferSize       int             `yaml:"buffer_size" toml:"buffer_size"`
+	SubscriberBuffer int             `yaml:"subscriber_buffer" toml:"subscriber_buffer"`
+	RequestTimeout   time.Duration   `yaml:"request_timeout" toml:"request_timeout"`
+	Store            StoreConfig     `yaml:"store" toml:"store"`
+	Spill            SpillConfig     `yaml:"spill" toml:"spill"`
+	Topics           []TopicConfig   `yaml:"topics" toml:"topics"`
+	Auth             AuthConfig      `yaml:"auth" toml:"auth"`
+	Log              LogConfig       `yaml:"log" toml:"log"`
+	HTTP             HTTPConfig      `yaml:"http" toml:"http"`
+	Retry            RetryConfig     `yaml:"retry" toml:"retry"`
+	Webhooks         []WebhookConfig `yaml:"webhooks" toml:"webhooks"`
+	Metrics          MetricsConfig   `yaml:"metrics" toml:"metrics"`
+}
+
+type ListenConfig struct {
+	Address   string `yaml:"address" toml:"address"`
+	Port      int    `yaml:"port" toml:"port"`
+	Transport string `yaml:"transport" toml:"transport"`
+}
+
+//StoreConfig is the event store, the records older than Retention are compacted every CompactInterval
+type StoreConfig struct {
+	Path            string        `yaml:"path" toml:"path"`
+	Retention       time.Duration `yaml:"retention" toml:"retention"`
+	CompactInterval time.Duration `yaml:"compact_interval" toml:"compact_interval"`
+}
+
+type SpillConfig struct {
+	Dir  string `yaml:"dir" toml:"dir"`
+	Head int    `yaml:"head" toml:"head"`
+}
+
+type TopicConfig struct {
+	Name         string        `yaml:"name" toml:"name"`
+	Overflow     string        `yaml:"overflow" toml:"overflow"`
+	BlockTimeout time.Duration `yaml:"block_timeout" toml:"block_timeout"`
+	SpillDir     string        `yaml:"spill_dir" toml:"spill_dir"`
+}
+
+type AuthConfig struct {
+	Token string `yaml:"token" toml:"token"`
+}
+
+//HTTPConfig is the http gateway, it is disabled when the address is empty
+//Origins are the allowed origins of the websocket from other site
+type HTTPConfig struct {
+	Address string   `yaml:"address" toml:"address"`
+	Origins []string `yaml:"origins" toml:"origins"`
+}
+
+//MetricsConfig serves the prometheus metrics on the path, it is disabled when the address is empty
+type MetricsConfig struct {
+	Address string `yaml:"address" toml:"address"`
+	Path    string `yaml:"path" toml:"path"`
+}
+
+//RetryConfig is the redelivery of the failed send, the event is dead lettered after max attempts
+type RetryConfig struct {
+	MaxAttempts     int           `yaml:"max_attempts" toml:"max_attempts"`
+	Backoff         time.Duration `yaml:"backoff" toml:"backoff"`
+	MaxBackoff      time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+	DeadLetterTopic string        `yaml:"dead_letter_topic" toml:"dead_letter_topic"`
+}
+
+//WebhookConfig is the http callback subscriber of the topic, it is configured in the file only
+type WebhookConfig struct {
+	Name    string        `yaml:"name" toml:"name"`
+	Topic   string        `yaml:"topic" toml:"topic"`
+	URL     string        `yaml:"url" toml:"url"`
+	Secret  string        `yaml:"secret" toml:"secret"`
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+}
+
+//LogConfig is the broker log, Format is the console format and FileFormat is the log files format
+//Levels is the minimum level or the comma list of the levels, Packages overrides the level of the package
+//and Paths routes the level into its own file
+type LogConfig struct {
+	Levels     string            `yaml:"levels" toml:"levels"`
+	Packages   map[string]string `yaml:"packages" toml:"packages"`
+	ErrorPath  string            `yaml:"error_path" toml:"error_path"`
+	AccessPath string            `yaml:"access_path" toml:"access_path"`
+	Paths      map[string]string `yaml:"paths" toml:"paths"`
+	Format     string            `yaml:"format" toml:"format"`
+	FileFormat string            `yaml:"file_format" toml:"file_format"`
+
+	Rotation RotationConfig `yaml:"rotation" toml:"rotation"`
+}
+
+//RotationConfig rotates the log files by size or by interval, MaxFiles is the rotated files kept
+type RotationConfig struct {
+	MaxSizeMB int           `yaml:"max_size_mb" toml:"max_size_mb"`
+	Interval  time.Duration `yaml:"interval" toml:"interval"`
+	MaxFiles  int           `yaml:"max_files" toml:"max_files"`
+	Compress  bool          `yaml:"compress" toml:"compress"`
+}
+
+//defaultConfig is used for the values which are not set
+func defaultConfig() *Config {
+	return &Config{
+		Listen: ListenConfig{
+			Port:      1234,
+			Transport: engine.ProtoUDP,
+		},
+		BufferSize:     genggar.DefaultBufferSize,
+		RequestTimeout: engine.DefaultRequestTimeout,
+		Retry: RetryConfig{
+			MaxAttempts: engine.DefaultRetryPolicy.MaxAttempts,
+			Backoff:     engine.DefaultRetryPolicy.Backoff,
+			MaxBackoff:  engine.DefaultRetryPolicy.MaxBackoff,
+		},
+		Store: StoreConfig{
+			CompactInterval: time.Hour,
+		},
+		Metrics: MetricsConfig{
+			Path: "/metrics",
+		},
+		Log: LogConfig{
+			Levels: "info,warn,error",
+		},
+	}
+}
+
+//loadConfig reads the config file, applies the environment variables and validates the result
+//the file is optional, the broker can be configured with the environment variables only
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("unable to read config ", err.Error()))
+		}
+
+		err = decodeConfig(path, data, cfg)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("unable to parse config ", err.Error()))
+		}
+	}
+
+	err := cfg.applyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+//decodeConfig decodes the toml file by its .toml extension and the others as yaml, unknown keys are rejected
+func decodeConfig(path string, data []byte, cfg *Config) error {
+	if !strings.EqualFold(filepath.Ext(path), ".toml") {
+		return yaml.UnmarshalStrict(data, cfg)
+	}
+
+	meta, err := toml.Decode(string(data), cfg)
+	if err != nil {
+		return err
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return errors.New(fmt.Sprint("unknown keys ", strings.Join(keys, ", ")))
+	}
+	return nil
+}
+
+//applyEnv overrides the config with GENGGAR_* environment variables
+//GENGGAR_TOPICS is a comma separated list of topic[:overflow]
+func (c *Config) applyEnv(lookup func(key string) (string, bool)) error {
+	var err error
+	env := func(key string, fn func(val string) error) {
+		val, ok := lookup(envPrefix + key)
+		if !ok || err != nil {
+			return
+		}
+
+		if e := fn(val); e != nil {
+			err = errors.New(fmt.Sprint("invalid ", envPrefix, key, " ", e.Error()))
+		}
+	}
+
+	env("LISTEN_ADDRESS", setString(&c.Listen.Address))
+	env("LISTEN_PORT", setInt(&c.Listen.Port))
+	env("LISTEN_TRANSPORT", setString(&c.Listen.Transport))
+	env("BUFFER_SIZE", setInt(&c.BufferSize))
+	env("SUBSCRIBER_BUFFER", setInt(&c.SubscriberBuffer))
+	env("REQUEST_TIMEOUT", setDuration(&c.RequestTimeout))
+	env("STORE_PATH", setString(&c.Store.Path))
+	env("STORE_RETENTION", setDuration(&c.Store.Retention))
+	env("STORE_COMPACT_INTERVAL", setDuration(&c.Store.CompactInterval))
+	env("SPILL_DIR", setString(&c.Spill.Dir))
+	env("SPILL_HEAD", setInt(&c.Spill.Head))
+	env("AUTH_TOKEN", setString(&c.Auth.Token))
+	env("LOG_LEVELS", setString(&c.Log.Levels))
+	env("LOG_ERROR_PATH", setString(&c.Log.ErrorPath))
+	env("LOG_ACCESS_PATH", setString(&c.Log.AccessPath))
+	env("LOG_FORMAT", setString(&c.Log.Format))
+	env("LOG_FILE_FORMAT", setString(&c.Log.FileFormat))
+	env("LOG_ROTATION_MAX_SIZE_MB", setInt(&c.Log.Rotation.MaxSizeMB))
+	env("LOG_ROTATION_INTERVAL", setDuration(&c.Log.Rotation.Interval))
+	env("LOG_ROTATION_MAX_FILES", setInt(&c.Log.Rotation.MaxFiles))
+	env("LOG_ROTATION_COMPRESS", setBool(&c.Log.Rotation.Compress))
+	env("RETRY_MAX_ATTEMPTS", setInt(&c.Retry.MaxAttempts))
+	env("RETRY_BACKOFF", setDuration(&c.Retry.Backoff))
+	env("RETRY_MAX_BACKOFF", setDuration(&c.Retry.MaxBackoff))
+	env("RETRY_DEAD_LETTER_TOPIC", setString(&c.Retry.DeadLetterTopic))
+	env("HTTP_ADDRESS", setString(&c.HTTP.Address))
+	env("HTTP_ORIGINS", func(val string) error {
+		c.HTTP.Origins = nil
+		for _, origin := range strings.Split(val, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.HTTP.Origins = append(c.HTTP.Origins, origin)
+			}
+		}
+		return nil
+	})
+	env("METRICS_ADDRESS", setString(&c.Metrics.Address))
+	env("METRICS_PATH", setString(&c.Metrics.Path))
+	env("TOPICS", func(val string) error {
+		c.Topics = nil
+		for _, item := range strings.Split(val, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			parts := strings.SplitN(item, ":", 2)
+			topic := TopicConfig{Name: parts[0]}
+			if len(parts) == 2 {
+				topic.Overflow = parts[1]
+			}
+			c.Topics = append(c.Topics, topic)
+		}
+		return nil
+	})
+
+	return err
+}
+
+//validate checks the config, every problem is reported at once
+func (c *Config) validate() error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Listen.Address != "" && net.ParseIP(c.Listen.Address) == nil {
+		fail("listen.address %q is not an ip address", c.Listen.Address)
+	}
+	if c.Listen.Port <= 0 || c.Listen.Port > 65535 {
+		fail("listen.port %d is out of range", c.Listen.Port)
+	}
+	if c.Listen.Transport != engine.ProtoUDP {
+		fail("listen.transport %q is not supported, only %s is supported", c.Listen.Transport, engine.ProtoUDP)
+	}
+	if c.BufferSize <= 0 {
+		fail("buffer_size should more than 0")
+	}
+	if c.SubscriberBuffer < 0 {
+		fail("subscriber_buffer should not be negative")
+	}
+	if c.RequestTimeout <= 0 {
+		fail("request_timeout should more than 0")
+	}
+	if c.Store.Retention < 0 {
+		fail("store.retention should not be negative")
+	}
+	if c.Store.Retention > 0 && c.Store.Path == "" {
+		fail("store.retention requires store.path")
+	}
+	if c.Store.Retention > 0 && c.Store.CompactInterval <= 0 {
+		fail("store.compact_interval should more than 0")
+	}
+	if (c.Spill.Dir == "") != (c.Spill.Head == 0) {
+		fail("spill.dir and spill.head should be set together")
+	}
+	if c.HTTP.Address != "" {
+		if _, _, err := net.SplitHostPort(c.HTTP.Address); err != nil {
+			fail("http.address %q is invalid: %s", c.HTTP.Address, err.Error())
+		}
+	}
+	if c.Metrics.Address != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Address); err != nil {
+			fail("metrics.address %q is invalid: %s", c.Metrics.Address, err.Error())
+		}
+		if !strings.HasPrefix(c.Metrics.Path, "/") {
+			fail("metrics.path %q should start with /", c.Metrics.Path)
+		}
+	}
+	for key, format := range map[string]string{"log.format": c.Log.Format, "log.file_format": c.Log.FileFormat} {
+		switch glog.Format(format) {
+		case "", glog.FormatText, glog.FormatJSON:
+		default:
+			fail("%s %q should be text or json", key, format)
+		}
+	}
+	for _, level := range strings.Split(c.Log.Levels, ",") {
+		if level = strings.TrimSpace(level); level != "" && level != "all" {
+			if _, err := glog.ParseLevel(level); err != nil {
+				fail("log.levels: %s", err.Error())
+			}
+		}
+	}
+	for pkg, level := range c.Log.Packages {
+		if _, err := glog.ParseLevel(level); err != nil {
+			fail("log.packages %s: %s", pkg, err.Error())
+		}
+	}
+	for level := range c.Log.Paths {
+		if _, err := glog.ParseLevel(level); err != nil {
+			fail("log.paths: %s", err.Error())
+		}
+	}
+	if c.Log.Rotation.MaxSizeMB < 0 || c.Log.Rotation.Interval < 0 || c.Log.Rotation.MaxFiles < 0 {
+		fail("log.rotation should not be negative")
+	}
+	if c.Retry.MaxAttempts <= 0 {
+		fail("retry.max_attempts should more than 0")
+	}
+	if c.Retry.Backoff < 0 || c.Retry.MaxBackoff < 0 {
+		fail("retry backoff should not be negative")
+	}
+
+	hooks := make(map[string]bool)
+	for i, hook := range c.Webhooks {
+		if hook.Name == "" || hook.Topic == "" || hook.URL == "" {
+			fail("webhooks[%d] name, topic and url are required", i)
+			continue
+		}
+		if hooks[hook.Name] {
+			fail("webhook %s is defined twice", hook.Name)
+		}
+		hooks[hook.Name] = true
+
+		if target, err := url.Parse(hook.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			fail("webhook %s url %q is invalid", hook.Name, hook.URL)
+		}
+	}
+
+	if c.Spill.Head < 0 {
+		fail("spill.head should not be negative")
+	}
+
+	names := make(map[string]bool)
+	for i, topic := range c.Topics {
+		if topic.Name == "" {
+			fail("topics[%d].name is required", i)
+			continue
+		}
+		if names[topic.Name] {
+			fail("topic %s is defined twice", topic.Name)
+		}
+		names[topic.Name] = true
+
+		overflow := topic.overflowConfig()
+		if err := overflow.Validate(); err != nil {
+			fail("topic %s: %s", topic.Name, err.Error())
+		}
+		if overflow.Policy == subscriber.OverflowSpill && c.Spill.Dir != "" {
+			fail("topic %s: spill overflow can not be combined with spill.dir", topic.Name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprint("invalid config: ", strings.Join(problems, "; ")))
+	}
+	return nil
+}
+
+//structuralChanges lists the settings which need restart to take effect
+func (c *Config) structuralChanges(next *Config) []string {
+	var changes []string
+	if c.Listen != next.Listen {
+		changes = append(changes, "listen")
+	}
+	if c.BufferSize != next.BufferSize {
+		changes = append(changes, "buffer_size")
+	}
+	if c.SubscriberBuffer != next.SubscriberBuffer {
+		changes = append(changes, "subscriber_buffer")
+	}
+	if c.Store.Path != next.Store.Path || c.Store.CompactInterval != next.Store.CompactInterval {
+		changes = append(changes, "store.path/compact_interval")
+	}
+	if c.Spill != next.Spill {
+		changes = append(changes, "spill")
+	}
+	if fmt.Sprint(c.Webhooks) != fmt.Sprint(next.Webhooks) {
+		changes = append(changes, "webhooks")
+	}
+	if c.HTTP.Address != next.HTTP.Address || strings.Join(c.HTTP.Origins, ",") != strings.Join(next.HTTP.Origins, ",") {
+		changes = append(changes, "http")
+	}
+	if c.Metrics != next.Metrics {
+		changes = append(changes, "metrics")
+	}
+	if c.Log.ErrorPath != next.Log.ErrorPath || c.Log.AccessPath != next.Log.AccessPath || c.Log.Rotation != next.Log.Rotation ||
+		fmt.Sprint(c.Log.Paths) != fmt.Sprint(next.Log.Paths) {
+		changes = append(changes, "log paths/rotation")
+	}
+	if c.Log.Format != next.Log.Format || c.Log.FileFormat != next.Log.FileFormat {
+		changes = append(changes, "log format")
+	}
+	return changes
+}
+
+//packageLevels converts the package levels, the config is validated
+func (l LogConfig) packageLevels() map[string]glog.Level {
+	levels := make(map[string]glog.Level, len(l.Packages))
+	for pkg, name := range l.Packages {
+		levels[pkg], _ = glog.ParseLevel(name)
+	}
+	return levels
+}
+
+//levelPaths converts the level paths, the config is validated
+func (l LogConfig) levelPaths() map[glog.Level]string {
+	paths := make(map[glog.Level]string, len(l.Paths))
+	for name, path := range l.Paths {
+		level, _ := glog.ParseLevel(name)
+		paths[level] = path
+	}
+	return paths
+}
+
+//rotation converts the config to the glog rotation
+func (r RotationConfig) rotation() glog.Rotation {
+	return glog.Rotation{
+		MaxSize:  int64(r.MaxSizeMB) * 1024 * 1024,
+		Interval: r.Interval,
+		MaxFiles: r.MaxFiles,
+		Compress: r.Compress,
+	}
+}
+
+//retryPolicy converts the config to the server retry policy
+func (r RetryConfig) retryPolicy() engine.RetryPolicy {
+	return engine.RetryPolicy{
+		MaxAttempts:     r.MaxAttempts,
+		Backoff:         r.Backoff,
+		MaxBackoff:      r.MaxBackoff,
+		DeadLetterTopic: r.DeadLetterTopic,
+	}
+}
+
+func (t TopicConfig) overflowConfig() subscriber.OverflowConfig {
+	return subscriber.OverflowConfig{
+		Policy:       subscriber.Overflow(t.Overflow),
+		BlockTimeout: t.BlockTimeout,
+		SpillDir:     t.SpillDir,
+	}
+}
+
+func setString(dst *string) func(string) error {
+	return func(val string) error {
+		*dst = val
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(val string) error {
+		v, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(val string) error {
+		v, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
+
+func setDuration(dst *time.Duration) func(string) error {
+	return func(val string) error {
+		v, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const yamlConfig = `
+listen:
+  address: 127.0.0.1
+  port: 4321
+subscriber_buffer: 64
+request_timeout: 10s
+topics:
+  - name: NOTIFICATION
+    overflow: drop_oldest
+log:
+  levels: warn
+  packages:
+    github.com/syariatifaris/genggar/engine: debug
+`
+
+const tomlConfig = `
+subscriber_buffer = 64
+request_timeout = "10s"
+
+[listen]
+address = "127.0.0.1"
+port = 4321
+
+[[topics]]
+name = "NOTIFICATION"
+overflow = "drop_oldest"
+
+[log]
+levels = "warn"
+
+[log.packages]
+"github.com/syariatifaris/genggar/engine" = "debug"
+`
+
+func writeConfig(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	yamlCfg, err := loadConfig(writeConfig(t, "server.yaml", yamlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tomlCfg, err := loadConfig(writeConfig(t, "server.toml", tomlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(yamlCfg, tomlCfg) {
+		t.Fatalf("toml config differs from yaml\nyaml %+v\ntoml %+v", yamlCfg, tomlCfg)
+	}
+
+	if tomlCfg.Listen.Port != 4321 || tomlCfg.RequestTimeout != 10*time.Second || tomlCfg.Topics[0].Overflow != "drop_oldest" {
+		t.Fatalf("unexpected toml config %+v", tomlCfg)
+	}
+	if tomlCfg.Listen.Transport != "udp" || tomlCfg.BufferSize == 0 {
+		t.Fatal("defaults are not kept")
+	}
+}
+
+func TestLoadConfigUnknownKey(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"server.yaml", "listen:\n  prot: 1234\n"},
+		{"server.toml", "[listen]\nprot = 1234\n"},
+	}
+
+	for _, test := range tests {
+		_, err := loadConfig(writeConfig(t, test.name, test.data))
+		if err == nil {
+			t.Fatalf("%s, unknown key is accepted", test.name)
+		}
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	os.Setenv(envPrefix+"LISTEN_PORT", "5555")
+	defer os.Unsetenv(envPrefix + "LISTEN_PORT")
+
+	cfg, err := loadConfig(writeConfig(t, "server.toml", tomlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen.Port != 5555 {
+		t.Fatalf("environment is not applied, got port %d", cfg.Listen.Port)
+	}
+}
+
+func TestLoadConfigSpillOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		spill    string
+		overflow string
+		ok       bool
+	}{
+		{"spill overflow", "", "spill", true},
+		{"spill client", "spill:\n  dir: /tmp/spill\n  head: 10\n", "drop_oldest", true},
+		{"spill client with spill overflow", "spill:\n  dir: /tmp/spill\n  head: 10\n", "spill", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.spill + "topics:\n  - name: ORDER\n    overflow: " + test.overflow + "\n    spill_dir: /tmp/overflow\n"
+			_, err := loadConfig(writeConfig(t, "server.yaml", data))
+			if (err == nil) != test.ok {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+//genggar-server runs the standalone genggar broker
+//
+//	genggar-server -config /etc/genggar/server.yaml
+//
+//The config file is yaml, or toml when it ends with .toml. It is optional, every setting can be overridden with GENGGAR_* environment variables.
+//SIGHUP reopens the log files and reloads the log levels, topic overflow, request timeout, retry,
+//retention and auth token, the other settings need restart.
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/syariatifaris/genggar"
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/eventstore"
+	"github.com/syariatifaris/genggar/gateway"
+	"github.com/syariatifaris/genggar/glog"
+	"github.com/syariatifaris/genggar/metrics"
+	"github.com/syariatifaris/genggar/subscriber"
+)
+
+//broker keeps the running server and the active config
+type broker struct {
+	mux     sync.Mutex
+	path    string
+	cfg     *Config
+	server  engine.Server
+	store   *eventstore.FileStore
+	http    *http.Server
+	metrics *http.Server
+}
+
+func main() {
+	path := flag.String("config", "", "path of the yaml or toml config file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*path)
+	if err != nil {
+		glog.ERROR.Fatalln(err.Error())
+	}
+
+	glog.Init(&glog.Config{
+		LogLevels:     cfg.Log.Levels,
+		ErrorLogPath:  cfg.Log.ErrorPath,
+		AccessLogPath: cfg.Log.AccessPath,
+		ConsoleFormat: glog.Format(cfg.Log.Format),
+		FileFormat:    glog.Format(cfg.Log.FileFormat),
+		Rotation:      cfg.Log.Rotation.rotation(),
+		PackageLevels: cfg.Log.packageLevels(),
+		LevelPaths:    cfg.Log.levelPaths(),
+	})
+
+	b := &broker{
+		path: *path,
+		cfg:  cfg,
+	}
+
+	err = b.start()
+	if err != nil {
+		glog.ERROR.Fatalln("unable to start broker", err.Error())
+	}
+
+	b.run()
+}
+
+//start creates the event server from the config
+func (b *broker) start() error {
+	cfg := b.cfg
+	opts := []genggar.Option{
+		genggar.WithTransport(cfg.Listen.Transport),
+		genggar.WithBufferSize(cfg.BufferSize),
+		genggar.WithRequestTimeout(cfg.RequestTimeout),
+		genggar.WithRetry(cfg.Retry.retryPolicy()),
+	}
+
+	if cfg.SubscriberBuffer > 0 {
+		opts = append(opts, genggar.WithSubscriberBuffer(cfg.SubscriberBuffer))
+	}
+
+	if cfg.Spill.Dir != "" {
+		opts = append(opts, genggar.WithSpill(cfg.Spill.Dir, cfg.Spill.Head))
+	}
+
+	if cfg.Auth.Token != "" {
+		opts = append(opts, genggar.WithAuthToken(cfg.Auth.Token))
+	}
+
+	if cfg.Metrics.Address != "" {
+		registry := metrics.NewRegistry()
+		opts = append(opts, genggar.WithMetrics(registry))
+
+		mux := http.NewServeMux()
+		mux.Handle(cfg.Metrics.Path, registry)
+		b.metrics = &http.Server{
+			Addr:    cfg.Metrics.Address,
+			Handler: mux,
+		}
+	}
+
+	for _, topic := range cfg.Topics {
+		opts = append(opts, genggar.WithTopicOverflow(topic.Name, topic.overflowConfig()))
+	}
+
+	if cfg.Store.Path != "" {
+		store, err := eventstore.NewFileStore(cfg.Store.Path)
+		if err != nil {
+			return err
+		}
+		b.store = store
+		opts = append(opts, genggar.WithStore(store))
+	}
+
+	server, err := genggar.NewEventServer(cfg.Listen.Address, cfg.Listen.Port, opts...)
+	if err != nil {
+		return err
+	}
+
+	b.server = server
+	for _, hook := range cfg.Webhooks {
+		_, err := gateway.AttachWebhook(server, hook.Name, hook.Topic, gateway.WebhookConfig{
+			URL:     hook.URL,
+			Secret:  hook.Secret,
+			Timeout: hook.Timeout,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.HTTP.Address != "" {
+		gw := gateway.NewHTTPGateway(server)
+		if len(cfg.HTTP.Origins) > 0 {
+			gw.CheckOrigin = gateway.AllowOrigins(cfg.HTTP.Origins...)
+		}
+
+		b.http = &http.Server{
+			Addr:    cfg.HTTP.Address,
+			Handler: gw,
+		}
+	}
+	return nil
+}
+
+//run serves until SIGINT or SIGTERM, SIGHUP reloads the config
+func (b *broker) run() {
+	stopServer := make(chan bool)
+	stopDispatcher := make(chan bool)
+	stopCompact := make(chan bool)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		b.server.Start(stopServer)
+	}()
+	go func() {
+		defer wg.Done()
+		b.server.DispatchEventPublisher(stopDispatcher)
+	}()
+	go func() {
+		defer wg.Done()
+		b.compactLoop(stopCompact)
+	}()
+
+	glog.INFO.Printf("genggar broker listening on %s:%d\n", b.cfg.Listen.Address, b.cfg.Listen.Port)
+
+	if b.http != nil {
+		go func() {
+			glog.INFO.Println("http gateway listening on", b.http.Addr)
+			err := b.http.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				glog.ERROR.Fatalln("http gateway fail", err.Error())
+			}
+		}()
+	}
+
+	if b.metrics != nil {
+		go func() {
+			glog.INFO.Println("metrics listening on", b.metrics.Addr)
+			err := b.metrics.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				glog.ERROR.Fatalln("metrics fail", err.Error())
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			b.reload()
+			continue
+		}
+
+		glog.INFO.Println("stopping genggar broker", sig.String())
+		break
+	}
+
+	if b.http != nil {
+		//the open event streams are closed after the grace period
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		if b.http.Shutdown(ctx) != nil {
+			b.http.Close()
+		}
+		cancel()
+	}
+
+	if b.metrics != nil {
+		b.metrics.Close()
+	}
+
+	stopServer <- true
+	stopDispatcher <- true
+	close(stopCompact)
+	wg.Wait()
+
+	if b.store != nil {
+		b.store.Close()
+	}
+}
+
+//reload reopens the log files and applies the non structural settings of the new config,
+//the invalid config is ignored
+func (b *broker) reload() {
+	//the log files moved by logrotate are released before anything is logged
+	err := glog.Reopen()
+	if err != nil {
+		glog.ERROR.Println(err.Error())
+	}
+
+	next, err := loadConfig(b.path)
+	if err != nil {
+		glog.ERROR.Println("reload config fail", err.Error())
+		return
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if changes := b.cfg.structuralChanges(next); len(changes) > 0 {
+		glog.WARN.Println("config changes need restart, ignored:", changes)
+	}
+
+	glog.SetLevels(next.Log.Levels)
+	glog.SetPackageLevels(next.Log.packageLevels())
+	b.server.SetRequestTimeout(next.RequestTimeout)
+	b.server.SetAuthToken(next.Auth.Token)
+	b.server.SetRetryPolicy(next.Retry.retryPolicy())
+
+	//topics removed from the config go back to the default policy
+	configured := make(map[string]bool)
+	for _, topic := range next.Topics {
+		configured[topic.Name] = true
+		err := b.server.SetTopicOverflow(topic.Name, topic.overflowConfig())
+		if err != nil {
+			glog.ERROR.Println("unable to set topic overflow", topic.Name, err.Error())
+		}
+	}
+	for _, topic := range b.cfg.Topics {
+		if !configured[topic.Name] {
+			b.server.SetTopicOverflow(topic.Name, subscriber.OverflowConfig{})
+		}
+	}
+
+	//structural settings stay as they are running
+	next.Listen = b.cfg.Listen
+	next.BufferSize = b.cfg.BufferSize
+	next.SubscriberBuffer = b.cfg.SubscriberBuffer
+	next.Store.Path = b.cfg.Store.Path
+	next.Store.CompactInterval = b.cfg.Store.CompactInterval
+	next.Spill = b.cfg.Spill
+	next.HTTP = b.cfg.HTTP
+	next.Webhooks = b.cfg.Webhooks
+	next.Metrics = b.cfg.Metrics
+	next.Log.ErrorPath = b.cfg.Log.ErrorPath
+	next.Log.AccessPath = b.cfg.Log.AccessPath
+	next.Log.Format = b.cfg.Log.Format
+	next.Log.FileFormat = b.cfg.Log.FileFormat
+	next.Log.Rotation = b.cfg.Log.Rotation
+	next.Log.Paths = b.cfg.Log.Paths
+	b.cfg = next
+
+	glog.INFO.Println("config reloaded")
+}
+
+//compactLoop removes the records older than the retention from the event store
+func (b *broker) compactLoop(stopChan <-chan bool) {
+	if b.store == nil {
+		return
+	}
+
+	b.mux.Lock()
+	interval := b.cfg.Store.CompactInterval
+	b.mux.Unlock()
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			b.mux.Lock()
+			retention := b.cfg.Store.Retention
+			b.mux.Unlock()
+			if retention <= 0 {
+				continue
+			}
+
+			removed, err := b.store.Compact(time.Now().Add(-retention))
+			if err != nil {
+				glog.ERROR.Println("compact event store fail", err.Error())
+				continue
+			}
+			glog.DEBUG.Println("event store compacted, removed", removed)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/syariatifaris/genggar"
+	"github.com/syariatifaris/genggar/engine"
+)
+
+func list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	srv := serverFlags(fs)
+	asJSON := fs.Bool("json", false, "print the result as json")
+	timeout := fs.Duration("timeout", time.Second*5, "wait for the server answer")
+	fs.Parse(args)
+
+	var result *engine.ListResult
+	err := withAdmin(srv, *timeout, func(ctx context.Context, admin *engine.AdminClient) error {
+		var err error
+		result, err = admin.List(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tSUBSCRIBERS\tPUBLISHED\tDELIVERED\tREJECTED\tDROPPED\tPROCESSED\tFAILED\tRETRIED\tDEAD")
+	for _, t := range result.Topics {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			t.Name, t.Subscribers, t.Published, t.Delivered, t.Rejected, t.Dropped, t.Processed, t.Failed, t.Retried, t.DeadLettered)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "SUBSCRIBER\tTOPIC\tBUFFER\tSTATE\tDROPPED\tLAST SEEN")
+	for _, sub := range result.Subscribers {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s ago\n",
+			sub.Name, sub.Topic, sub.BufferLen, state(sub), sub.Dropped, time.Since(sub.LastSeen).Round(time.Second))
+	}
+	return w.Flush()
+}
+
+func pause(args []string) error {
+	return setPaused("pause", args)
+}
+
+func resume(args []string) error {
+	return setPaused("resume", args)
+}
+
+//setPaused pauses or resumes the dispatch to the subscriber named by the list command
+func setPaused(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	srv := serverFlags(fs)
+	sub := fs.String("subscriber", "", "subscriber name, as printed by list")
+	timeout := fs.Duration("timeout", time.Second*5, "wait for the server answer")
+	fs.Parse(args)
+
+	if *sub == "" {
+		return errors.New(fmt.Sprint(name, " -subscriber is required"))
+	}
+
+	return withAdmin(srv, *timeout, func(ctx context.Context, admin *engine.AdminClient) error {
+		if name == "pause" {
+			return admin.Pause(ctx, *sub)
+		}
+		return admin.Resume(ctx, *sub)
+	})
+}
+
+func withAdmin(srv *server, timeout time.Duration, fn func(ctx context.Context, admin *engine.AdminClient) error) error {
+	admin, err := genggar.NewAdminClient(srv.addr, srv.port, srv.options()...)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return fn(ctx, admin)
+}
+
+func state(sub engine.SubscriberInfo) string {
+	switch {
+	case sub.Paused:
+		return "paused"
+	case sub.Lagging:
+		return "lagging"
+	case sub.Dispatching:
+		return "dispatching"
+	}
+	return "idle"
+}
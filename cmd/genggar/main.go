@@ -0,0 +1,103 @@
+//genggar is the command line client of the genggar server
+//
+//	genggar publish -topic ORDER -event NEW_ORDER '{"id": 1}'
+//	genggar subscribe -topic ORDER
+//	genggar tail -topic ORDER -from 120
+//	genggar list
+//	genggar pause -subscriber 127.0.0.1:52011
+//
+//The events are printed as json lines to stdout, the errors are printed to stderr.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/syariatifaris/genggar"
+	"github.com/syariatifaris/genggar/glog"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "publish", usage: "publish an event, the json payload is read from the argument or stdin", run: publish},
+	{name: "subscribe", usage: "subscribe to a topic and print the events as json lines", run: subscribe},
+	{name: "tail", usage: "print the stored events of a topic from an offset, then the new events", run: tail},
+	{name: "list", usage: "list the topics with their counters and the subscribers state", run: list},
+	{name: "pause", usage: "hold the dispatch to a subscriber, the events are still buffered", run: pause},
+	{name: "resume", usage: "continue the dispatch to a paused subscriber", run: resume},
+}
+
+func main() {
+	//the library logs only errors, stdout is kept for the command output
+	glog.Init(&glog.Config{LogLevels: "error"})
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			err := cmd.run(os.Args[2:])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "genggar:", err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: genggar <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run genggar <command> -h for the command flags")
+}
+
+//server holds the connection flags shared by the commands
+type server struct {
+	addr  string
+	port  int
+	token string
+}
+
+func serverFlags(fs *flag.FlagSet) *server {
+	s := &server{}
+	fs.StringVar(&s.addr, "addr", "127.0.0.1", "server address")
+	fs.IntVar(&s.port, "port", 1234, "server port")
+	fs.StringVar(&s.token, "token", os.Getenv("GENGGAR_AUTH_TOKEN"), "auth token, defaults to GENGGAR_AUTH_TOKEN")
+	return s
+}
+
+func (s *server) options() []genggar.Option {
+	if s.token == "" {
+		return nil
+	}
+	return []genggar.Option{genggar.WithAuthToken(s.token)}
+}
+
+//splitList splits the comma separated flag value
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
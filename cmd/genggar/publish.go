@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/syariatifaris/genggar"
+)
+
+//publish sends the event through the server, the payload should be valid json
+func publish(args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	srv := serverFlags(fs)
+	topic := fs.String("topic", "", "event topic")
+	event := fs.String("event", "", "event name")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: genggar publish -topic TOPIC -event EVENT [payload]")
+		fmt.Fprintln(os.Stderr, "the payload is read from stdin when it is not given or it is -")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *topic == "" || *event == "" {
+		return errors.New("publish -topic and -event are required")
+	}
+
+	var payload []byte
+	switch {
+	case fs.NArg() > 1:
+		return errors.New("publish accepts a single payload argument")
+	case fs.NArg() == 1 && fs.Arg(0) != "-":
+		payload = []byte(fs.Arg(0))
+	default:
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return errors.New(fmt.Sprint("unable to read payload ", err.Error()))
+		}
+		payload = data
+	}
+
+	var buf bytes.Buffer
+	err := json.Compact(&buf, payload)
+	if err != nil {
+		return errors.New(fmt.Sprint("payload is not valid json ", err.Error()))
+	}
+
+	client, err := genggar.NewSubscriberClient(srv.addr, srv.port, *topic, nil, srv.options()...)
+	if err != nil {
+		return err
+	}
+
+	return client.PublishEvent(*topic, *event, buf.String())
+}
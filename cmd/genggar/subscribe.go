@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/syariatifaris/genggar"
+	"github.com/syariatifaris/genggar/engine"
+)
+
+//eventLine is the printed event, data is the raw message when it is json
+type eventLine struct {
+	Seq           uint64      `json:"seq,omitempty"`
+	Topic         string      `json:"topic"`
+	Event         string      `json:"event"`
+	UUID          string      `json:"uuid"`
+	CorrelationID string      `json:"correlation_id,omitempty"`
+	CausationID   string      `json:"causation_id,omitempty"`
+	Data          interface{} `json:"data,omitempty"`
+}
+
+func subscribe(args []string) error {
+	fs := flag.NewFlagSet("subscribe", flag.ExitOnError)
+	srv := serverFlags(fs)
+	topic := fs.String("topic", "", "event topic")
+	events := fs.String("events", engine.AllEvents, "comma separated events to print")
+	fs.Parse(args)
+
+	return listen(srv, *topic, *events)
+}
+
+func tail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	srv := serverFlags(fs)
+	topic := fs.String("topic", "", "event topic")
+	events := fs.String("events", engine.AllEvents, "comma separated events to print")
+	from := fs.Uint64("from", 1, "event store sequence to start from")
+	fs.Parse(args)
+
+	if *from == 0 {
+		return errors.New("tail -from should start from 1")
+	}
+
+	return listen(srv, *topic, *events, genggar.WithOffset(*from))
+}
+
+//listen prints the events of the topic until interrupted
+func listen(srv *server, topic, events string, opts ...genggar.Option) error {
+	if topic == "" {
+		return errors.New("-topic is required")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	processors := []*engine.EventProcessor{
+		{
+			Events: splitList(events),
+			Callback: func(topic, eventName string, data interface{}) error {
+				evt, err := engine.ParseEvent(data)
+				if err != nil {
+					return err
+				}
+
+				line := eventLine{
+					Seq:           evt.Seq,
+					Topic:         topic,
+					Event:         evt.Event,
+					UUID:          evt.UUID,
+					CorrelationID: evt.CorrelationID,
+					CausationID:   evt.CausationID,
+				}
+				if json.Valid([]byte(evt.Message)) {
+					line.Data = json.RawMessage(evt.Message)
+				} else if evt.Message != "" {
+					line.Data = evt.Message
+				}
+
+				return encoder.Encode(line)
+			},
+		},
+	}
+
+	client, err := genggar.NewSubscriberClient(srv.addr, srv.port, topic, processors, append(srv.options(), opts...)...)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan bool)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Fprintln(os.Stderr, "genggar: stopped by", sig.String())
+		stop <- true
+	}()
+
+	return client.StartListen(stop)
+}
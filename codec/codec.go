@@ -0,0 +1,117 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Envelope is the protocol message, the command payload is Data
+//Data is the value to encode, the decoded Data is Raw
+type Envelope struct {
+	Cmd      string
+	Msg      string
+	Data     interface{}
+	Priority int
+}
+
+//Codec encodes the protocol envelope on the wire
+type Codec interface {
+	//Name is negotiated on the subscriber registration
+	Name() string
+	Encode(env *Envelope) ([]byte, error)
+	//Decode reads the envelope, Data is kept as Raw until it is unmarshalled into the command type
+	Decode(data []byte) (*Envelope, error)
+	//Unmarshal decodes the raw data of the envelope into v
+	Unmarshal(raw []byte, v interface{}) error
+	//Match reports whether the data is encoded by the codec, it reads the leading bytes only
+	Match(data []byte) bool
+}
+
+//Raw is the undecoded data of the envelope
+type Raw struct {
+	Codec Codec
+	Bytes []byte
+}
+
+//Decode unmarshals the raw data into v
+func (r Raw) Decode(v interface{}) error {
+	if r.Codec == nil {
+		return errors.New("raw data without codec")
+	}
+	return r.Codec.Unmarshal(r.Bytes, v)
+}
+
+//Value decodes the raw data into the generic value, such as map[string]interface{}
+func (r Raw) Value() (interface{}, error) {
+	var v interface{}
+	err := r.Decode(&v)
+	return v, err
+}
+
+const (
+	NameJSON     = "json"
+	NameMsgPack  = "msgpack"
+	NameProtobuf = "protobuf"
+)
+
+var (
+	mux    sync.RWMutex
+	codecs = map[string]Codec{
+		NameJSON:     JSON{},
+		NameMsgPack:  MsgPack{},
+		NameProtobuf: Protobuf{},
+	}
+)
+
+//Register adds the codec, the codec of the same name is replaced
+func Register(c Codec) {
+	mux.Lock()
+	defer mux.Unlock()
+	codecs[c.Name()] = c
+}
+
+//Get finds the codec by name, the empty name is json
+func Get(name string) (Codec, error) {
+	if name == "" {
+		name = NameJSON
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprint("unsupported codec ", name))
+	}
+	return c, nil
+}
+
+//Detect finds the codec of the data, json is checked first and it is the fallback
+func Detect(data []byte) Codec {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	if (JSON{}).Match(data) {
+		return codecs[NameJSON]
+	}
+
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name != NameJSON && codecs[name].Match(data) {
+			return codecs[name]
+		}
+	}
+	return codecs[NameJSON]
+}
+
+//DecodeAny decodes the data with the detected codec
+func DecodeAny(data []byte) (*Envelope, error) {
+	return Detect(data).Decode(data)
+}
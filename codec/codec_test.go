@@ -0,0 +1,249 @@
+package codec_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/tracing"
+)
+
+var codecNames = []string{codec.NameJSON, codec.NameMsgPack, codec.NameProtobuf}
+
+//event is the typical event of the benchmarks
+var event = engine.EventMessage{
+	Event:         "NEW_ORDER_VERIFIED",
+	UUID:          "01HV4Z7Q9J8N5W3XK2M6R1T0YB",
+	Seq:           1024,
+	Message:       "order verified",
+	CorrelationID: "01HV4Z7Q9J8N5W3XK2M6R1T0YA",
+	CausationID:   "01HV4Z7Q9J8N5W3XK2M6R1T0Y9",
+	ReplyTo:       "127.0.0.1:1234",
+	Payload: map[string]interface{}{
+		"order_id": 123456,
+		"shop_id":  789,
+		"amount":   150000.5,
+		"items":    []string{"SKU-1", "SKU-2", "SKU-3"},
+	},
+	TraceContext: tracing.Headers{
+		tracing.HeaderTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		tracing.HeaderTraceState:  "genggar=1",
+	},
+}
+
+func getCodec(t testing.TB, name string) codec.Codec {
+	c, err := codec.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+//sameJSON compares the values by their json form, the codecs decode the generic numbers into different types
+func sameJSON(t *testing.T, got, want interface{}) {
+	t.Helper()
+
+	gotJSON, wantJSON := normalJSON(t, got), normalJSON(t, want)
+	if gotJSON != wantJSON {
+		t.Fatalf("got %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+//normalJSON encodes the value with the sorted keys of the generic maps
+func normalJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var generic interface{}
+	err = json.Unmarshal(data, &generic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = json.Marshal(generic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   string
+		data  interface{}
+		typed func() interface{}
+	}{
+		{"event", engine.CmdEvent, event, func() interface{} { return &engine.EventMessage{} }},
+		{"empty event", engine.CmdEvent, engine.EventMessage{}, func() interface{} { return &engine.EventMessage{} }},
+		{"register", engine.CmdReg, engine.RegisterMessage{Topic: "ORDER", Token: "secret", FromSeq: 42, Codec: codec.NameProtobuf}, func() interface{} { return &engine.RegisterMessage{} }},
+		{"ack", engine.CmdAck, engine.AckMessage{UUID: "order-1", Topic: "ORDER", Event: "NEW_ORDER", CorrelationID: "order-1", Error: "out of stock"}, func() interface{} { return &engine.AckMessage{} }},
+		{"publish", engine.CmdPublish, engine.PublishMessage{Topic: "ORDER", Event: "NEW_ORDER", TraceContext: event.TraceContext}, func() interface{} { return &engine.PublishMessage{} }},
+		{"reply", engine.CmdReply, engine.ReplyMessage{RequestID: "req-1", Event: "PRICE", Data: map[string]interface{}{"price": 10}}, func() interface{} { return &engine.ReplyMessage{} }},
+	}
+
+	for _, name := range codecNames {
+		c := getCodec(t, name)
+		for _, test := range tests {
+			t.Run(name+"/"+test.name, func(t *testing.T) {
+				data, err := c.Encode(&codec.Envelope{Cmd: test.cmd, Msg: "message", Data: test.data, Priority: 2})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if detected := codec.Detect(data); detected.Name() != name {
+					t.Fatalf("detected %s", detected.Name())
+				}
+
+				env, err := codec.DecodeAny(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if env.Cmd != test.cmd || env.Msg != "message" || env.Priority != 2 {
+					t.Fatalf("unexpected envelope %+v", env)
+				}
+
+				raw, ok := env.Data.(codec.Raw)
+				if !ok {
+					t.Fatalf("data is %T, want codec.Raw", env.Data)
+				}
+
+				//the command type
+				typed := test.typed()
+				err = raw.Decode(typed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sameJSON(t, typed, test.data)
+
+				//the generic value received by the event callbacks
+				generic, err := raw.Value()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := generic.(map[string]interface{}); !ok {
+					t.Fatalf("generic value is %T, want map[string]interface{}", generic)
+				}
+				sameJSON(t, generic, test.data)
+			})
+		}
+	}
+}
+
+func TestRoundTripWithoutData(t *testing.T) {
+	for _, name := range codecNames {
+		c := getCodec(t, name)
+
+		data, err := c.Encode(&codec.Envelope{Cmd: engine.CmdInfo, Msg: "client registration success"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		env, err := c.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.Cmd != engine.CmdInfo || env.Msg != "client registration success" || env.Data != nil || env.Priority != 0 {
+			t.Fatalf("%s, unexpected envelope %+v", name, env)
+		}
+	}
+}
+
+//TestEncodeDeterministic checks the map keys are written in the same order, the frames are compared by their bytes
+func TestEncodeDeterministic(t *testing.T) {
+	data := make(map[string]interface{})
+	for _, key := range []string{"order_id", "shop_id", "amount", "items", "status", "user_id", "address", "note"} {
+		data[key] = key
+	}
+	env := &codec.Envelope{Cmd: engine.CmdEvent, Data: map[string]interface{}{"payload": data}}
+
+	for _, name := range codecNames {
+		c := getCodec(t, name)
+		want, err := c.Encode(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 20; i++ {
+			got, err := c.Encode(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Fatalf("%s, encoding differs\n%x\n%x", name, got, want)
+			}
+		}
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	for _, name := range codecNames {
+		data, err := getCodec(t, name).Encode(&codec.Envelope{Cmd: engine.CmdEvent, Data: event})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		env, err := codec.DecodeAny(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		evt, err := engine.ParseEvent(env.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if evt.UUID != event.UUID || evt.Seq != event.Seq || evt.TraceContext[tracing.HeaderTraceParent] != event.TraceContext[tracing.HeaderTraceParent] {
+			t.Fatalf("%s, unexpected event %+v", name, evt)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	env := &codec.Envelope{Cmd: engine.CmdEvent, Msg: "order verified", Data: event}
+	for _, name := range codecNames {
+		c := getCodec(b, name)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			var data []byte
+			for i := 0; i < b.N; i++ {
+				var err error
+				data, err = c.Encode(env)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes")
+		})
+	}
+}
+
+//BenchmarkDecode reads the envelope and the event like the subscriber client
+func BenchmarkDecode(b *testing.B) {
+	env := &codec.Envelope{Cmd: engine.CmdEvent, Msg: "order verified", Data: event}
+	for _, name := range codecNames {
+		c := getCodec(b, name)
+		data, err := c.Encode(env)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				decoded, err := c.Decode(data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, err = engine.ParseEvent(decoded.Data)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes")
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+//The frame is the versioned binary header in front of the codec encoded envelope, big endian
+//
+//	offset  size  field
+//	0       2     magic "GG" (0x47 0x47)
+//	2       1     version
+//	3       1     command code
+//	4       1     flags
+//	5       4     payload length
+//	9       4     crc32 (IEEE) of the header bytes 0-8 and the payload
+//	13      n     payload
+//
+//The magic and the version keep their offsets in every version, so a frame of an unknown version
+//is recognized and answered before the rest of its header is read
+const (
+	FrameMagic0 byte = 0x47
+	FrameMagic1 byte = 0x47
+
+	//FrameVersion is the newest frame version, MinFrameVersion is the oldest one still accepted
+	FrameVersion    uint8 = 1
+	MinFrameVersion uint8 = 1
+
+	FrameHeaderLen = 13
+
+	//MaxPayload is the largest payload of the frame in a udp datagram, the decompressed payload
+	//can not be larger than the uncompressed one
+	MaxPayload = 65507 - FrameHeaderLen
+)
+
+const (
+	//FlagCompressed the payload is gzip compressed
+	FlagCompressed uint8 = 1 << iota
+
+	knownFlags = FlagCompressed
+)
+
+//CompressThreshold is the payload size from which the payload is compressed
+var CompressThreshold = 1024
+
+var (
+	ErrFrameShort    = errors.New("frame is shorter than its header")
+	ErrFrameChecksum = errors.New("frame checksum mismatch")
+	ErrFrameTooLarge = errors.New(fmt.Sprint("frame payload is larger than ", MaxPayload, " bytes"))
+)
+
+//VersionError is returned for the frame of a version which is not supported
+type VersionError struct {
+	Version uint8
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprint("unsupported protocol version ", e.Version, ", supported ", MinFrameVersion, "-", FrameVersion)
+}
+
+//Frame is the decoded frame, Payload is uncompressed
+type Frame struct {
+	Version uint8
+	Command uint8
+	Flags   uint8
+	Payload []byte
+}
+
+//IsFrame reports the leading magic of the frame
+func IsFrame(data []byte) bool {
+	return len(data) >= 2 && data[0] == FrameMagic0 && data[1] == FrameMagic1
+}
+
+//FrameVersionOf reads the version of the frame without checking the rest of the header
+func FrameVersionOf(data []byte) (uint8, bool) {
+	if !IsFrame(data) || len(data) < 3 {
+		return 0, false
+	}
+	return data[2], true
+}
+
+//SupportedVersion reports whether the frame version can be read and written
+func SupportedVersion(version uint8) bool {
+	return version >= MinFrameVersion && version <= FrameVersion
+}
+
+//WriteFrame puts the header in front of the payload, the large payload is compressed
+func WriteFrame(version, command uint8, payload []byte) ([]byte, error) {
+	if !SupportedVersion(version) {
+		return nil, &VersionError{Version: version}
+	}
+	if len(payload) > MaxPayload {
+		return nil, ErrFrameTooLarge
+	}
+
+	var flags uint8
+	if len(payload) >= CompressThreshold {
+		compressed, err := compress(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(payload) {
+			payload = compressed
+			flags |= FlagCompressed
+		}
+	}
+
+	buf := make([]byte, FrameHeaderLen+len(payload))
+	buf[0] = FrameMagic0
+	buf[1] = FrameMagic1
+	buf[2] = version
+	buf[3] = command
+	buf[4] = flags
+	binary.BigEndian.PutUint32(buf[5:9], uint32(len(payload)))
+	copy(buf[FrameHeaderLen:], payload)
+	binary.BigEndian.PutUint32(buf[9:13], checksum(buf))
+	return buf, nil
+}
+
+//ReadFrame checks the header and returns the frame, the unsupported version is VersionError
+func ReadFrame(data []byte) (*Frame, error) {
+	if !IsFrame(data) {
+		return nil, errors.New("frame magic mismatch")
+	}
+
+	version, ok := FrameVersionOf(data)
+	if !ok {
+		return nil, ErrFrameShort
+	}
+	if !SupportedVersion(version) {
+		return nil, &VersionError{Version: version}
+	}
+
+	if len(data) < FrameHeaderLen {
+		return nil, ErrFrameShort
+	}
+
+	length := binary.BigEndian.Uint32(data[5:9])
+	if uint64(len(data)-FrameHeaderLen) != uint64(length) {
+		return nil, errors.New(fmt.Sprint("frame length mismatch, header ", length, " got ", len(data)-FrameHeaderLen))
+	}
+
+	if binary.BigEndian.Uint32(data[9:13]) != checksum(data) {
+		return nil, ErrFrameChecksum
+	}
+
+	frame := &Frame{
+		Version: version,
+		Command: data[3],
+		Flags:   data[4],
+		Payload: data[FrameHeaderLen:],
+	}
+	if frame.Flags&^knownFlags != 0 {
+		return nil, errors.New(fmt.Sprintf("unknown frame flags %#x", frame.Flags&^knownFlags))
+	}
+
+	if frame.Flags&FlagCompressed != 0 {
+		payload, err := decompress(frame.Payload)
+		if err == ErrFrameTooLarge {
+			return nil, err
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("decompress frame fail ", err.Error()))
+		}
+		frame.Payload = payload
+	}
+
+	return frame, nil
+}
+
+//checksum covers the header without the checksum field and the payload
+func checksum(frame []byte) uint32 {
+	crc := crc32.ChecksumIEEE(frame[:9])
+	return crc32.Update(crc, crc32.IEEETable, frame[FrameHeaderLen:])
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//decompress stops reading after MaxPayload, so the small frame can not expand into a large allocation
+func decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	payload, err := ioutil.ReadAll(io.LimitReader(r, MaxPayload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > MaxPayload {
+		return nil, ErrFrameTooLarge
+	}
+	return payload, nil
+}
@@ -0,0 +1,233 @@
+package codec_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/syariatifaris/genggar/codec"
+)
+
+//goldenFrames are the frames of the event envelope written by version 1, a change of the bytes
+//is a change of the wire format and needs a new frame version
+var goldenFrames = []struct {
+	codec string
+	frame string
+}{
+	{codec.NameJSON, "4747010400000000677e9938ec7b22636d64223a225b4556545d222c226d7367223a226f72646572207665726966696564222c2264617461223a7b226576656e74223a224e45575f4f52444552222c2275756964223a2230314856345a3751394a384e355733584b324d36523154305942227d7d"},
+	{codec.NameMsgPack, "4747010400000000563e1903c783a3636d64a55b4556545da36d7367ae6f72646572207665726966696564a464617461c43182a56576656e74a94e45575f4f52444552a475756964ba30314856345a3751394a384e355733584b324d36523154305942"},
+	{codec.NameProtobuf, "47470104000000005265c1f93c0a055b4556545d120e6f726465722076657269666965641a397b226576656e74223a224e45575f4f52444552222c2275756964223a2230314856345a3751394a384e355733584b324d36523154305942227d"},
+}
+
+//goldenCompressed is the json frame of the 2000 bytes message, the gzip output may differ between
+//the go versions so it is only read
+const goldenCompressed = "474701040100000048e7b1d4ab1f8b08000000000000ffaa564ace4d51b2528a760d0b8955d251ca2d4e57b2524a1c05a360148c8251300a46c190074a3a4a298925894a5679a53939b5800100e5f37efaf4070000"
+
+var goldenEnvelope = &codec.Envelope{
+	Cmd: "[EVT]",
+	Msg: "order verified",
+	Data: map[string]interface{}{
+		"event": "NEW_ORDER",
+		"uuid":  "01HV4Z7Q9J8N5W3XK2M6R1T0YB",
+	},
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFrameLayout(t *testing.T) {
+	if codec.FrameHeaderLen != 13 {
+		t.Fatalf("header length %d", codec.FrameHeaderLen)
+	}
+	if codec.FrameMagic0 != 'G' || codec.FrameMagic1 != 'G' {
+		t.Fatalf("magic %c%c", codec.FrameMagic0, codec.FrameMagic1)
+	}
+	if codec.FlagCompressed != 1 {
+		t.Fatalf("compressed flag %d", codec.FlagCompressed)
+	}
+}
+
+func TestGoldenFrames(t *testing.T) {
+	for _, golden := range goldenFrames {
+		t.Run(golden.codec, func(t *testing.T) {
+			want := decodeHex(t, golden.frame)
+
+			payload, err := getCodec(t, golden.codec).Encode(goldenEnvelope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame, err := codec.WriteFrame(1, 4, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(frame, want) {
+				t.Fatalf("got %x\nwant %x", frame, want)
+			}
+
+			readFrame(t, want, goldenEnvelope)
+		})
+	}
+}
+
+func TestGoldenCompressedFrame(t *testing.T) {
+	readFrame(t, decodeHex(t, goldenCompressed), &codec.Envelope{Cmd: "[EVT]", Msg: strings.Repeat("a", 2000)})
+}
+
+//readFrame reads the version 1 event frame and compares its envelope with want
+func readFrame(t *testing.T, data []byte, want *codec.Envelope) {
+	t.Helper()
+
+	frame, err := codec.ReadFrame(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Version != 1 || frame.Command != 4 {
+		t.Fatalf("got version %d command %d", frame.Version, frame.Command)
+	}
+
+	env, err := codec.DecodeAny(frame.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Cmd != want.Cmd || env.Msg != want.Msg {
+		t.Fatalf("unexpected envelope %+v", env)
+	}
+
+	var got interface{}
+	if raw, ok := env.Data.(codec.Raw); ok {
+		got, err = raw.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want.Data == nil {
+		if got != nil {
+			t.Fatalf("unexpected data %v", got)
+		}
+		return
+	}
+	sameJSON(t, got, want.Data)
+}
+
+func TestWriteFrameCompress(t *testing.T) {
+	tests := []struct {
+		name       string
+		payload    []byte
+		compressed bool
+	}{
+		{"small", []byte(strings.Repeat("a", codec.CompressThreshold-1)), false},
+		{"large", []byte(strings.Repeat("a", codec.CompressThreshold)), true},
+		{"max", []byte(strings.Repeat("a", codec.MaxPayload)), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := codec.WriteFrame(codec.FrameVersion, 4, test.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			frame, err := codec.ReadFrame(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compressed := frame.Flags&codec.FlagCompressed != 0; compressed != test.compressed {
+				t.Fatalf("got compressed %v", compressed)
+			}
+			if !bytes.Equal(frame.Payload, test.payload) {
+				t.Fatal("payload mismatch")
+			}
+		})
+	}
+}
+
+func TestWriteFrameTooLarge(t *testing.T) {
+	_, err := codec.WriteFrame(codec.FrameVersion, 4, make([]byte, codec.MaxPayload+1))
+	if err != codec.ErrFrameTooLarge {
+		t.Fatalf("got %v", err)
+	}
+}
+
+//newFrame writes the frame of the header fields, the compressed payload is written as it is
+func newFrame(t *testing.T, version, flags uint8, payload []byte) []byte {
+	buf := make([]byte, codec.FrameHeaderLen+len(payload))
+	buf[0] = codec.FrameMagic0
+	buf[1] = codec.FrameMagic1
+	buf[2] = version
+	buf[3] = 4
+	buf[4] = flags
+	binary.BigEndian.PutUint32(buf[5:9], uint32(len(payload)))
+	copy(buf[codec.FrameHeaderLen:], payload)
+
+	crc := crc32.ChecksumIEEE(buf[:9])
+	binary.BigEndian.PutUint32(buf[9:13], crc32.Update(crc, crc32.IEEETable, payload))
+	return buf
+}
+
+func gzipped(t *testing.T, size int) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(make([]byte, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	golden := decodeHex(t, goldenFrames[0].frame)
+
+	corrupted := append([]byte(nil), golden...)
+	corrupted[len(corrupted)-2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"no magic", []byte(`{"cmd":"[EVT]"}`), "frame magic mismatch"},
+		{"no version", golden[:2], codec.ErrFrameShort.Error()},
+		{"short header", golden[:codec.FrameHeaderLen-1], codec.ErrFrameShort.Error()},
+		{"future version", newFrame(t, codec.FrameVersion+1, 0, []byte("{}")), (&codec.VersionError{Version: codec.FrameVersion + 1}).Error()},
+		{"old version", newFrame(t, codec.MinFrameVersion-1, 0, []byte("{}")), (&codec.VersionError{Version: codec.MinFrameVersion - 1}).Error()},
+		{"length mismatch", golden[:len(golden)-1], fmt.Sprint("frame length mismatch, header ", len(golden)-codec.FrameHeaderLen, " got ", len(golden)-codec.FrameHeaderLen-1)},
+		{"checksum", corrupted, codec.ErrFrameChecksum.Error()},
+		{"unknown flags", newFrame(t, codec.FrameVersion, 0x80, []byte("{}")), "unknown frame flags 0x80"},
+		{"not gzip", newFrame(t, codec.FrameVersion, codec.FlagCompressed, []byte("{}")), "decompress frame fail unexpected EOF"},
+		{"decompressed too large", newFrame(t, codec.FrameVersion, codec.FlagCompressed, gzipped(t, codec.MaxPayload+1)), codec.ErrFrameTooLarge.Error()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := codec.ReadFrame(test.data)
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("got %v want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestReadFrameVersionError(t *testing.T) {
+	_, err := codec.ReadFrame(newFrame(t, codec.FrameVersion+1, 0, []byte("{}")))
+	vErr, ok := err.(*codec.VersionError)
+	if !ok {
+		t.Fatalf("got %T, want *codec.VersionError", err)
+	}
+	if vErr.Version != codec.FrameVersion+1 {
+		t.Fatalf("got version %d", vErr.Version)
+	}
+}
@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"encoding/json"
+)
+
+//jsonEnvelope keeps the json wire format of the protocol
+type jsonEnvelope struct {
+	Cmd      string      `json:"cmd"`
+	Msg      string      `json:"msg"`
+	Data     interface{} `json:"data"`
+	Priority int         `json:"priority,omitempty"`
+}
+
+type jsonDecodeEnvelope struct {
+	Cmd      string          `json:"cmd"`
+	Msg      string          `json:"msg"`
+	Data     json.RawMessage `json:"data"`
+	Priority int             `json:"priority,omitempty"`
+}
+
+//JSON is the default codec, it is used by the admin client, the gateway and the registration
+type JSON struct{}
+
+func (JSON) Name() string {
+	return NameJSON
+}
+
+func (JSON) Encode(env *Envelope) ([]byte, error) {
+	return json.Marshal(jsonEnvelope{
+		Cmd:      env.Cmd,
+		Msg:      env.Msg,
+		Data:     env.Data,
+		Priority: env.Priority,
+	})
+}
+
+func (c JSON) Decode(data []byte) (*Envelope, error) {
+	var env jsonDecodeEnvelope
+	err := json.Unmarshal(data, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Cmd:      env.Cmd,
+		Msg:      env.Msg,
+		Data:     rawOf(c, env.Data),
+		Priority: env.Priority,
+	}, nil
+}
+
+func (JSON) Unmarshal(raw []byte, v interface{}) error {
+	return json.Unmarshal(raw, v)
+}
+
+//Match reports the json object, the leading white spaces are skipped
+func (JSON) Match(data []byte) bool {
+	for _, b := range data {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b == '{'
+	}
+	return false
+}
+
+//rawOf is nil for the missing data, so the absent data is not decoded
+func rawOf(c Codec, raw []byte) interface{} {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return Raw{Codec: c, Bytes: raw}
+}
@@ -0,0 +1,96 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+//msgpackEnvelope keeps the command data as the nested MessagePack bytes, so it is decoded
+//into the command type later like the json raw message
+type msgpackEnvelope struct {
+	Cmd      string `msgpack:"cmd"`
+	Msg      string `msgpack:"msg"`
+	Data     []byte `msgpack:"data,omitempty"`
+	Priority int    `msgpack:"priority,omitempty"`
+}
+
+//MsgPack encodes the envelope with MessagePack, the command types use their json field names
+type MsgPack struct{}
+
+func (MsgPack) Name() string {
+	return NameMsgPack
+}
+
+func (MsgPack) Encode(env *Envelope) ([]byte, error) {
+	var data []byte
+	if env.Data != nil {
+		var err error
+		data, err = msgpackMarshal(env.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return msgpackMarshal(msgpackEnvelope{
+		Cmd:      env.Cmd,
+		Msg:      env.Msg,
+		Data:     data,
+		Priority: env.Priority,
+	})
+}
+
+func (c MsgPack) Decode(data []byte) (*Envelope, error) {
+	var env msgpackEnvelope
+	err := msgpack.Unmarshal(data, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Cmd:      env.Cmd,
+		Msg:      env.Msg,
+		Data:     rawOf(c, msgpackNil(env.Data)),
+		Priority: env.Priority,
+	}, nil
+}
+
+//Unmarshal decodes the command data, the generic maps are map[string]interface{} like json
+func (MsgPack) Unmarshal(raw []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(raw))
+	dec.UseJSONTag(true)
+	return dec.Decode(v)
+}
+
+//Match reports the msgpack map, the envelope is always a map
+func (MsgPack) Match(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	b := data[0]
+	return (b >= 0x80 && b <= 0x8f) || b == 0xde || b == 0xdf
+}
+
+//msgpackMarshal sorts the map keys, so the same message has the same bytes
+func msgpackMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SortMapKeys(true)
+	enc.UseJSONTag(true)
+	enc.UseCompactEncoding(true)
+
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//msgpackNil drops the encoded nil, so the absent data is not decoded
+func msgpackNil(raw []byte) []byte {
+	if len(raw) == 1 && raw[0] == 0xc0 {
+		return nil
+	}
+	return raw
+}
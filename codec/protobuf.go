@@ -0,0 +1,220 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	protoFieldCmd      protowire.Number = 1
+	protoFieldMsg      protowire.Number = 2
+	protoFieldData     protowire.Number = 3
+	protoFieldPriority protowire.Number = 4
+)
+
+//envelope fields of the command messages of genggar.proto
+const (
+	ProtoFieldEvent    = 5
+	ProtoFieldRegister = 6
+	ProtoFieldAck      = 7
+)
+
+//ProtoMessage is the command type encoded as its own message of genggar.proto
+type ProtoMessage interface {
+	MarshalProto() ([]byte, error)
+	UnmarshalProto(data []byte) error
+}
+
+//protoMarshaler is the value of the command type, UnmarshalProto has the pointer receiver
+type protoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+//protoType is the command type registered as the envelope field
+type protoType struct {
+	field protowire.Number
+	new   func() ProtoMessage
+}
+
+var (
+	protoFields = make(map[protowire.Number]protoType)
+	protoTypes  = make(map[reflect.Type]protoType)
+)
+
+//RegisterProto registers the command type as the envelope field, new returns the pointer of the type
+//the command types which are not registered are json encoded in the data field
+func RegisterProto(field int, new func() ProtoMessage) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	pt := protoType{field: protowire.Number(field), new: new}
+	protoFields[pt.field] = pt
+	protoTypes[reflect.TypeOf(new()).Elem()] = pt
+}
+
+//protoTypeOf finds the registered type of the command data
+func protoTypeOf(data interface{}) (protoType, bool) {
+	typ := reflect.TypeOf(data)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+	pt, ok := protoTypes[typ]
+	return pt, ok
+}
+
+func protoFieldOf(field protowire.Number) (protoType, bool) {
+	mux.RLock()
+	defer mux.RUnlock()
+	pt, ok := protoFields[field]
+	return pt, ok
+}
+
+//Protobuf encodes the envelope as the Envelope message of genggar.proto, the registered command types
+//are their own messages and the other command data is carried as json bytes
+type Protobuf struct{}
+
+func (Protobuf) Name() string {
+	return NameProtobuf
+}
+
+func (Protobuf) Encode(env *Envelope) ([]byte, error) {
+	field, data, err := protoData(env.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	//the cmd is always written, it is the leading byte detected by Match
+	buf := make([]byte, 0, len(env.Cmd)+len(env.Msg)+len(data)+16)
+	buf = protowire.AppendTag(buf, protoFieldCmd, protowire.BytesType)
+	buf = protowire.AppendString(buf, env.Cmd)
+	if env.Msg != "" {
+		buf = protowire.AppendTag(buf, protoFieldMsg, protowire.BytesType)
+		buf = protowire.AppendString(buf, env.Msg)
+	}
+	if env.Data != nil {
+		buf = protowire.AppendTag(buf, field, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, data)
+	}
+	if env.Priority != 0 {
+		buf = protowire.AppendTag(buf, protoFieldPriority, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, protowire.EncodeZigZag(int64(env.Priority)))
+	}
+	return buf, nil
+}
+
+//protoData encodes the command data with its field, the unregistered data is json
+func protoData(data interface{}) (protowire.Number, []byte, error) {
+	if data == nil {
+		return protoFieldData, nil, nil
+	}
+
+	if msg, ok := data.(protoMarshaler); ok {
+		if pt, ok := protoTypeOf(data); ok {
+			raw, err := msg.MarshalProto()
+			if err != nil {
+				return 0, nil, errors.New(fmt.Sprint("marshall protobuf data fail ", err.Error()))
+			}
+			return pt.field, raw, nil
+		}
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return 0, nil, errors.New(fmt.Sprint("marshall protobuf data fail ", err.Error()))
+	}
+	return protoFieldData, raw, nil
+}
+
+func (c Protobuf) Decode(data []byte) (*Envelope, error) {
+	env := &Envelope{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protoError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == protoFieldCmd && typ == protowire.BytesType:
+			env.Cmd, n = protowire.ConsumeString(data)
+		case num == protoFieldMsg && typ == protowire.BytesType:
+			env.Msg, n = protowire.ConsumeString(data)
+		case num == protoFieldData && typ == protowire.BytesType:
+			var raw []byte
+			raw, n = protowire.ConsumeBytes(data)
+			env.Data = rawOf(c, raw)
+		case num == protoFieldPriority && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(data)
+			env.Priority = int(protowire.DecodeZigZag(v))
+		default:
+			if pt, ok := protoFieldOf(num); ok && typ == protowire.BytesType {
+				var raw []byte
+				raw, n = protowire.ConsumeBytes(data)
+				//the empty message is still the command data
+				env.Data = Raw{Codec: protoMessageCodec{field: pt.field}, Bytes: raw}
+				break
+			}
+
+			//unknown fields are skipped for the forward compatibility
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return nil, protoError(n)
+		}
+		data = data[n:]
+	}
+	return env, nil
+}
+
+//Unmarshal decodes the json command data of the data field
+func (Protobuf) Unmarshal(raw []byte, v interface{}) error {
+	return json.Unmarshal(raw, v)
+}
+
+//Match reports the leading cmd field
+func (Protobuf) Match(data []byte) bool {
+	return len(data) > 0 && data[0] == 0x0a
+}
+
+//protoMessageCodec decodes the command message of the envelope field
+type protoMessageCodec struct {
+	Protobuf
+	field protowire.Number
+}
+
+//Unmarshal decodes the message into its registered type, the other types such as the generic value
+//receive the json form of the message
+func (c protoMessageCodec) Unmarshal(raw []byte, v interface{}) error {
+	pt, ok := protoFieldOf(c.field)
+	if !ok {
+		return errors.New(fmt.Sprint("unregistered protobuf field ", c.field))
+	}
+
+	if msg, ok := v.(ProtoMessage); ok && reflect.TypeOf(v).Elem() == reflect.TypeOf(pt.new()).Elem() {
+		return msg.UnmarshalProto(raw)
+	}
+
+	msg := pt.new()
+	err := msg.UnmarshalProto(raw)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func protoError(n int) error {
+	return errors.New(fmt.Sprint("unmarshall protobuf fail ", protowire.ParseError(n).Error()))
+}
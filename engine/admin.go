@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+//AdminClient queries the running server, it does not register as a subscriber
+type AdminClient struct {
+	Conn    net.Conn
+	Token   string
+	MsgBuff []byte
+}
+
+//List gets the topics and subscribers of the server
+func (a *AdminClient) List(ctx context.Context) (*ListResult, error) {
+	var result ListResult
+	err := a.call(ctx, CmdList, AdminMessage{Token: a.Token}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+	return &result, nil
+}
+
+//Pause holds the dispatch to the subscriber, the events are still buffered until it is resumed
+func (a *AdminClient) Pause(ctx context.Context, subscriber string) error {
+	return a.command(ctx, CmdPause, subscriber)
+}
+
+//Resume continues the dispatch to the paused subscriber
+func (a *AdminClient) Resume(ctx context.Context, subscriber string) error {
+	return a.command(ctx, CmdResume, subscriber)
+}
+
+//Close closes the connection to the server
+func (a *AdminClient) Close() error {
+	return a.Conn.Close()
+}
+
+func (a *AdminClient) command(ctx context.Context, cmd, subscriber string) error {
+	var result AdminResult
+	err := a.call(ctx, cmd, AdminMessage{Token: a.Token, Subscriber: subscriber}, &result)
+	if err != nil {
+		return err
+	}
+
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+//call sends the command and waits for the server answer of the same command
+//ctx without deadline is bounded by DefaultRequestTimeout
+func (a *AdminClient) call(ctx context.Context, cmd string, data interface{}, result interface{}) error {
+	if a.Conn == nil {
+		return errors.New("connection closed")
+	}
+
+	msg, err := json.Marshal(Message{
+		Cmd:  cmd,
+		Msg:  "admin command",
+		Data: data,
+	})
+	if err != nil {
+		return errors.New(fmt.Sprint("marshall error", err.Error()))
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultRequestTimeout)
+	}
+	a.Conn.SetDeadline(deadline)
+	defer a.Conn.SetDeadline(time.Time{})
+
+	_, err = a.Conn.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := a.Conn.Read(a.MsgBuff)
+		if err != nil {
+			return err
+		}
+
+		var resp Message
+		err = json.Unmarshal(a.MsgBuff[:n], &resp)
+		if err != nil || resp.Cmd != cmd {
+			//not the answer, keep waiting until the deadline
+			continue
+		}
+
+		return remarshal(resp.Data, result)
+	}
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/syariatifaris/genggar/eventstore"
+)
+
+//slowStore holds the first scan until it is released, like the long read of the event log
+type slowStore struct {
+	*eventstore.MemoryStore
+	once     sync.Once
+	scanning chan bool
+	release  chan bool
+}
+
+func (s *slowStore) Scan(fromSeq uint64, fn func(rec *eventstore.Record) bool) error {
+	s.once.Do(func() {
+		close(s.scanning)
+		<-s.release
+	})
+	return s.MemoryStore.Scan(fromSeq, fn)
+}
+
+//TestCatchUpDoesNotHoldPublishing checks the lagging subscriber receives every stored event in order,
+//while the other publishers keep publishing during its scan
+func TestCatchUpDoesNotHoldPublishing(t *testing.T) {
+	store := &slowStore{
+		MemoryStore: eventstore.NewMemoryStore(),
+		scanning:    make(chan bool),
+		release:     make(chan bool),
+	}
+
+	s := newTestServer(t)
+	defer s.ServerConn.Close()
+	s.EventStore = store
+	s.SubscriberBuffer = 2
+
+	addr := addTestSubscriber(t, s, "ORDER")
+	sb, err := s.getSubscriber(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb.SetLagging(1)
+	for i := 0; i < 5; i++ {
+		err := s.PublishEvent("ORDER", "NEW_ORDER", "stored")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan bool)
+	go func() {
+		s.catchUp(sb)
+		close(done)
+	}()
+	<-store.scanning
+
+	published := make(chan error, 1)
+	go func() {
+		published <- s.PublishEvent("PAYMENT", "PAID", "other topic")
+	}()
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publishing is held by the catch up")
+	}
+
+	//the event of the topic published during the scan is caught up as well
+	err = s.PublishEvent("ORDER", "NEW_ORDER", "during scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(store.release)
+	<-done
+
+	var seqs []uint64
+	for i := 0; i < 10; i++ {
+		for sb.GetBufferLen() > 0 {
+			data, err := sb.PopFront()
+			if err != nil {
+				t.Fatal(err)
+			}
+			seqs = append(seqs, data.(Message).Data.(EventMessage).Seq)
+		}
+
+		if lagging, _ := sb.GetLagging(); !lagging {
+			break
+		}
+		s.catchUp(sb)
+	}
+
+	//the caught up subscriber receives the new event from the publisher
+	err = s.PublishEvent("ORDER", "NEW_ORDER", "after catch up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := sb.PopFront()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs = append(seqs, data.(Message).Data.(EventMessage).Seq)
+
+	want := []uint64{1, 2, 3, 4, 5, 7, 8}
+	if len(seqs) != len(want) {
+		t.Fatalf("got %v want %v", seqs, want)
+	}
+	for i := range want {
+		if seqs[i] != want[i] {
+			t.Fatalf("got %v want %v", seqs, want)
+		}
+	}
+}
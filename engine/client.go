@@ -2,25 +2,49 @@ package engine
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 
-	"github.com/syariatifaris/genggar/glog"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/metrics"
+	"github.com/syariatifaris/genggar/tracing"
 )
 
 type EventFunc func(topic, eventName string, data interface{}) error
 
+//EventContextFunc is EventFunc receiving the context of the processor span, the trace continues
+//when the callback publishes with PublishContext
+type EventContextFunc func(ctx context.Context, topic, eventName string, data interface{}) error
+
+//ReplyFunc handles request event payload and returns the response for the requester
+type ReplyFunc func(topic, eventName string, payload interface{}) (interface{}, error)
+
 type EventProcessor struct {
-	Events   []string
-	Callback EventFunc
+	Events          []string
+	Callback        EventFunc
+	ContextCallback EventContextFunc
+	Reply           ReplyFunc
 }
 
 type Client interface {
-	StartListen(stopChan <-chan bool)
+	StartListen(stopChan <-chan bool) error
+	PublishEvent(topic, event, message string) error
+	PublishFrom(ctx context.Context, cause *EventMessage, topic, event, message string) error
+	PublishContext(ctx context.Context, topic, event, message string) error
 	getEventProcessors() []*EventProcessor
 	getTopic() string
+	sendData(msg []byte) error
+	encode(message Message) ([]byte, error)
+	getVersion() uint8
+	downgrade(version uint8) error
+	getMetrics() metrics.Metrics
+	getTracer() tracing.Tracer
+	getLogger() logger.Logger
 }
 
 type ClientImpl struct {
@@ -31,8 +55,25 @@ type ClientImpl struct {
 	ServerAddr string
 	ClientConn net.Conn
 	Processors []*EventProcessor
-
-	isStarted bool
+	//Token is sent on registration when the server requires authentication
+	Token string
+	//FromSeq replays the stored events of the topic from the sequence before the new events
+	FromSeq uint64
+	//Metrics receives the client measurements, nothing is measured when it is not set
+	Metrics metrics.Metrics
+	//Tracer starts the span of every event processor, nothing is traced when it is not set
+	Tracer tracing.Tracer
+	//Logger receives the client logs, logger.Glog is used when it is not set
+	Logger logger.Logger
+	//Codec is the wire codec negotiated on registration, json is used when it is not set
+	Codec string
+	//Version is the frame version of the messages, 0 sends the unframed legacy format
+	//the server may downgrade it on registration
+	Version uint8
+
+	versionMux sync.RWMutex
+
+	isStarted int32
 }
 
 func (c *ClientImpl) getEventProcessors() []*EventProcessor {
@@ -43,15 +84,22 @@ func (c *ClientImpl) getTopic() string {
 	return c.Topic
 }
 
-func (c *ClientImpl) StartListen(stopChan <-chan bool) {
-	c.isStarted = true
+//StartListen registers the topic and processes the server messages until stopChan receives,
+//the registration failure is returned without listening
+func (c *ClientImpl) StartListen(stopChan <-chan bool) error {
+	err := c.registerTopic(c.Topic)
+	if err != nil {
+		return errors.New(fmt.Sprint("subscribe err ", err.Error()))
+	}
+
+	atomic.StoreInt32(&c.isStarted, 1)
 	clientChan := make(chan bool)
 
 	go func(stopListen <-chan bool) {
 		for {
 			select {
 			case <-stopListen:
-				c.isStarted = false
+				atomic.StoreInt32(&c.isStarted, 0)
 				c.ClientConn.Close()
 				clientChan <- true
 				return
@@ -61,41 +109,35 @@ func (c *ClientImpl) StartListen(stopChan <-chan bool) {
 		}
 	}(stopChan)
 
-	err := c.registerTopic(c.Topic)
-	if err != nil {
-		glog.ERROR.Fatalln("subscribe err", err.Error())
-		return
-	}
-
 	for {
 		select {
 		case <-clientChan:
-			return
+			return nil
 		default:
 			n, err := bufio.NewReader(c.ClientConn).Read(c.MsgBuff)
 			if err != nil {
-				if !c.isStarted {
-					return
+				if atomic.LoadInt32(&c.isStarted) == 0 {
+					return nil
 				}
 
-				glog.DEBUG.Println("server read error", err.Error())
+				c.getLogger().Debug("server read error", "error", err)
 				continue
 			}
 
-			glog.DEBUG.Println("[server says]:", string(c.MsgBuff[0:n]))
+			c.getLogger().Debug("server says", "msg", string(c.MsgBuff[0:n]))
 			processor, err := getProcessor(&property{
 				msg:    c.MsgBuff[0:n],
 				client: c,
 			})
 
 			if err != nil {
-				glog.DEBUG.Println("unable to resolve process", err.Error())
+				c.getLogger().Debug("unable to resolve process", "error", err)
 				continue
 			}
 
 			err = processor.exec()
 			if err != nil {
-				glog.DEBUG.Println("unable to exec process", err.Error())
+				c.getLogger().Debug("unable to exec process", "error", err)
 				continue
 			}
 		}
@@ -111,7 +153,10 @@ func (c *ClientImpl) registerTopic(topic string) error {
 		Msg: "client do registration",
 		Cmd: CmdReg,
 		Data: RegisterMessage{
-			Topic: topic,
+			Topic:   topic,
+			Token:   c.Token,
+			FromSeq: c.FromSeq,
+			Codec:   c.Codec,
 		},
 	}
 
@@ -120,11 +165,83 @@ func (c *ClientImpl) registerTopic(topic string) error {
 		return errors.New(fmt.Sprint("marshall error", err.Error()))
 	}
 
-	glog.DEBUG.Println("sending command", string(msg))
-	_, err = fmt.Fprintf(c.ClientConn, string(msg))
+	//the registration is json in the frame of the client version
+	msg, err = frameMessage(c.getVersion(), CmdReg, msg)
+	if err != nil {
+		return err
+	}
+
+	c.getLogger().Debug("sending command", "msg", string(msg))
+	_, err = c.ClientConn.Write(msg)
 	if err != nil {
 		return errors.New(fmt.Sprint("command err", err.Error()))
 	}
 
 	return nil
 }
+
+//PublishEvent publishes event through the server, the event starts a new correlation
+func (c *ClientImpl) PublishEvent(topic, event, message string) error {
+	return c.PublishFrom(context.Background(), nil, topic, event, message)
+}
+
+//PublishFrom publishes event caused by the received event, it keeps the correlation id of the cause
+//ctx is the context of the ContextCallback, so the event is the child of the processor span,
+//the trace context of the cause is used when ctx is not traced
+func (c *ClientImpl) PublishFrom(ctx context.Context, cause *EventMessage, topic, event, message string) error {
+	pMsg := PublishMessage{
+		Topic:        topic,
+		Event:        event,
+		Token:        c.Token,
+		TraceContext: injectTrace(c.getTracer(), ctx),
+	}
+
+	if cause != nil {
+		pMsg.CorrelationID = cause.CorrelationID
+		if pMsg.CorrelationID == "" {
+			pMsg.CorrelationID = cause.UUID
+		}
+		pMsg.CausationID = cause.UUID
+		if pMsg.TraceContext == nil {
+			pMsg.TraceContext = cause.TraceContext
+		}
+	}
+
+	return c.publish(pMsg, message)
+}
+
+//PublishContext publishes event through the server carrying the trace context of ctx
+func (c *ClientImpl) PublishContext(ctx context.Context, topic, event, message string) error {
+	return c.publish(PublishMessage{
+		Topic:        topic,
+		Event:        event,
+		Token:        c.Token,
+		TraceContext: injectTrace(c.getTracer(), ctx),
+	}, message)
+}
+
+func (c *ClientImpl) publish(pMsg PublishMessage, message string) error {
+	msg, err := c.encode(Message{
+		Cmd:  CmdPublish,
+		Msg:  message,
+		Data: pMsg,
+	})
+	if err != nil {
+		return errors.New(fmt.Sprint("marshall error", err.Error()))
+	}
+
+	return c.sendData(msg)
+}
+
+//sendData sends the data to the server through the connection of the client
+func (c *ClientImpl) sendData(msg []byte) error {
+	if c.ClientConn == nil {
+		return errors.New("connection closed")
+	}
+
+	_, err := c.ClientConn.Write(msg)
+	if err != nil {
+		c.getMetrics().Add(metrics.ClientSendErrors, 1, metrics.L("topic", c.Topic))
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/syariatifaris/genggar/logger"
+)
+
+func TestStartListenRegistrationError(t *testing.T) {
+	client := &ClientImpl{
+		Proto:  ProtoUDP,
+		Topic:  "ORDER",
+		Logger: logger.Nop{},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.StartListen(make(chan bool))
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("registration without connection should fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("StartListen does not return the registration error")
+	}
+}
+
+func TestStartListenStop(t *testing.T) {
+	client, _ := newTraceClient(t, nil)
+	client.MsgBuff = make([]byte, MaxBuffer)
+
+	stopChan := make(chan bool)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.StartListen(stopChan)
+	}()
+
+	stopChan <- true
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("StartListen is not stopped")
+	}
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/subscriber"
+)
+
+//decodeMessage reads the message with the codec detected from the data, the version is of the frame
+//the message data is kept as codec.Raw until it is decoded into the command type
+func decodeMessage(data []byte) (*Message, uint8, error) {
+	payload, version, cmd, err := unframe(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	env, err := codec.DecodeAny(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version > 0 && env.Cmd != cmd {
+		return nil, 0, errors.New(fmt.Sprint("frame command ", cmd, " does not match ", env.Cmd))
+	}
+
+	return &Message{
+		Cmd:      env.Cmd,
+		Msg:      env.Msg,
+		Data:     env.Data,
+		Priority: subscriber.Priority(env.Priority),
+	}, version, nil
+}
+
+//encodeMessage writes the buffered data with the codec in the frame of the version
+//the spilled data is json encoded message
+func encodeMessage(c codec.Codec, version uint8, data interface{}) ([]byte, error) {
+	if raw, ok := data.(json.RawMessage); ok && c.Name() == codec.NameJSON && version == 0 {
+		return raw, nil
+	}
+
+	message, err := toMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := c.Encode(&codec.Envelope{
+		Cmd:      message.Cmd,
+		Msg:      message.Msg,
+		Data:     message.Data,
+		Priority: int(message.Priority),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return frameMessage(version, message.Cmd, payload)
+}
+
+//toMessage gets the message of the buffered data
+func toMessage(data interface{}) (Message, error) {
+	switch msg := data.(type) {
+	case Message:
+		return msg, nil
+	case *Message:
+		return *msg, nil
+	case json.RawMessage:
+		var message Message
+		err := json.Unmarshal(msg, &message)
+		if err != nil || message.Cmd != CmdEvent {
+			return message, err
+		}
+
+		//the spilled event is typed again, so the codec encodes it like the event in memory
+		var evt EventMessage
+		err = remarshal(message.Data, &evt)
+		message.Data = evt
+		return message, err
+	}
+	return Message{}, errors.New(fmt.Sprintf("buffered data is not a message, got %T", data))
+}
+
+//plain converts the undecoded data into the generic value, it is passed to the event callbacks
+func plain(data interface{}) interface{} {
+	raw, ok := data.(codec.Raw)
+	if !ok {
+		return data
+	}
+
+	v, err := raw.Value()
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+//getCodec returns the codec of the client, json is used when it is not set
+func (c *ClientImpl) getCodec() codec.Codec {
+	cd, err := codec.Get(c.Codec)
+	if err != nil {
+		return codec.JSON{}
+	}
+	return cd
+}
+
+//encode writes the message with the client codec and frame version
+func (c *ClientImpl) encode(message Message) ([]byte, error) {
+	return encodeMessage(c.getCodec(), c.getVersion(), message)
+}
+
+//getCodec returns the codec negotiated by the subscriber
+func (s *ServerImpl) getCodec(sb subscriber.Client) codec.Codec {
+	cd, err := codec.Get(sb.GetCodec())
+	if err != nil {
+		return codec.JSON{}
+	}
+	return cd
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/syariatifaris/genggar/codec"
+)
+
+//msgDowngrade is the info of the server asking the client to register again with the version of the frame
+const msgDowngrade = "protocol downgrade"
+
+//commandCodes are the command codes of the frame header, a code must never be reused for another command
+var commandCodes = map[string]uint8{
+	CmdReg:     1,
+	CmdInfo:    2,
+	CmdRetry:   3,
+	CmdEvent:   4,
+	CmdReply:   5,
+	CmdPublish: 6,
+	CmdAck:     7,
+	CmdList:    8,
+	CmdPause:   9,
+	CmdResume:  10,
+}
+
+//CommandCode returns the frame header code of the command
+func CommandCode(cmd string) (uint8, bool) {
+	code, ok := commandCodes[cmd]
+	return code, ok
+}
+
+func commandName(code uint8) (string, bool) {
+	for name, c := range commandCodes {
+		if c == code {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+//frameMessage puts the frame header in front of the encoded message, version 0 is the unframed legacy format
+func frameMessage(version uint8, cmd string, payload []byte) ([]byte, error) {
+	if version == 0 {
+		return payload, nil
+	}
+
+	code, ok := CommandCode(cmd)
+	if !ok {
+		return nil, errors.New(fmt.Sprint("command ", cmd, " has no frame code"))
+	}
+	return codec.WriteFrame(version, code, payload)
+}
+
+//unframe returns the payload and the version of the frame, the unframed data is version 0
+//the command of the header is checked against the command of the payload
+func unframe(data []byte) ([]byte, uint8, string, error) {
+	if !codec.IsFrame(data) {
+		return data, 0, "", nil
+	}
+
+	frame, err := codec.ReadFrame(data)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	cmd, ok := commandName(frame.Command)
+	if !ok {
+		return nil, 0, "", errors.New(fmt.Sprint("unknown frame command ", frame.Command))
+	}
+	return frame.Payload, frame.Version, cmd, nil
+}
+
+//sendInfo sends the info message to the address, framed with the version
+func (s *ServerImpl) sendInfo(msg string, version uint8, addr *net.UDPAddr) error {
+	data, err := json.Marshal(Message{
+		Cmd: CmdInfo,
+		Msg: msg,
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err = frameMessage(version, CmdInfo, data)
+	if err != nil {
+		return err
+	}
+	return s.sendData(data, addr)
+}
+
+//getVersion returns the frame version of the client, it is lowered by the server downgrade
+func (c *ClientImpl) getVersion() uint8 {
+	c.versionMux.RLock()
+	defer c.versionMux.RUnlock()
+	return c.Version
+}
+
+//downgrade registers again with the frame version of the server
+func (c *ClientImpl) downgrade(version uint8) error {
+	if !codec.SupportedVersion(version) {
+		return &codec.VersionError{Version: version}
+	}
+
+	c.versionMux.Lock()
+	if version >= c.Version {
+		c.versionMux.Unlock()
+		return nil
+	}
+	c.Version = version
+	c.versionMux.Unlock()
+
+	c.getLogger().Info("protocol downgraded", "version", version)
+	return c.registerTopic(c.Topic)
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/syariatifaris/genggar/codec"
+)
+
+//TestCommandCodes pins the command codes of the frame header, a code must never be reused for another command
+func TestCommandCodes(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		code uint8
+	}{
+		{CmdReg, 1},
+		{CmdInfo, 2},
+		{CmdRetry, 3},
+		{CmdEvent, 4},
+		{CmdReply, 5},
+		{CmdPublish, 6},
+		{CmdAck, 7},
+		{CmdList, 8},
+		{CmdPause, 9},
+		{CmdResume, 10},
+	}
+
+	if len(commandCodes) != len(tests) {
+		t.Fatalf("got %d command codes want %d", len(commandCodes), len(tests))
+	}
+
+	for _, test := range tests {
+		code, ok := CommandCode(test.cmd)
+		if !ok || code != test.code {
+			t.Fatalf("command %s got code %d want %d", test.cmd, code, test.code)
+		}
+
+		name, ok := commandName(test.code)
+		if !ok || name != test.cmd {
+			t.Fatalf("code %d got command %s want %s", test.code, name, test.cmd)
+		}
+	}
+}
+
+func TestUnframe(t *testing.T) {
+	payload, err := json.Marshal(Message{Cmd: CmdEvent, Msg: "order verified"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		version uint8
+		cmd     string
+	}{
+		{"legacy", 0, ""},
+		{"version 1", 1, CmdEvent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := frameMessage(test.version, CmdEvent, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, version, cmd, err := unframe(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, payload) || version != test.version || cmd != test.cmd {
+				t.Fatalf("got %s version %d command %s", got, version, cmd)
+			}
+		})
+	}
+}
+
+func TestDecodeMessageErrors(t *testing.T) {
+	payload, err := json.Marshal(Message{Cmd: CmdEvent})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknownCode, err := codec.WriteFrame(codec.FrameVersion, 99, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCmd, err := frameMessage(codec.FrameVersion, CmdAck, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := append([]byte(nil), otherCmd...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"unknown command code", unknownCode, "unknown frame command 99"},
+		{"command mismatch", otherCmd, "frame command [ACK] does not match [EVT]"},
+		{"checksum", corrupted, codec.ErrFrameChecksum.Error()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := decodeMessage(test.data)
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("got %v want %s", err, test.err)
+			}
+		})
+	}
+
+	_, err = frameMessage(codec.FrameVersion, "[NOP]", payload)
+	if err == nil {
+		t.Fatal("command without code is framed")
+	}
+}
+
+//TestFutureVersion checks the server answers the frame of a newer version instead of dropping it
+func TestFutureVersion(t *testing.T) {
+	data, err := codec.WriteFrame(codec.FrameVersion, 1, []byte(`{"cmd":"[REG]"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the header of the newer version is not read, only its version
+	data[2] = codec.FrameVersion + 1
+
+	_, _, err = decodeMessage(data)
+	if _, ok := err.(*codec.VersionError); !ok {
+		t.Fatalf("got %v, want *codec.VersionError", err)
+	}
+
+	p, err := getProcessor(&property{msg: data, server: newTestServer(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, ok := p.(*versionProcessor)
+	if !ok {
+		t.Fatalf("got %T, want *versionProcessor", p)
+	}
+	if vp.version != codec.FrameVersion+1 {
+		t.Fatalf("got version %d", vp.version)
+	}
+}
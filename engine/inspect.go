@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+//topicCounter counts the events of the topic, it is updated atomically
+type topicCounter struct {
+	published uint64
+	delivered uint64
+	rejected  uint64
+	dropped   uint64
+	processed uint64
+	failed    uint64
+
+	retried      uint64
+	deadLettered uint64
+}
+
+//Inspect gets the topics with their counters and the subscribers state, ordered by name
+func (s *ServerImpl) Inspect() *ListResult {
+	result := &ListResult{
+		Topics:      []TopicInfo{},
+		Subscribers: []SubscriberInfo{},
+	}
+
+	topics := make(map[string]*TopicInfo)
+	getTopic := func(name string) *TopicInfo {
+		info, ok := topics[name]
+		if !ok {
+			info = &TopicInfo{Name: name}
+			topics[name] = info
+		}
+		return info
+	}
+
+	s.counterMux.Lock()
+	for name, counter := range s.counters {
+		info := getTopic(name)
+		info.Published = atomic.LoadUint64(&counter.published)
+		info.Delivered = atomic.LoadUint64(&counter.delivered)
+		info.Rejected = atomic.LoadUint64(&counter.rejected)
+		info.Dropped = atomic.LoadUint64(&counter.dropped)
+		info.Processed = atomic.LoadUint64(&counter.processed)
+		info.Failed = atomic.LoadUint64(&counter.failed)
+		info.Retried = atomic.LoadUint64(&counter.retried)
+		info.DeadLettered = atomic.LoadUint64(&counter.deadLettered)
+	}
+	s.counterMux.Unlock()
+
+	for name, sub := range s.Subscribers.Snapshot() {
+		lagging, _ := sub.GetLagging()
+		dropped := sub.GetDropped()
+		addr := sub.GetUDPAddr().String()
+		if sink := s.getSink(name); sink != nil {
+			addr = sink.Address()
+		}
+
+		result.Subscribers = append(result.Subscribers, SubscriberInfo{
+			Name:        name,
+			Address:     addr,
+			Topic:       sub.GetTopicName(),
+			BufferLen:   sub.GetBufferLen(),
+			Dispatching: sub.IsDispatched(),
+			Paused:      sub.IsPaused(),
+			Lagging:     lagging,
+			Dropped:     dropped,
+			LastSeen:    sub.GetLastSeen(),
+		})
+
+		info := getTopic(sub.GetTopicName())
+		info.Subscribers++
+		info.Dropped += dropped
+	}
+
+	for _, info := range topics {
+		result.Topics = append(result.Topics, *info)
+	}
+
+	sort.Slice(result.Topics, func(i, j int) bool {
+		return result.Topics[i].Name < result.Topics[j].Name
+	})
+	sort.Slice(result.Subscribers, func(i, j int) bool {
+		return result.Subscribers[i].Name < result.Subscribers[j].Name
+	})
+	return result
+}
+
+//PauseSubscriber holds the dispatch to the subscriber, the events are still buffered
+//and handled by the overflow policy when the buffer is full
+func (s *ServerImpl) PauseSubscriber(name string) error {
+	sub, err := s.getSubscriber(name)
+	if err != nil {
+		return err
+	}
+
+	sub.SetPaused(true)
+	return nil
+}
+
+//ResumeSubscriber continues the dispatch to the paused subscriber
+func (s *ServerImpl) ResumeSubscriber(name string) error {
+	sub, err := s.getSubscriber(name)
+	if err != nil {
+		return err
+	}
+
+	sub.SetPaused(false)
+	return nil
+}
+
+//counter gets the counter of the topic, it is created on the first use
+func (s *ServerImpl) counter(topic string) *topicCounter {
+	s.counterMux.Lock()
+	defer s.counterMux.Unlock()
+
+	if s.counters == nil {
+		s.counters = make(map[string]*topicCounter)
+	}
+
+	counter, ok := s.counters[topic]
+	if !ok {
+		counter = &topicCounter{}
+		s.counters[topic] = counter
+	}
+	return counter
+}
@@ -0,0 +1,20 @@
+package engine
+
+import (
+	"github.com/syariatifaris/genggar/logger"
+)
+
+//getLogger returns the configured logger, the logs are written with glog when it is not set
+func (s *ServerImpl) getLogger() logger.Logger {
+	if s.Logger == nil {
+		return logger.Glog{}
+	}
+	return s.Logger
+}
+
+func (c *ClientImpl) getLogger() logger.Logger {
+	if c.Logger == nil {
+		return logger.Glog{}
+	}
+	return c.Logger
+}
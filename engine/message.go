@@ -1,16 +1,157 @@
 package engine
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/subscriber"
+	"github.com/syariatifaris/genggar/tracing"
+)
+
+//FanOutError is returned when the published event is rejected by some subscribers of the topic,
+//the event is recorded and delivered to the other subscribers, Delivered is 0 when every subscriber rejected it
+type FanOutError struct {
+	Topic       string
+	Subscribers []string
+	Delivered   int
+}
+
+func (e *FanOutError) Error() string {
+	return fmt.Sprint("unable to push data to buffer of ", strings.Join(e.Subscribers, ","))
+}
+
 type Message struct {
-	Cmd  string      `json:"cmd"`
-	Msg  string      `json:"msg"`
-	Data interface{} `json:"data"`
+	Cmd      string              `json:"cmd"`
+	Msg      string              `json:"msg"`
+	Data     interface{}         `json:"data"`
+	Priority subscriber.Priority `json:"priority,omitempty"`
+}
+
+//GetPriority gets the message priority in the subscriber buffer
+func (m Message) GetPriority() subscriber.Priority {
+	return m.Priority
 }
 
+//RegisterMessage subscribes to the topic, FromSeq replays the stored events from the sequence first
+//Codec is the wire codec of the messages after the registration, the registration itself is json
 type RegisterMessage struct {
-	Topic string `json:"topic"`
+	Topic   string `json:"topic"`
+	Token   string `json:"token,omitempty"`
+	FromSeq uint64 `json:"from_seq,omitempty"`
+	Codec   string `json:"codec,omitempty"`
 }
 
+//EventMessage is the event delivered to the subscriber, Seq is the event store sequence when the server has one
+//TraceContext is the w3c trace context of the publisher
+//ReplyTo marks the request event, the reply is sent back to the server the subscriber is connected to
 type EventMessage struct {
-	Event string `json:"event"`
-	UUID  string `json:"uuid"`
+	Event         string          `json:"event"`
+	UUID          string          `json:"uuid"`
+	Seq           uint64          `json:"seq,omitempty"`
+	Message       string          `json:"message,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	CausationID   string          `json:"causation_id,omitempty"`
+	ReplyTo       string          `json:"reply_to,omitempty"`
+	Payload       interface{}     `json:"payload,omitempty"`
+	TraceContext  tracing.Headers `json:"trace_context,omitempty"`
+}
+
+type ReplyMessage struct {
+	RequestID     string      `json:"request_id"`
+	CorrelationID string      `json:"correlation_id,omitempty"`
+	Event         string      `json:"event"`
+	Data          interface{} `json:"data,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	Token         string      `json:"token,omitempty"`
+}
+
+type PublishMessage struct {
+	Topic         string          `json:"topic"`
+	Event         string          `json:"event"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	CausationID   string          `json:"causation_id,omitempty"`
+	Token         string          `json:"token,omitempty"`
+	TraceContext  tracing.Headers `json:"trace_context,omitempty"`
+}
+
+type AckMessage struct {
+	UUID          string `json:"uuid"`
+	Topic         string `json:"topic,omitempty"`
+	Event         string `json:"event"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+//AdminMessage is the admin command, Subscriber is the target of pause and resume
+type AdminMessage struct {
+	Token      string `json:"token,omitempty"`
+	Subscriber string `json:"subscriber,omitempty"`
+}
+
+//AdminResult is the server answer of pause and resume
+type AdminResult struct {
+	Error string `json:"error,omitempty"`
+}
+
+//ListResult is the server answer of list command
+type ListResult struct {
+	Topics      []TopicInfo      `json:"topics"`
+	Subscribers []SubscriberInfo `json:"subscribers"`
+	Error       string           `json:"error,omitempty"`
+}
+
+//TopicInfo is the topic state, the counters are counted since the server started
+//Rejected is the events which could not be buffered, Dropped is the events dropped by the overflow policy,
+//Retried is the failed sends which are sent again, DeadLettered is the events given up after the retries
+type TopicInfo struct {
+	Name         string `json:"name"`
+	Subscribers  int    `json:"subscribers"`
+	Published    uint64 `json:"published"`
+	Delivered    uint64 `json:"delivered"`
+	Rejected     uint64 `json:"rejected"`
+	Dropped      uint64 `json:"dropped"`
+	Processed    uint64 `json:"processed"`
+	Failed       uint64 `json:"failed"`
+	Retried      uint64 `json:"retried"`
+	DeadLettered uint64 `json:"dead_lettered"`
+}
+
+//SubscriberInfo is the subscriber state, LastSeen is the last message received from the subscriber
+type SubscriberInfo struct {
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	Topic       string    `json:"topic"`
+	BufferLen   int       `json:"buffer_len"`
+	Dispatching bool      `json:"dispatching"`
+	Paused      bool      `json:"paused"`
+	Lagging     bool      `json:"lagging"`
+	Dropped     uint64    `json:"dropped"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+//ParseEvent reads the event message from the data received by EventFunc
+func ParseEvent(data interface{}) (*EventMessage, error) {
+	var eMsg EventMessage
+	err := remarshal(data, &eMsg)
+	if err != nil {
+		return nil, err
+	}
+	return &eMsg, nil
+}
+
+//remarshal converts the decoded generic data into the given message type
+//the undecoded data of the codec is decoded directly
+func remarshal(data interface{}, v interface{}) error {
+	if raw, ok := data.(codec.Raw); ok {
+		return raw.Decode(v)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
 }
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/syariatifaris/genggar/metrics"
+	"github.com/syariatifaris/genggar/subscriber"
+)
+
+//getMetrics returns the configured metrics, the measurements are discarded when it is not set
+func (s *ServerImpl) getMetrics() metrics.Metrics {
+	if s.Metrics == nil {
+		return metrics.Nop{}
+	}
+	return s.Metrics
+}
+
+//measureBuffer sets the buffer depth gauge of the subscriber, the removed subscriber is not measured
+func (s *ServerImpl) measureBuffer(sb subscriber.Client) {
+	if cur, ok := s.Subscribers.Get(sb.GetName()); !ok || cur != sb {
+		return
+	}
+
+	s.getMetrics().Set(metrics.SubscriberBuffer, float64(sb.GetBufferLen()),
+		metrics.L("topic", sb.GetTopicName()), metrics.L("subscriber", sb.GetName()))
+}
+
+//forgetBuffer deletes the buffer depth gauge of the removed subscriber, so the ephemeral sinks do not leak series
+func (s *ServerImpl) forgetBuffer(sb subscriber.Client) {
+	s.getMetrics().Delete(metrics.SubscriberBuffer,
+		metrics.L("topic", sb.GetTopicName()), metrics.L("subscriber", sb.GetName()))
+}
+
+func (c *ClientImpl) getMetrics() metrics.Metrics {
+	if c.Metrics == nil {
+		return metrics.Nop{}
+	}
+	return c.Metrics
+}
+
+//since returns the elapsed seconds, it is the histogram unit
+func since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -1,29 +1,43 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
-	"github.com/syariatifaris/genggar/glog"
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/metrics"
 	"github.com/syariatifaris/genggar/subscriber"
 	"github.com/syariatifaris/genggar/util"
 )
 
 const (
-	CmdReg   = "[REG]"
-	CmdInfo  = "[INF]"
-	CmdRetry = "[RET]"
-	CmdEvent = "[EVT]"
+	CmdReg     = "[REG]"
+	CmdInfo    = "[INF]"
+	CmdRetry   = "[RET]"
+	CmdEvent   = "[EVT]"
+	CmdReply   = "[RPL]"
+	CmdPublish = "[PUB]"
+	CmdAck     = "[ACK]"
+	CmdList    = "[LST]"
+	CmdPause   = "[PAU]"
+	CmdResume  = "[RSM]"
+
+	//AllEvents matches every event of the topic in EventProcessor.Events
+	AllEvents = "*"
 )
 
 type property struct {
-	msg    []byte
-	data   interface{}
-	addr   *net.UDPAddr
-	server Server
-	client Client
+	msg     []byte
+	msgText string
+	version uint8
+	data    interface{}
+	addr    *net.UDPAddr
+	server  Server
+	client  Client
 }
 
 type processor interface {
@@ -31,14 +45,25 @@ type processor interface {
 }
 
 func getProcessor(prop *property) (processor, error) {
-	var message Message
-	err := json.Unmarshal(prop.msg, &message)
+	message, version, err := decodeMessage(prop.msg)
+	if vErr, ok := err.(*codec.VersionError); ok && prop.server != nil {
+		return &versionProcessor{
+			prop:    prop,
+			version: vErr.Version,
+		}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	prop.data = message.Data
+	prop.msgText = message.Msg
+	prop.version = version
 
 	switch message.Cmd {
+	case CmdInfo:
+		return &infoProcessor{
+			prop: prop,
+		}, nil
 	case CmdReg:
 		return &registerProcessor{
 			prop: prop,
@@ -47,6 +72,23 @@ func getProcessor(prop *property) (processor, error) {
 		return &eventProcessor{
 			prop: prop,
 		}, nil
+	case CmdReply:
+		return &replyProcessor{
+			prop: prop,
+		}, nil
+	case CmdPublish:
+		return &publishProcessor{
+			prop: prop,
+		}, nil
+	case CmdAck:
+		return &ackProcessor{
+			prop: prop,
+		}, nil
+	case CmdList, CmdPause, CmdResume:
+		return &adminProcessor{
+			prop: prop,
+			cmd:  message.Cmd,
+		}, nil
 	}
 	return nil, errors.New("undefined processor")
 }
@@ -57,19 +99,14 @@ type registerProcessor struct {
 	prop *property
 }
 
-func (r *registerProcessor) getSubscribedTopic() (string, error) {
+func (r *registerProcessor) getRegistration() (*RegisterMessage, error) {
 	var rMsg RegisterMessage
-	data, err := json.Marshal(r.prop.data)
-	if err != nil {
-		return "", errors.New(fmt.Sprint("obtain topic fail", err.Error()))
-	}
-
-	err = json.Unmarshal(data, &rMsg)
+	err := remarshal(r.prop.data, &rMsg)
 	if err != nil {
-		return "", errors.New(fmt.Sprint("obtain topic fail", err.Error()))
+		return nil, errors.New(fmt.Sprint("obtain topic fail", err.Error()))
 	}
 
-	return rMsg.Topic, nil
+	return &rMsg, nil
 }
 
 func (r *registerProcessor) exec() error {
@@ -77,56 +114,99 @@ func (r *registerProcessor) exec() error {
 
 	sub, err := r.prop.server.getSubscriber(name)
 	if err == nil && sub != nil {
-		glog.INFO.Println("subscrieber exists", name)
+		r.prop.server.getLogger().Info("subscriber exists", "subscriber", name)
+		r.prop.server.getMetrics().Add(metrics.SubscriberReconnects, 1, metrics.L("topic", sub.GetTopicName()))
 		return nil
 	}
 
-	topic, err := r.getSubscribedTopic()
+	rMsg, err := r.getRegistration()
 	if err != nil {
 		return err
 	}
 
-	client, err := subscriber.NewClient(subscriber.Property{
-		Address:   r.prop.addr,
-		Name:      name,
-		MaxBuffer: MaxBuffer,
-		Topic:     topic,
-	})
+	if !r.prop.server.Authorize(rMsg.Token) {
+		r.prop.server.sendInfo("client registration rejected", r.prop.version, r.prop.addr)
+		return errors.New(fmt.Sprint("unauthorized subscriber ", name))
+	}
 
+	if _, err := codec.Get(rMsg.Codec); err != nil {
+		r.prop.server.sendInfo(fmt.Sprint("client registration rejected, ", err.Error()), r.prop.version, r.prop.addr)
+		return errors.New(fmt.Sprint("subscriber ", name, " ", err.Error()))
+	}
+
+	client, err := r.prop.server.newSubscriber(name, rMsg.Topic, r.prop.addr)
 	if err != nil {
-		glog.ERROR.Println("fail create client", err.Error())
+		r.prop.server.getLogger().Error("fail create client", "error", err)
 		return err
 	}
-	r.prop.server.addSubscriber(name, client)
+	client.SetCodec(rMsg.Codec)
+	client.SetProtocolVersion(r.prop.version)
+	//the events from the offset are replayed from the store like a lagging subscriber
+	if rMsg.FromSeq > 0 {
+		client.SetLagging(rMsg.FromSeq)
+	}
 
-	msg, err := json.Marshal(Message{
-		Cmd: CmdInfo,
-		Msg: "client registration success",
-	})
+	err = r.prop.server.addSubscriber(name, client)
+	if err != nil {
+		return err
+	}
 
-	r.prop.server.sendData(msg, client.GetUDPAddr())
+	r.prop.server.sendInfo("client registration success", r.prop.version, client.GetUDPAddr())
 	return nil
 }
 
-//Region Event Accept Processor
+//Region Version Processor
 
-type eventProcessor struct {
+//versionProcessor answers the frame of an unsupported version, the newer client is asked to downgrade
+//to the server version and the older one is rejected
+type versionProcessor struct {
+	prop    *property
+	version uint8
+}
+
+func (r *versionProcessor) exec() error {
+	if r.version > codec.FrameVersion {
+		r.prop.server.sendInfo(msgDowngrade, codec.FrameVersion, r.prop.addr)
+		return errors.New(fmt.Sprint("protocol version ", r.version, " of ", r.prop.addr.String(), " is downgraded to ", codec.FrameVersion))
+	}
+
+	//the older client may not read the frame of the server, the rejection is unframed
+	err := &codec.VersionError{Version: r.version}
+	r.prop.server.sendInfo(fmt.Sprint("client registration rejected, ", err.Error()), 0, r.prop.addr)
+	return errors.New(fmt.Sprint(r.prop.addr.String(), " ", err.Error()))
+}
+
+//Region Info Processor
+
+type infoProcessor struct {
 	prop *property
 }
 
-func (r *eventProcessor) getEvent() (string, error) {
-	var eMsg EventMessage
-	data, err := json.Marshal(r.prop.data)
-	if err != nil {
-		return "", errors.New(fmt.Sprint("obtain event fail", err.Error()))
+func (r *infoProcessor) exec() error {
+	if r.prop.client == nil {
+		return errors.New("client does not exist")
 	}
 
-	err = json.Unmarshal(data, &eMsg)
-	if err != nil {
-		return "", errors.New(fmt.Sprint("obtain event fail", err.Error()))
+	if r.prop.msgText == msgDowngrade && r.prop.version > 0 && r.prop.version < r.prop.client.getVersion() {
+		return r.prop.client.downgrade(r.prop.version)
 	}
 
-	return eMsg.Event, nil
+	r.prop.client.getLogger().Debug("server info", "msg", r.prop.msgText)
+	return nil
+}
+
+//Region Event Accept Processor
+
+type eventProcessor struct {
+	prop *property
+}
+
+func (r *eventProcessor) getEvent() (*EventMessage, error) {
+	eMsg, err := ParseEvent(r.prop.data)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("obtain event fail", err.Error()))
+	}
+	return eMsg, nil
 }
 
 func (r *eventProcessor) exec() error {
@@ -134,25 +214,282 @@ func (r *eventProcessor) exec() error {
 		return errors.New("client does not exist")
 	}
 
-	event, err := r.getEvent()
+	eMsg, err := r.getEvent()
 	if err != nil {
 		return err
 	}
 
+	labels := []metrics.Label{metrics.L("topic", r.prop.client.getTopic()), metrics.L("event", eMsg.Event)}
+	r.prop.client.getMetrics().Add(metrics.ClientEventsReceived, 1, labels...)
+
+	start := time.Now()
+	err = r.process(eMsg)
+	r.prop.client.getMetrics().Observe(metrics.ClientProcessorDuration, since(start), labels...)
+	if err != nil {
+		r.prop.client.getMetrics().Add(metrics.ClientProcessorErrors, 1, labels...)
+	}
+	ackErr := r.ack(eMsg, err)
+	if ackErr != nil {
+		r.prop.client.getLogger().Debug("unable to ack event", "uuid", eMsg.UUID, "error", ackErr)
+	}
+
+	return err
+}
+
+//process runs every event processor registered for the event
+//every processor runs inside a child span of the trace context propagated with the event
+func (r *eventProcessor) process(eMsg *EventMessage) error {
+	event := eMsg.Event
+	tracer := r.prop.client.getTracer()
+	parent := tracer.Extract(context.Background(), eMsg.TraceContext)
+
 	processors := r.prop.client.getEventProcessors()
 	for _, proc := range processors {
 		if proc.Events == nil {
 			return errors.New("processors empty")
 		}
 
-		if util.InArrayStr(event, proc.Events) {
-			err := proc.Callback(r.prop.client.getTopic(), event, r.prop.data)
+		if util.InArrayStr(event, proc.Events) || util.InArrayStr(AllEvents, proc.Events) {
+			ctx, span := tracer.Start(parent, fmt.Sprint(r.prop.client.getTopic(), " process"), map[string]string{
+				"messaging.system":                  "genggar",
+				"messaging.destination.name":        r.prop.client.getTopic(),
+				"messaging.message.id":              eMsg.UUID,
+				"messaging.message.conversation_id": eMsg.CorrelationID,
+				"genggar.event":                     event,
+			})
+
+			err := r.run(ctx, proc, eMsg)
+			if err != nil {
+				span.SetError(err)
+			}
+			span.End()
+
 			if err != nil {
-				errMsg := fmt.Sprintf("processor error for %s %s", event, err.Error())
-				return errors.New(errMsg)
+				return err
 			}
 		}
 	}
 
 	return nil
 }
+
+//run calls the callbacks of the event processor
+func (r *eventProcessor) run(ctx context.Context, proc *EventProcessor, eMsg *EventMessage) error {
+	event := eMsg.Event
+	data := plain(r.prop.data)
+	if proc.Callback != nil {
+		err := proc.Callback(r.prop.client.getTopic(), event, data)
+		if err != nil {
+			errMsg := fmt.Sprintf("processor error for %s %s", event, err.Error())
+			return errors.New(errMsg)
+		}
+	}
+
+	if proc.ContextCallback != nil {
+		err := proc.ContextCallback(ctx, r.prop.client.getTopic(), event, data)
+		if err != nil {
+			errMsg := fmt.Sprintf("processor error for %s %s", event, err.Error())
+			return errors.New(errMsg)
+		}
+	}
+
+	if proc.Reply != nil && eMsg.ReplyTo != "" {
+		err := r.reply(proc.Reply, eMsg)
+		if err != nil {
+			errMsg := fmt.Sprintf("reply error for %s %s", event, err.Error())
+			return errors.New(errMsg)
+		}
+	}
+
+	return nil
+}
+
+//ack reports the processing result to the server
+func (r *eventProcessor) ack(eMsg *EventMessage, procErr error) error {
+	ack := AckMessage{
+		UUID:          eMsg.UUID,
+		Topic:         r.prop.client.getTopic(),
+		Event:         eMsg.Event,
+		CorrelationID: eMsg.CorrelationID,
+	}
+	if procErr != nil {
+		ack.Error = procErr.Error()
+	}
+
+	msg, err := r.prop.client.encode(Message{
+		Cmd:  CmdAck,
+		Msg:  "client ack",
+		Data: ack,
+	})
+	if err != nil {
+		return errors.New(fmt.Sprint("marshall error", err.Error()))
+	}
+
+	return r.prop.client.sendData(msg)
+}
+
+//reply runs the reply callback and sends the result back to the requester
+func (r *eventProcessor) reply(replyFunc ReplyFunc, eMsg *EventMessage) error {
+	reply := ReplyMessage{
+		RequestID:     eMsg.UUID,
+		CorrelationID: eMsg.CorrelationID,
+		Event:         eMsg.Event,
+	}
+
+	data, err := replyFunc(r.prop.client.getTopic(), eMsg.Event, eMsg.Payload)
+	if err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.Data = data
+	}
+
+	msg, err := r.prop.client.encode(Message{
+		Cmd:  CmdReply,
+		Msg:  "client reply",
+		Data: reply,
+	})
+	if err != nil {
+		return errors.New(fmt.Sprint("marshall error", err.Error()))
+	}
+
+	//the reply goes back through the server connection, ReplyTo is not dialled since the server
+	//may listen on an address which is not routable from the subscriber
+	return r.prop.client.sendData(msg)
+}
+
+//Region Reply Accept Processor
+
+type replyProcessor struct {
+	prop *property
+}
+
+func (r *replyProcessor) exec() error {
+	if r.prop.server == nil {
+		return errors.New("server does not exist")
+	}
+
+	var reply ReplyMessage
+	err := remarshal(r.prop.data, &reply)
+	if err != nil {
+		return errors.New(fmt.Sprint("obtain reply fail", err.Error()))
+	}
+
+	return r.prop.server.deliverReply(reply, r.prop.addr)
+}
+
+//Region Client Publish Processor
+
+type publishProcessor struct {
+	prop *property
+}
+
+func (r *publishProcessor) exec() error {
+	if r.prop.server == nil {
+		return errors.New("server does not exist")
+	}
+
+	var pMsg PublishMessage
+	err := remarshal(r.prop.data, &pMsg)
+	if err != nil {
+		return errors.New(fmt.Sprint("obtain publish fail", err.Error()))
+	}
+
+	if pMsg.Topic == "" || pMsg.Event == "" {
+		return errors.New("publish topic and event are required")
+	}
+
+	//registered subscriber or the token holder may publish when authentication is enabled
+	name := fmt.Sprint(r.prop.addr.IP.String(), ":", r.prop.addr.Port)
+	if _, err := r.prop.server.getSubscriber(name); err != nil && !r.prop.server.Authorize(pMsg.Token) {
+		return errors.New(fmt.Sprint("unauthorized publisher ", name))
+	}
+
+	return r.prop.server.publishEvent(pMsg.Topic, r.prop.msgText, subscriber.PriorityNormal, EventMessage{
+		Event:         pMsg.Event,
+		CorrelationID: pMsg.CorrelationID,
+		CausationID:   pMsg.CausationID,
+		TraceContext:  pMsg.TraceContext,
+	})
+}
+
+//Region Ack Processor
+
+type ackProcessor struct {
+	prop *property
+}
+
+func (r *ackProcessor) exec() error {
+	if r.prop.server == nil {
+		return errors.New("server does not exist")
+	}
+
+	var ack AckMessage
+	err := remarshal(r.prop.data, &ack)
+	if err != nil {
+		return errors.New(fmt.Sprint("obtain ack fail", err.Error()))
+	}
+
+	name := fmt.Sprint(r.prop.addr.IP.String(), ":", r.prop.addr.Port)
+	return r.prop.server.Ack(name, ack)
+}
+
+//Region Admin Processor
+
+type adminProcessor struct {
+	prop *property
+	cmd  string
+}
+
+func (r *adminProcessor) exec() error {
+	if r.prop.server == nil {
+		return errors.New("server does not exist")
+	}
+
+	var aMsg AdminMessage
+	err := remarshal(r.prop.data, &aMsg)
+	if err != nil {
+		return errors.New(fmt.Sprint("obtain admin command fail", err.Error()))
+	}
+
+	var result interface{}
+	authorized := r.prop.server.Authorize(aMsg.Token)
+	switch r.cmd {
+	case CmdList:
+		list := &ListResult{Error: "unauthorized"}
+		if authorized {
+			list = r.prop.server.Inspect()
+		}
+		result = list
+	case CmdPause, CmdResume:
+		res := AdminResult{}
+		if !authorized {
+			res.Error = "unauthorized"
+		} else if err := r.setPaused(aMsg.Subscriber); err != nil {
+			res.Error = err.Error()
+		}
+		result = res
+	}
+
+	msg, err := json.Marshal(Message{
+		Cmd:  r.cmd,
+		Msg:  "server admin",
+		Data: result,
+	})
+	if err != nil {
+		return errors.New(fmt.Sprint("marshall error", err.Error()))
+	}
+
+	msg, err = frameMessage(r.prop.version, r.cmd, msg)
+	if err != nil {
+		return err
+	}
+
+	return r.prop.server.sendData(msg, r.prop.addr)
+}
+
+func (r *adminProcessor) setPaused(name string) error {
+	if r.cmd == CmdPause {
+		return r.prop.server.PauseSubscriber(name)
+	}
+	return r.prop.server.ResumeSubscriber(name)
+}
@@ -0,0 +1,232 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/tracing"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+//the commands encoded as their own messages by the protobuf codec, see codec/genggar.proto
+func init() {
+	codec.RegisterProto(codec.ProtoFieldEvent, func() codec.ProtoMessage { return &EventMessage{} })
+	codec.RegisterProto(codec.ProtoFieldRegister, func() codec.ProtoMessage { return &RegisterMessage{} })
+	codec.RegisterProto(codec.ProtoFieldAck, func() codec.ProtoMessage { return &AckMessage{} })
+}
+
+//errUnknownField skips the field, the newer fields are ignored for the forward compatibility
+var errUnknownField = errors.New("unknown protobuf field")
+
+//MarshalProto encodes the EventMessage of genggar.proto, the payload is json bytes
+func (m EventMessage) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendProtoString(b, 1, m.Event)
+	b = appendProtoString(b, 2, m.UUID)
+	b = appendProtoUint(b, 3, m.Seq)
+	b = appendProtoString(b, 4, m.Message)
+	b = appendProtoString(b, 5, m.CorrelationID)
+	b = appendProtoString(b, 6, m.CausationID)
+	b = appendProtoString(b, 7, m.ReplyTo)
+
+	if m.Payload != nil {
+		payload, err := json.Marshal(m.Payload)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("marshall payload fail ", err.Error()))
+		}
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, payload)
+	}
+
+	//the map entries are sorted, so the same event has the same bytes
+	keys := make([]string, 0, len(m.TraceContext))
+	for key := range m.TraceContext {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var entry []byte
+		entry = appendProtoString(entry, 1, key)
+		entry = appendProtoString(entry, 2, m.TraceContext[key])
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b, nil
+}
+
+func (m *EventMessage) UnmarshalProto(data []byte) error {
+	*m = EventMessage{}
+	return consumeProto(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+		var n int
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			m.Event, n = protowire.ConsumeString(data)
+		case num == 2 && typ == protowire.BytesType:
+			m.UUID, n = protowire.ConsumeString(data)
+		case num == 3 && typ == protowire.VarintType:
+			m.Seq, n = protowire.ConsumeVarint(data)
+		case num == 4 && typ == protowire.BytesType:
+			m.Message, n = protowire.ConsumeString(data)
+		case num == 5 && typ == protowire.BytesType:
+			m.CorrelationID, n = protowire.ConsumeString(data)
+		case num == 6 && typ == protowire.BytesType:
+			m.CausationID, n = protowire.ConsumeString(data)
+		case num == 7 && typ == protowire.BytesType:
+			m.ReplyTo, n = protowire.ConsumeString(data)
+		case num == 8 && typ == protowire.BytesType:
+			var payload []byte
+			payload, n = protowire.ConsumeBytes(data)
+			if n >= 0 {
+				err := json.Unmarshal(payload, &m.Payload)
+				if err != nil {
+					return 0, errors.New(fmt.Sprint("unmarshall payload fail ", err.Error()))
+				}
+			}
+		case num == 9 && typ == protowire.BytesType:
+			var entry []byte
+			entry, n = protowire.ConsumeBytes(data)
+			if n >= 0 {
+				key, val, err := consumeProtoEntry(entry)
+				if err != nil {
+					return 0, err
+				}
+				if m.TraceContext == nil {
+					m.TraceContext = make(tracing.Headers)
+				}
+				m.TraceContext[key] = val
+			}
+		default:
+			return 0, errUnknownField
+		}
+		return n, nil
+	})
+}
+
+//MarshalProto encodes the RegisterMessage of genggar.proto
+func (m RegisterMessage) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendProtoString(b, 1, m.Topic)
+	b = appendProtoString(b, 2, m.Token)
+	b = appendProtoUint(b, 3, m.FromSeq)
+	b = appendProtoString(b, 4, m.Codec)
+	return b, nil
+}
+
+func (m *RegisterMessage) UnmarshalProto(data []byte) error {
+	*m = RegisterMessage{}
+	return consumeProto(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+		var n int
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			m.Topic, n = protowire.ConsumeString(data)
+		case num == 2 && typ == protowire.BytesType:
+			m.Token, n = protowire.ConsumeString(data)
+		case num == 3 && typ == protowire.VarintType:
+			m.FromSeq, n = protowire.ConsumeVarint(data)
+		case num == 4 && typ == protowire.BytesType:
+			m.Codec, n = protowire.ConsumeString(data)
+		default:
+			return 0, errUnknownField
+		}
+		return n, nil
+	})
+}
+
+//MarshalProto encodes the AckMessage of genggar.proto
+func (m AckMessage) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendProtoString(b, 1, m.UUID)
+	b = appendProtoString(b, 2, m.Topic)
+	b = appendProtoString(b, 3, m.Event)
+	b = appendProtoString(b, 4, m.CorrelationID)
+	b = appendProtoString(b, 5, m.Error)
+	return b, nil
+}
+
+func (m *AckMessage) UnmarshalProto(data []byte) error {
+	*m = AckMessage{}
+	return consumeProto(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+		var n int
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			m.UUID, n = protowire.ConsumeString(data)
+		case num == 2 && typ == protowire.BytesType:
+			m.Topic, n = protowire.ConsumeString(data)
+		case num == 3 && typ == protowire.BytesType:
+			m.Event, n = protowire.ConsumeString(data)
+		case num == 4 && typ == protowire.BytesType:
+			m.CorrelationID, n = protowire.ConsumeString(data)
+		case num == 5 && typ == protowire.BytesType:
+			m.Error, n = protowire.ConsumeString(data)
+		default:
+			return 0, errUnknownField
+		}
+		return n, nil
+	})
+}
+
+//appendProtoString writes the string field, the empty string is the proto3 default and it is not written
+func appendProtoString(b []byte, num protowire.Number, val string) []byte {
+	if val == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, val)
+}
+
+func appendProtoUint(b []byte, num protowire.Number, val uint64) []byte {
+	if val == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, val)
+}
+
+//consumeProto reads every field of the message with field, which returns the length of the read value
+func consumeProto(data []byte, field func(num protowire.Number, typ protowire.Type, data []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protoError(n)
+		}
+		data = data[n:]
+
+		n, err := field(num, typ, data)
+		if err == errUnknownField {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		} else if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protoError(n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+//consumeProtoEntry reads the map<string, string> entry
+func consumeProtoEntry(data []byte) (string, string, error) {
+	var key, val string
+	err := consumeProto(data, func(num protowire.Number, typ protowire.Type, data []byte) (int, error) {
+		var n int
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			key, n = protowire.ConsumeString(data)
+		case num == 2 && typ == protowire.BytesType:
+			val, n = protowire.ConsumeString(data)
+		default:
+			return 0, errUnknownField
+		}
+		return n, nil
+	})
+	return key, val, err
+}
+
+func protoError(n int) error {
+	return errors.New(fmt.Sprint("unmarshall protobuf fail ", protowire.ParseError(n).Error()))
+}
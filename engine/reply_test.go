@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+//addTestSubscriber registers the sink as the subscriber of the topic
+func addTestSubscriber(t *testing.T, s *ServerImpl, topic string) *net.UDPAddr {
+	sink := newTestSink(t)
+	t.Cleanup(func() { sink.Close() })
+
+	addr := sink.LocalAddr().(*net.UDPAddr)
+	name := fmt.Sprint(addr.IP.String(), ":", addr.Port)
+	sub, err := s.newSubscriber(name, topic, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.addSubscriber(name, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+func TestDeliverReply(t *testing.T) {
+	stranger := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9}
+
+	tests := []struct {
+		name      string
+		authToken string
+		from      string
+		token     string
+		delivered bool
+	}{
+		{"subscriber of the topic", "", "ORDER", "", true},
+		{"subscriber of another topic", "", "PAYMENT", "", false},
+		{"unknown sender", "", "", "", false},
+		{"unknown sender with token", "secret", "", "secret", true},
+		{"unknown sender with wrong token", "secret", "", "guess", false},
+		{"unknown sender without authentication", "", "", "guess", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t)
+			defer s.ServerConn.Close()
+			s.AuthToken = test.authToken
+
+			from := stranger
+			if test.from != "" {
+				from = addTestSubscriber(t, s, test.from)
+			}
+
+			replyChan := make(chan ReplyMessage, 1)
+			s.pending = map[string]pendingRequest{"req-1": {topic: "ORDER", reply: replyChan}}
+
+			err := s.deliverReply(ReplyMessage{RequestID: "req-1", Data: "price", Token: test.token}, from)
+			if delivered := err == nil; delivered != test.delivered {
+				t.Fatalf("got delivered %v, %v", delivered, err)
+			}
+
+			//the rejected reply keeps the request waiting for its subscriber
+			if _, pending := s.pending["req-1"]; pending == test.delivered {
+				t.Fatalf("got pending %v", pending)
+			}
+			if len(replyChan) == 1 != test.delivered {
+				t.Fatal("reply is not passed to the request")
+			}
+		})
+	}
+}
+
+//TestRequestForgedReply checks the guessed request id does not answer the request
+func TestRequestForgedReply(t *testing.T) {
+	s := newTestServer(t)
+	defer s.ServerConn.Close()
+	subAddr := addTestSubscriber(t, s, "ORDER")
+
+	type result struct {
+		data interface{}
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := s.Request(context.Background(), "ORDER", "GET_PRICE", nil)
+		done <- result{data, err}
+	}()
+
+	var requestID string
+	deadline := time.Now().Add(time.Second)
+	for requestID == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("request is not pending")
+		}
+		s.replyMux.Lock()
+		for id := range s.pending {
+			requestID = id
+		}
+		s.replyMux.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	forged := &property{
+		server: s,
+		addr:   &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9},
+		data:   ReplyMessage{RequestID: requestID, Data: "forged"},
+	}
+	err := (&replyProcessor{prop: forged}).exec()
+	if err == nil {
+		t.Fatal("forged reply is delivered")
+	}
+
+	reply := &property{
+		server: s,
+		addr:   subAddr,
+		data:   ReplyMessage{RequestID: requestID, Data: "price"},
+	}
+	err = (&replyProcessor{prop: reply}).exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case res := <-done:
+		if res.err != nil || res.data != "price" {
+			t.Fatalf("got %v, %v", res.data, res.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request is not answered")
+	}
+}
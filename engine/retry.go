@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/syariatifaris/genggar/eventstore"
+	"github.com/syariatifaris/genggar/metrics"
+	"github.com/syariatifaris/genggar/subscriber"
+)
+
+//RetryPolicy is the redelivery of the event which the subscriber failed to receive
+//the wait is doubled after every attempt from Backoff up to MaxBackoff, the event is dead lettered
+//after MaxAttempts, it is recorded to the event store and published to DeadLetterTopic when it is set
+type RetryPolicy struct {
+	MaxAttempts     int
+	Backoff         time.Duration
+	MaxBackoff      time.Duration
+	DeadLetterTopic string
+}
+
+//DefaultRetryPolicy is used when the server retry policy is not set
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     time.Millisecond * 100,
+	MaxBackoff:  time.Second * 30,
+}
+
+//backoff returns the wait before the next attempt, attempt starts from 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+//SetRetryPolicy changes the redelivery of the failed events
+func (s *ServerImpl) SetRetryPolicy(policy RetryPolicy) {
+	s.mux.Lock()
+	s.Retry = policy
+	s.mux.Unlock()
+}
+
+func (s *ServerImpl) getRetryPolicy() RetryPolicy {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.Retry.MaxAttempts <= 0 {
+		return DefaultRetryPolicy
+	}
+	return s.Retry
+}
+
+//deadLetter records the event which could not be delivered to the subscriber
+func (s *ServerImpl) deadLetter(sb subscriber.Client, data interface{}, sendErr error, policy RetryPolicy) {
+	topic := sb.GetTopicName()
+	atomic.AddUint64(&s.counter(topic).deadLettered, 1)
+	s.getMetrics().Add(metrics.EventsDeadLetter, 1, metrics.L("topic", topic))
+
+	message, err := toMessage(data)
+	if err != nil {
+		s.getLogger().Error("dead letter is not a message", "subscriber", sb.GetName(), "error", err)
+		return
+	}
+
+	evt, err := ParseEvent(message.Data)
+	if err != nil {
+		s.getLogger().Error("dead letter is not an event", "subscriber", sb.GetName(), "error", err)
+		return
+	}
+
+	s.getLogger().Error("event dead lettered", "subscriber", sb.GetName(), "uuid", evt.UUID, "error", sendErr)
+	s.record(&eventstore.Record{
+		Kind:          eventstore.KindDeadLettered,
+		UUID:          evt.UUID,
+		Topic:         topic,
+		Event:         evt.Event,
+		Message:       message.Msg,
+		CorrelationID: evt.CorrelationID,
+		CausationID:   evt.CausationID,
+		Source:        sb.GetName(),
+		Error:         sendErr.Error(),
+	})
+
+	//the dead letter of the dead letter topic is not published again
+	if policy.DeadLetterTopic == "" || policy.DeadLetterTopic == topic {
+		return
+	}
+
+	go func() {
+		err := s.PublishFrom(context.Background(), evt, policy.DeadLetterTopic, evt.Event, message.Msg)
+		if err != nil {
+			s.getLogger().Error("unable to publish dead letter", "uuid", evt.UUID, "error", err)
+		}
+	}()
+}
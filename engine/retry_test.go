@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//fillingSink fills the subscriber buffer while the first send fails, like the publishers racing the dispatcher
+type fillingSink struct {
+	once   sync.Once
+	server *ServerImpl
+}
+
+func (f *fillingSink) Send(msg []byte) error {
+	var err error
+	f.once.Do(func() {
+		f.server.PublishEvent("ORDER", "NEW_ORDER", "second")
+		f.server.PublishEvent("ORDER", "NEW_ORDER", "third")
+		err = errors.New("connection refused")
+	})
+	return err
+}
+
+func (f *fillingSink) Address() string {
+	return "test"
+}
+
+func TestRetryBufferFull(t *testing.T) {
+	s := newTestServer(t)
+	s.SubscriberBuffer = 1
+	atomic.StoreInt32(&s.isStarted, 1)
+
+	err := s.AttachSink("sink", "ORDER", 0, &fillingSink{server: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.PublishEvent("ORDER", "NEW_ORDER", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopChan := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		s.DispatchEventPublisher(stopChan)
+		close(done)
+	}()
+	defer func() {
+		close(stopChan)
+		<-done
+	}()
+
+	//the failed event is dead lettered instead of lost, the others are delivered
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		counter := s.counter("ORDER")
+		if atomic.LoadUint64(&counter.deadLettered) == 1 && atomic.LoadUint64(&counter.delivered) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d dead lettered and %d delivered events", atomic.LoadUint64(&counter.deadLettered), atomic.LoadUint64(&counter.delivered))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if retried := atomic.LoadUint64(&s.counter("ORDER").retried); retried != 0 {
+		t.Fatalf("got %d retried events want 0", retried)
+	}
+}
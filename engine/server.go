@@ -1,23 +1,35 @@
 package engine
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
-	"log"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"time"
 
-	"github.com/syariatifaris/genggar/glog"
+	"github.com/syariatifaris/genggar/eventstore"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/metrics"
+	"github.com/syariatifaris/genggar/schedule"
 	"github.com/syariatifaris/genggar/subscriber"
+	"github.com/syariatifaris/genggar/tracing"
 	"github.com/syariatifaris/genggar/util"
 )
 
 const (
 	MaxBuffer = 1024
 	ProtoUDP  = "udp"
+
+	DefaultRequestTimeout = time.Second * 30
+
+	//DefaultSpillRetention keeps the spill files of the unregistered subscriber, it may register again after restart
+	DefaultSpillRetention = time.Hour * 24
+	spillCleanInterval    = time.Minute
 )
 
 type Server interface {
@@ -25,36 +37,108 @@ type Server interface {
 	Start(stopChan <-chan bool)
 	DispatchEventPublisher(stopChan <-chan bool)
 	PublishEvent(topic, event, message string) error
+	PublishPriority(topic, event, message string, priority subscriber.Priority) error
+	PublishFrom(ctx context.Context, cause *EventMessage, topic, event, message string) error
+	PublishContext(ctx context.Context, topic, event, message string) error
+	PublishAt(topic, event, message string, at time.Time) (string, error)
+	PublishAfter(topic, event, message string, delay time.Duration) (string, error)
+	PublishCron(topic, event, message, spec string) (string, error)
+	CancelScheduled(id string) error
+	SetTopicOverflow(topic string, cfg subscriber.OverflowConfig) error
+	SetSubscriberOverflow(name string, cfg subscriber.OverflowConfig) error
+	SetRequestTimeout(timeout time.Duration)
+	SetAuthToken(token string)
+	SetRetryPolicy(policy RetryPolicy)
+	Request(ctx context.Context, topic, event string, payload interface{}) (interface{}, error)
+	Inspect() *ListResult
+	PauseSubscriber(name string) error
+	ResumeSubscriber(name string) error
+	AttachSink(name, topic string, fromSeq uint64, sink Sink) error
+	DetachSink(name string)
+	Authorize(token string) bool
+	Ack(name string, ack AckMessage) error
 
 	//region private functions
 	registerSubscriber(name string, addr *net.UDPAddr) error
+	deliverReply(reply ReplyMessage, addr *net.UDPAddr) error
+	publishEvent(topic, message string, priority subscriber.Priority, evt EventMessage) error
+	newSubscriber(name, topic string, addr *net.UDPAddr) (subscriber.Client, error)
 	sendData(msg []byte, addr *net.UDPAddr) error
+	sendInfo(msg string, version uint8, addr *net.UDPAddr) error
 	getSubscriber(name string) (subscriber.Client, error)
-	addSubscriber(string, subscriber.Client)
+	addSubscriber(string, subscriber.Client) error
+	getMetrics() metrics.Metrics
+	getLogger() logger.Logger
 }
 
 type ServerImpl struct {
-	Port  int
-	Proto string
+	Port       int
+	Proto      string
+	IDGen      util.IDGenerator
+	EventStore eventstore.Store
+
+	//SubscriberBuffer is the max buffer of every subscriber, MaxBuffer is used when it is not set
+	SubscriberBuffer int
+	//RequestTimeout bounds the request without deadline, DefaultRequestTimeout is used when it is not set
+	RequestTimeout time.Duration
+	//AuthToken is the token required from the subscriber on registration, empty token disables it
+	AuthToken string
+	//Retry is the redelivery of the failed send, DefaultRetryPolicy is used when it is not set
+	Retry RetryPolicy
+	//Metrics receives the server measurements, nothing is measured when it is not set
+	Metrics metrics.Metrics
+	//Tracer propagates the trace context of PublishContext and Request, nothing is traced when it is not set
+	Tracer tracing.Tracer
+	//Logger receives the server logs, logger.Glog is used when it is not set
+	Logger logger.Logger
+
+	//TopicOverflow is the overflow policy of the topic subscribers, subscriber buffer rejects by default
+	TopicOverflow map[string]subscriber.OverflowConfig
+
+	//SpillDir enables spill client, every subscriber keeps SpillHead events in memory and the rest in SpillDir
+	SpillDir  string
+	SpillHead int
+	//SpillRetention removes the spill files of the subscribers which are not registered and not written since,
+	//DefaultSpillRetention is used when it is not set
+	SpillRetention time.Duration
+	spillCleaned   time.Time
 
 	mux         sync.Mutex
 	MsgBuff     []byte
 	ServerConn  *net.UDPConn
-	Subscribers map[string]subscriber.Client
+	Subscribers *subscriber.Registry
+
+	isStarted int32
+	replyMux  sync.Mutex
+	pending   map[string]pendingRequest
+	pubMux    sync.Mutex
+
+	schedOnce sync.Once
+	scheduler *schedule.Registry
+
+	counterMux sync.Mutex
+	counters   map[string]*topicCounter
+
+	sinkMux sync.RWMutex
+	sinks   map[string]Sink
+}
 
-	isStarted bool
+//pendingRequest is the request waiting for the reply of a subscriber of the topic
+type pendingRequest struct {
+	topic string
+	reply chan ReplyMessage
 }
 
 //Start listens for incoming client
 func (s *ServerImpl) Start(stopListen <-chan bool) {
-	s.isStarted = true
-	serverChan := make(chan bool)
+	atomic.StoreInt32(&s.isStarted, 1)
+	serverChan := make(chan bool, 1)
 
 	go func(stopListen <-chan bool) {
 		for {
 			select {
 			case <-stopListen:
-				s.isStarted = false
+				atomic.StoreInt32(&s.isStarted, 0)
 				s.ServerConn.Close()
 				serverChan <- true
 				return
@@ -71,121 +155,683 @@ func (s *ServerImpl) Start(stopListen <-chan bool) {
 		default:
 			n, addr, err := s.ServerConn.ReadFromUDP(s.MsgBuff)
 			if err != nil {
-				if !s.isStarted {
+				if !s.started() {
 					return
 				}
 
-				glog.ERROR.Println("udp error", err.Error())
+				s.getLogger().Error("udp error", "error", err)
 				continue
 			}
 
+			if sub, ok := s.Subscribers.Get(fmt.Sprint(addr.IP.String(), ":", addr.Port)); ok {
+				sub.Touch()
+			}
+
 			processor, err := getProcessor(&property{
 				msg:    s.MsgBuff[0:n],
 				server: s,
 				addr:   addr,
 			})
 			if err != nil {
-				glog.ERROR.Println("unable to resolve process", err.Error())
+				s.getLogger().Error("unable to resolve process", "error", err)
 				continue
 
 			}
 
 			err = processor.exec()
 			if err != nil {
-				glog.ERROR.Println("unable to exec process", err.Error())
+				s.getLogger().Error("unable to exec process", "error", err)
 				continue
 			}
 		}
 	}
 }
 
+func (s *ServerImpl) started() bool {
+	return atomic.LoadInt32(&s.isStarted) == 1
+}
+
 //DispatchEventPublisher dispatch event publisher to read the buffer
 func (s *ServerImpl) DispatchEventPublisher(stopChan <-chan bool) {
 	stopDispatchChan := make(chan bool)
 	for {
 		select {
 		case <-stopChan:
-			stopDispatchChan <- true
+			//closing stops every subscriber handler, and does not block without subscriber
+			close(stopDispatchChan)
 			return
 		default:
-			if len(s.Subscribers) > 0 {
-				s.mux.Lock()
-				for _, sb := range s.Subscribers {
-					if !sb.IsDispatched() {
-						sb.SetDispatching(true)
-						go s.handleEventBuffer(sb, stopDispatchChan)
-						glog.DEBUG.Println("dispatch for", sb.GetUDPAddr().String())
-					}
+			s.getScheduler().FireDue(time.Now())
+			s.cleanSpill(time.Now())
+			for _, sb := range s.Subscribers.Snapshot() {
+				if !sb.IsDispatched() {
+					sb.SetDispatching(true)
+					go s.handleEventBuffer(sb, stopDispatchChan)
+					s.getLogger().Debug("dispatch for", "subscriber", sb.GetName())
 				}
-
-				s.mux.Unlock()
 			}
 			time.Sleep(time.Millisecond * 10)
 		}
 	}
 }
 
-//PublishEvent publishes event based on client identifier
+//cleanSpill removes the spill files left by the subscribers which are not registered anymore
+func (s *ServerImpl) cleanSpill(now time.Time) {
+	s.mux.Lock()
+	if now.Sub(s.spillCleaned) < spillCleanInterval {
+		s.mux.Unlock()
+		return
+	}
+	s.spillCleaned = now
+
+	retention := s.SpillRetention
+	if retention <= 0 {
+		retention = DefaultSpillRetention
+	}
+
+	var dirs []string
+	if s.SpillDir != "" {
+		dirs = append(dirs, s.SpillDir)
+	}
+	for _, cfg := range s.TopicOverflow {
+		if cfg.Policy == subscriber.OverflowSpill {
+			dirs = append(dirs, cfg.SpillDir)
+		}
+	}
+	s.mux.Unlock()
+
+	if len(dirs) == 0 {
+		return
+	}
+
+	var active []string
+	for _, sub := range s.Subscribers.Snapshot() {
+		active = append(active, sub.GetName())
+	}
+
+	for _, dir := range dirs {
+		removed, err := subscriber.CleanSpill(dir, active, retention)
+		if err != nil {
+			s.getLogger().Error("clean spill fail", "dir", dir, "error", err)
+		}
+		if removed > 0 {
+			s.getLogger().Info("spill removed", "dir", dir, "subscribers", removed)
+		}
+	}
+}
+
+//PublishEvent publishes event based on client identifier, the event starts a new correlation
 func (s *ServerImpl) PublishEvent(topic, event, message string) error {
-	uuid, _ := util.GetV4UUID()
-	data := Message{
-		Cmd: CmdEvent,
-		Msg: message,
-		Data: EventMessage{
-			Event: event,
-			UUID:  uuid,
-		},
+	return s.PublishPriority(topic, event, message, subscriber.PriorityNormal)
+}
+
+//PublishPriority publishes event with priority, higher priority event is dispatched first to the subscriber
+func (s *ServerImpl) PublishPriority(topic, event, message string, priority subscriber.Priority) error {
+	return s.publishEvent(topic, message, priority, EventMessage{
+		Event: event,
+	})
+}
+
+//PublishFrom publishes event caused by another event, it keeps the correlation id of the cause
+//the event carries the trace context of ctx, or the trace context of the cause when ctx is not traced
+func (s *ServerImpl) PublishFrom(ctx context.Context, cause *EventMessage, topic, event, message string) error {
+	evt := EventMessage{
+		Event:        event,
+		TraceContext: s.traceContext(ctx),
+	}
+
+	if cause != nil {
+		evt.CorrelationID = cause.CorrelationID
+		if evt.CorrelationID == "" {
+			evt.CorrelationID = cause.UUID
+		}
+		evt.CausationID = cause.UUID
+		if evt.TraceContext == nil {
+			evt.TraceContext = cause.TraceContext
+		}
+	}
+
+	return s.publishEvent(topic, message, subscriber.PriorityNormal, evt)
+}
+
+//PublishContext publishes event carrying the trace context of ctx, the event starts a new correlation
+func (s *ServerImpl) PublishContext(ctx context.Context, topic, event, message string) error {
+	return s.publishEvent(topic, message, subscriber.PriorityNormal, EventMessage{
+		Event:        event,
+		TraceContext: s.traceContext(ctx),
+	})
+}
+
+//PublishAt schedules the event to be published at the given time, it returns the schedule id
+//the scheduled event is published by the event dispatcher
+func (s *ServerImpl) PublishAt(topic, event, message string, at time.Time) (string, error) {
+	return s.getScheduler().At(topic, event, message, at)
+}
+
+//PublishAfter schedules the event to be published after the delay, it returns the schedule id
+func (s *ServerImpl) PublishAfter(topic, event, message string, delay time.Duration) (string, error) {
+	return s.getScheduler().At(topic, event, message, time.Now().Add(delay))
+}
+
+//PublishCron schedules recurring event using five fields cron expression, it returns the schedule id
+func (s *ServerImpl) PublishCron(topic, event, message, spec string) (string, error) {
+	return s.getScheduler().Cron(topic, event, message, spec)
+}
+
+//CancelScheduled cancels the pending scheduled event
+func (s *ServerImpl) CancelScheduled(id string) error {
+	return s.getScheduler().Cancel(id)
+}
+
+//getScheduler creates the schedule registry, pending schedules are loaded from the event store
+func (s *ServerImpl) getScheduler() *schedule.Registry {
+	s.schedOnce.Do(func() {
+		s.scheduler = schedule.NewRegistry(s.EventStore, s.publishScheduled)
+		s.scheduler.Logger = s.getLogger()
+		err := s.scheduler.Load()
+		if err != nil {
+			s.getLogger().Error("unable to load scheduled events", "error", err)
+		}
+	})
+	return s.scheduler
+}
+
+//publishScheduled publishes the due scheduled event, the event rejected by some subscribers is still
+//fired since the others received it
+func (s *ServerImpl) publishScheduled(topic, event, message string) error {
+	err := s.PublishEvent(topic, event, message)
+	if fanOut, ok := err.(*FanOutError); ok {
+		s.getLogger().Warn("scheduled event rejected", "topic", topic, "event", event, "subscribers", strings.Join(fanOut.Subscribers, ","))
+		return nil
+	}
+	return err
+}
+
+//Request publishes event with reply address and waits for the first subscriber reply
+//ctx without deadline is bounded by RequestTimeout
+func (s *ServerImpl) Request(ctx context.Context, topic, event string, payload interface{}) (interface{}, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		s.mux.Lock()
+		timeout := s.RequestTimeout
+		s.mux.Unlock()
+		if timeout <= 0 {
+			timeout = DefaultRequestTimeout
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	uuid, err := s.newEventID()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("unable to generate event id ", err.Error()))
 	}
 
 	if s.ServerConn == nil {
-		if s.Subscribers != nil {
-			errors.New("no subscriber found")
+		return nil, errors.New("server connection is closed")
+	}
+
+	replyChan := make(chan ReplyMessage, 1)
+	s.replyMux.Lock()
+	if s.pending == nil {
+		s.pending = make(map[string]pendingRequest)
+	}
+	s.pending[uuid] = pendingRequest{topic: topic, reply: replyChan}
+	s.replyMux.Unlock()
+
+	defer func() {
+		s.replyMux.Lock()
+		delete(s.pending, uuid)
+		s.replyMux.Unlock()
+	}()
+
+	err = s.publishEvent(topic, "request from server", subscriber.PriorityNormal, EventMessage{
+		Event:        event,
+		UUID:         uuid,
+		ReplyTo:      s.ServerConn.LocalAddr().String(),
+		Payload:      payload,
+		TraceContext: s.traceContext(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-replyChan:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
 		}
+		return reply.Data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
 
-		errors.New("server connection is closed")
+//publishEvent assigns the event id and correlation, then publishes it to the topic
+func (s *ServerImpl) publishEvent(topic, message string, priority subscriber.Priority, evt EventMessage) error {
+	if evt.UUID == "" {
+		uuid, err := s.newEventID()
+		if err != nil {
+			return errors.New(fmt.Sprint("unable to generate event id ", err.Error()))
+		}
+		evt.UUID = uuid
 	}
 
-	for _, sub := range s.Subscribers {
-		if sub.GetTopicName() == topic {
-			err := sub.PushBack(data)
-			if err != nil {
-				return errors.New("unable to push data to buffer")
-			}
+	if evt.CorrelationID == "" {
+		evt.CorrelationID = evt.UUID
+	}
+
+	if s.ServerConn == nil {
+		return errors.New("server connection is closed")
+	}
+
+	s.pubMux.Lock()
+
+	//record first, the sequence is the catch up position of the lagging subscriber
+	rec := &eventstore.Record{
+		Kind:          eventstore.KindPublished,
+		UUID:          evt.UUID,
+		Topic:         topic,
+		Event:         evt.Event,
+		Message:       message,
+		CorrelationID: evt.CorrelationID,
+		CausationID:   evt.CausationID,
+		TraceContext:  evt.TraceContext,
+		Priority:      int(priority),
+		ReplyTo:       evt.ReplyTo,
+		Payload:       evt.Payload,
+	}
+	s.record(rec)
+	evt.Seq = rec.Seq
+	evt.Message = message
+	atomic.AddUint64(&s.counter(topic).published, 1)
+	s.getMetrics().Add(metrics.EventsPublished, 1, metrics.L("topic", topic))
+
+	data := Message{
+		Cmd:      CmdEvent,
+		Msg:      message,
+		Data:     evt,
+		Priority: priority,
+	}
+	failed, reserved, targets := s.publish(topic, rec.Seq, data)
+	s.pubMux.Unlock()
+
+	//the subscribers of block policy are waited without holding the other publishers
+	for name, sub := range reserved {
+		err := sub.client.PushReserved(sub.ticket, data)
+		if err != nil {
+			failed = append(failed, name)
+			continue
 		}
+		s.measureBuffer(sub.client)
 	}
 
+	return s.fanOutError(topic, targets, failed)
+}
+
+//reservation is the place of the event in the buffer of the block policy subscriber
+type reservation struct {
+	client subscriber.Client
+	ticket uint64
+}
+
+//publish pushes the message to buffer of every subscriber of the topic, the caller should hold pubMux
+//a full subscriber does not stop the fan out, failed lists the subscribers failed to receive it
+//the block policy subscriber is only reserved, the caller pushes to it after releasing pubMux
+//targets is the number of the topic subscribers
+func (s *ServerImpl) publish(topic string, seq uint64, data Message) ([]string, map[string]reservation, int) {
+	var failed []string
+	reserved := make(map[string]reservation)
+	subs := s.Subscribers.ByTopic(topic)
+	for name, sub := range subs {
+		//lagging subscriber receives the event from the store
+		if lagging, _ := sub.GetLagging(); lagging {
+			continue
+		}
+
+		if sub.GetOverflow().Policy == subscriber.OverflowBlock {
+			reserved[name] = reservation{client: sub, ticket: sub.Reserve()}
+			continue
+		}
+
+		err := sub.PushBack(data)
+		if err == nil {
+			s.measureBuffer(sub)
+			continue
+		}
+
+		if err == subscriber.ErrBufferFull && sub.GetOverflow().Policy == subscriber.OverflowLag && seq > 0 {
+			s.getLogger().Info("subscriber lagging", "subscriber", name, "from", seq)
+			sub.SetLagging(seq)
+			continue
+		}
+
+		failed = append(failed, name)
+	}
+
+	return failed, reserved, len(subs)
+}
+
+//fanOutError counts the rejected event, the FanOutError lists the subscribers failed to receive it
+func (s *ServerImpl) fanOutError(topic string, targets int, failed []string) error {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	atomic.AddUint64(&s.counter(topic).rejected, uint64(len(failed)))
+	s.getMetrics().Add(metrics.EventsRejected, float64(len(failed)), metrics.L("topic", topic))
+	return &FanOutError{Topic: topic, Subscribers: failed, Delivered: targets - len(failed)}
+}
+
+//catchUp pushes the stored events to the lagging subscriber until its buffer is full again
+//the store is read without holding publishing, only the events published meanwhile are pushed while
+//publishing is held, so the subscriber is not missing any event when it is caught up
+func (s *ServerImpl) catchUp(sb subscriber.Client) {
+	lagging, from := sb.GetLagging()
+	if !lagging {
+		return
+	}
+
+	if s.EventStore == nil {
+		sb.ClearLagging()
+		return
+	}
+
+	//the publisher skips the lagging subscriber, so the catch up is the only one pushing to it
+	next, caughtUp, err := s.pushStored(sb, from)
+	if err != nil || !caughtUp {
+		return
+	}
+
+	s.pubMux.Lock()
+	defer s.pubMux.Unlock()
+
+	_, caughtUp, err = s.pushStored(sb, next)
+	if err == nil && caughtUp {
+		sb.ClearLagging()
+	}
+}
+
+//pushStored pushes the stored events of the subscriber topic from the sequence, it returns the next
+//sequence to read and whether every stored event is pushed, the subscriber lags from the event
+//which does not fit its buffer
+func (s *ServerImpl) pushStored(sb subscriber.Client, from uint64) (uint64, bool, error) {
+	next, caughtUp := from, true
+	err := s.EventStore.Scan(from, func(rec *eventstore.Record) bool {
+		if rec.Kind != eventstore.KindPublished || rec.Topic != sb.GetTopicName() {
+			next = rec.Seq + 1
+			return true
+		}
+
+		//the block policy is not waited while catching up
+		err := sb.TryPushBack(Message{
+			Cmd:      CmdEvent,
+			Msg:      rec.Message,
+			Priority: subscriber.Priority(rec.Priority),
+			Data: EventMessage{
+				Event:         rec.Event,
+				UUID:          rec.UUID,
+				Seq:           rec.Seq,
+				Message:       rec.Message,
+				CorrelationID: rec.CorrelationID,
+				CausationID:   rec.CausationID,
+				ReplyTo:       rec.ReplyTo,
+				Payload:       rec.Payload,
+				TraceContext:  rec.TraceContext,
+			},
+		})
+		if err != nil {
+			caughtUp = false
+			return false
+		}
+
+		next = rec.Seq + 1
+		return true
+	})
+
+	//the pushed events are not read again
+	sb.SetLagging(next)
+	if err != nil {
+		s.getLogger().Error("unable to catch up subscriber", "subscriber", sb.GetName(), "error", err)
+		return next, false, err
+	}
+	return next, caughtUp, nil
+}
+
+//SetTopicOverflow sets overflow policy of the topic, it is applied to the existing and new subscribers
+func (s *ServerImpl) SetTopicOverflow(topic string, cfg subscriber.OverflowConfig) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	if s.TopicOverflow == nil {
+		s.TopicOverflow = make(map[string]subscriber.OverflowConfig)
+	}
+	s.TopicOverflow[topic] = cfg
+	s.mux.Unlock()
+
+	for _, sub := range s.Subscribers.ByTopic(topic) {
+		err := sub.SetOverflow(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//SetSubscriberOverflow sets overflow policy of a single subscriber
+func (s *ServerImpl) SetSubscriberOverflow(name string, cfg subscriber.OverflowConfig) error {
+	sub, err := s.getSubscriber(name)
+	if err != nil {
+		return err
+	}
+	return sub.SetOverflow(cfg)
+}
+
+//newSubscriber creates the subscriber client with the topic overflow policy
+func (s *ServerImpl) newSubscriber(name, topic string, addr *net.UDPAddr) (subscriber.Client, error) {
+	maxBuffer := s.SubscriberBuffer
+	if maxBuffer <= 0 {
+		maxBuffer = MaxBuffer
+	}
+
+	prop := subscriber.Property{
+		Address:   addr,
+		Name:      name,
+		MaxBuffer: maxBuffer,
+		Topic:     topic,
+		Overflow:  s.getOverflow(topic),
+		Logger:    s.getLogger(),
+	}
+
+	if s.SpillDir != "" {
+		head := s.SpillHead
+		if head <= 0 || head > prop.MaxBuffer {
+			head = prop.MaxBuffer
+		}
+		return subscriber.NewSpillClient(prop, s.SpillDir, head)
+	}
+
+	return subscriber.NewClient(prop)
+}
+
+//SetRequestTimeout changes the timeout of the request without deadline
+func (s *ServerImpl) SetRequestTimeout(timeout time.Duration) {
+	s.mux.Lock()
+	s.RequestTimeout = timeout
+	s.mux.Unlock()
+}
+
+//SetAuthToken changes the token required on registration, the registered subscribers are kept
+func (s *ServerImpl) SetAuthToken(token string) {
+	s.mux.Lock()
+	s.AuthToken = token
+	s.mux.Unlock()
+}
+
+//Authorize checks the token of the registration, publish and admin command
+func (s *ServerImpl) Authorize(token string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.AuthToken == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(s.AuthToken), []byte(token)) == 1
+}
+
+//authorizeToken checks the token like Authorize, but nobody holds the token when the authentication is disabled
+func (s *ServerImpl) authorizeToken(token string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.AuthToken != "" && subtle.ConstantTimeCompare([]byte(s.AuthToken), []byte(token)) == 1
+}
+
+//getOverflow gets the overflow policy of the topic
+func (s *ServerImpl) getOverflow(topic string) subscriber.OverflowConfig {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.TopicOverflow[topic]
+}
+
+//Ack stores the processing result of the subscriber, it is used by the gateway for the sink subscribers
+func (s *ServerImpl) Ack(name string, ack AckMessage) error {
+	sub, err := s.getSubscriber(name)
+	if err != nil {
+		return err
+	}
+	sub.Touch()
+
+	kind := eventstore.KindProcessed
+	counter := &s.counter(sub.GetTopicName()).processed
+	if ack.Error != "" {
+		kind = eventstore.KindFailed
+		counter = &s.counter(sub.GetTopicName()).failed
+	}
+	atomic.AddUint64(counter, 1)
+	if ack.Error != "" {
+		s.getMetrics().Add(metrics.EventsFailed, 1, metrics.L("topic", sub.GetTopicName()))
+	} else {
+		s.getMetrics().Add(metrics.EventsProcessed, 1, metrics.L("topic", sub.GetTopicName()))
+	}
+
+	s.record(&eventstore.Record{
+		Kind:          kind,
+		UUID:          ack.UUID,
+		Topic:         sub.GetTopicName(),
+		Event:         ack.Event,
+		CorrelationID: ack.CorrelationID,
+		Source:        name,
+		Error:         ack.Error,
+	})
 	return nil
 }
 
+//record appends the record to event store when it is configured
+func (s *ServerImpl) record(rec *eventstore.Record) {
+	if s.EventStore == nil {
+		return
+	}
+
+	err := s.EventStore.Append(rec)
+	if err != nil {
+		s.getLogger().Error("unable to store event", "uuid", rec.UUID, "error", err)
+	}
+}
+
+//newEventID generates event id using the configured generator, fallback to the default one
+func (s *ServerImpl) newEventID() (string, error) {
+	if s.IDGen != nil {
+		return s.IDGen.NewID()
+	}
+	return util.NewID()
+}
+
 //handleEventBuffer reads the data from event buffer and send the data
 func (s *ServerImpl) handleEventBuffer(sb subscriber.Client, stopDispatchChan <-chan bool) {
+	//attempt is the failed sends of the front event
+	attempt := 0
 	for {
 		select {
 		case <-stopDispatchChan:
 			return
 		default:
-			if s.isStarted {
+			//detached or replaced subscriber stops its dispatch
+			if cur, ok := s.Subscribers.Get(sb.GetName()); !ok || cur != sb {
+				return
+			}
+
+			//paused subscriber keeps buffering the events until it is resumed
+			if sb.IsPaused() {
+				time.Sleep(time.Millisecond * 10)
+				continue
+			}
+
+			if s.started() {
+				if sb.GetBufferLen() == 0 {
+					s.catchUp(sb)
+				}
+
 				if sb.GetBufferLen() > 0 {
 					data, err := sb.PopFront()
 					if err != nil {
-						log.Println("pop fail", err.Error())
+						s.getLogger().Error("pop fail", "error", err)
 						continue
 					}
+					s.measureBuffer(sb)
 
-					msg, err := json.Marshal(data)
+					msg, err := s.encodeFor(sb, data)
 					if err != nil {
-						log.Println("marshall fail", err.Error())
-						sb.PushBack(msg)
+						s.getLogger().Error("marshall fail", "error", err)
 						continue
 					}
 
-					//perform send data through UDP
-					err = s.sendData(msg, sb.GetUDPAddr())
+					//perform send data through UDP or the sink, keep the order and priority on failure
+					topic := metrics.L("topic", sb.GetTopicName())
+					start := time.Now()
+					err = s.deliver(sb, msg)
+					s.getMetrics().Observe(metrics.SendDuration, since(start), topic)
 					if err != nil {
-						log.Println("send data fail", err.Error())
-						sb.PushBack(msg)
+						//the sink fails once it is detached, the event is not dead lettered
+						if cur, ok := s.Subscribers.Get(sb.GetName()); !ok || cur != sb {
+							return
+						}
+
+						s.getMetrics().Add(metrics.SendErrors, 1, topic)
+						attempt++
+						policy := s.getRetryPolicy()
+						if attempt >= policy.MaxAttempts {
+							s.deadLetter(sb, data, err, policy)
+							attempt = 0
+							continue
+						}
+
+						//the buffer filled up while sending, the event can not wait for the retry
+						pushErr := sb.PushFront(data)
+						if pushErr != nil {
+							s.deadLetter(sb, data, errors.New(fmt.Sprint(err.Error(), ", unable to retry ", pushErr.Error())), policy)
+							attempt = 0
+							continue
+						}
+
+						s.getLogger().Warn("send data fail", "subscriber", sb.GetName(), "error", err)
+						atomic.AddUint64(&s.counter(sb.GetTopicName()).retried, 1)
+						s.getMetrics().Add(metrics.EventsRetried, 1, topic)
+						select {
+						case <-stopDispatchChan:
+							return
+						case <-time.After(policy.backoff(attempt)):
+						}
 						continue
 					}
+					attempt = 0
+					atomic.AddUint64(&s.counter(sb.GetTopicName()).delivered, 1)
+					s.getMetrics().Add(metrics.EventsDispatched, 1, topic)
 				}
 			}
 		}
@@ -194,36 +840,63 @@ func (s *ServerImpl) handleEventBuffer(sb subscriber.Client, stopDispatchChan <-
 
 //registerSubscriber register new clients, add to pool
 func (s *ServerImpl) registerSubscriber(name string, addr *net.UDPAddr) error {
-	if _, ok := s.Subscribers[name]; !ok {
+	if _, ok := s.Subscribers.Get(name); !ok {
 		client, err := subscriber.NewClient(subscriber.Property{
 			Address:   addr,
 			Name:      name,
 			MaxBuffer: MaxBuffer,
+			Logger:    s.getLogger(),
 		})
 
 		if err != nil {
-			glog.ERROR.Println("create client fail", err.Error())
+			s.getLogger().Error("create client fail", "error", err)
 			return err
 		}
 
-		s.Subscribers[name] = client
-		return nil
+		return s.Subscribers.Add(name, client)
 	}
 
 	return errors.New("subscriber exists")
 }
 
+//isTopicSubscriber reports the registered subscriber of the topic
+func (s *ServerImpl) isTopicSubscriber(name, topic string) bool {
+	sub, ok := s.Subscribers.Get(name)
+	return ok && sub.GetTopicName() == topic
+}
+
 //getSubscriber gets the subscriber
 func (s *ServerImpl) getSubscriber(name string) (subscriber.Client, error) {
-	if s, ok := s.Subscribers[name]; ok {
+	if s, ok := s.Subscribers.Get(name); ok {
 		return s, nil
 	}
-	return nil, errors.New(fmt.Sprint("subsriber not found", name))
+	return nil, errors.New(fmt.Sprint("subscriber not found ", name))
 }
 
 //addSubscriber add subscriber to subscriber pool
-func (s *ServerImpl) addSubscriber(name string, subs subscriber.Client) {
-	s.Subscribers[name] = subs
+func (s *ServerImpl) addSubscriber(name string, subs subscriber.Client) error {
+	return s.Subscribers.Add(name, subs)
+}
+
+//deliverReply passes the reply to the waiting request, late or unknown replies are dropped
+//the reply is accepted from the subscriber of the requested topic or the holder of the auth token
+func (s *ServerImpl) deliverReply(reply ReplyMessage, addr *net.UDPAddr) error {
+	s.replyMux.Lock()
+	defer s.replyMux.Unlock()
+
+	req, ok := s.pending[reply.RequestID]
+	if !ok {
+		return errors.New(fmt.Sprint("no pending request for ", reply.RequestID))
+	}
+
+	name := fmt.Sprint(addr.IP.String(), ":", addr.Port)
+	if !s.isTopicSubscriber(name, req.topic) && !s.authorizeToken(reply.Token) {
+		return errors.New(fmt.Sprint("unauthorized reply from ", name, " for ", reply.RequestID))
+	}
+
+	delete(s.pending, reply.RequestID)
+	req.reply <- reply
+	return nil
 }
 
 //sendData sends the data through UDP
@@ -234,7 +907,7 @@ func (s *ServerImpl) sendData(msg []byte, addr *net.UDPAddr) error {
 			return err
 		}
 
-		glog.DEBUG.Println("sending to ", addr.String(), ":", string(msg))
+		s.getLogger().Debug("sending to", "address", addr.String(), "msg", string(msg))
 		return err
 	}
 	return errors.New("server unavailable")
@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/metrics"
+	"github.com/syariatifaris/genggar/subscriber"
+)
+
+func newTestServer(t *testing.T) *ServerImpl {
+	conn, err := net.ListenUDP(ProtoUDP, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &ServerImpl{
+		Proto:       ProtoUDP,
+		MsgBuff:     make([]byte, MaxBuffer),
+		ServerConn:  conn,
+		Subscribers: subscriber.NewRegistry(),
+		Logger:      logger.Nop{},
+	}
+}
+
+//newTestSink listens the events sent to the subscriber and discards them until the connection is closed
+func newTestSink(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP(ProtoUDP, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, MaxBuffer)
+		for {
+			_, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return conn
+}
+
+//TestServerConcurrentPublish runs the registration, publishing and dispatching together, it should be run with -race
+func TestServerConcurrentPublish(t *testing.T) {
+	const (
+		publishers  = 4
+		subscribers = 8
+		events      = 50
+	)
+
+	s := newTestServer(t)
+	sink := newTestSink(t)
+	defer sink.Close()
+
+	stopChan := make(chan bool)
+	var running sync.WaitGroup
+	running.Add(2)
+	go func() {
+		defer running.Done()
+		s.Start(stopChan)
+	}()
+	go func() {
+		defer running.Done()
+		s.DispatchEventPublisher(stopChan)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < subscribers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprint("sub-", i)
+			sub, err := s.newSubscriber(name, fmt.Sprint("topic-", i%2), sink.LocalAddr().(*net.UDPAddr))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := s.addSubscriber(name, sub); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				err := s.PublishEvent(fmt.Sprint("topic-", j%2), "created", fmt.Sprint(i, "-", j))
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < events; j++ {
+			s.Inspect()
+		}
+	}()
+	wg.Wait()
+
+	if s.Subscribers.Len() != subscribers {
+		t.Fatalf("got %d subscribers want %d", s.Subscribers.Len(), subscribers)
+	}
+
+	//every buffered event is dispatched
+	deadline := time.Now().Add(5 * time.Second)
+	for !buffersDrained(s) {
+		if time.Now().After(deadline) {
+			t.Fatal("events are not dispatched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stopChan)
+	running.Wait()
+
+	var published uint64
+	for _, topic := range s.Inspect().Topics {
+		published += topic.Published
+	}
+	if published != publishers*events {
+		t.Fatalf("got %d published events want %d", published, publishers*events)
+	}
+}
+
+func buffersDrained(s *ServerImpl) bool {
+	for _, sub := range s.Subscribers.Snapshot() {
+		if sub.GetBufferLen() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//TestServerStartStop checks the started flag is read by the dispatcher while the listener stops
+func TestServerStartStop(t *testing.T) {
+	s := newTestServer(t)
+
+	stopChan := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		s.Start(stopChan)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !s.started() {
+		if time.Now().After(deadline) {
+			t.Fatal("server is not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stopChan)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("server is not stopped")
+	}
+
+	if s.started() {
+		t.Fatal("server is started after stop")
+	}
+}
+
+//streamSink accepts every message
+type streamSink struct{}
+
+func (streamSink) Send(msg []byte) error { return nil }
+func (streamSink) Address() string       { return "stream" }
+
+func TestDetachSinkDeletesMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	s := newTestServer(t)
+	s.Metrics = registry
+
+	err := s.AttachSink("stream-1", "ORDER", 0, streamSink{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.PublishEvent("ORDER", "NEW_ORDER", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := `subscriber="stream-1"`
+	if !strings.Contains(string(registry.Text()), series) {
+		t.Fatal("buffer depth is not measured")
+	}
+
+	s.DetachSink("stream-1")
+	if strings.Contains(string(registry.Text()), series) {
+		t.Fatalf("buffer depth of the detached sink is kept\n%s", registry.Text())
+	}
+
+	//the detached subscriber is not measured again
+	sub, _ := s.newSubscriber("stream-1", "ORDER", nil)
+	s.measureBuffer(sub)
+	if strings.Contains(string(registry.Text()), series) {
+		t.Fatal("buffer depth of the detached sink is measured")
+	}
+}
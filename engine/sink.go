@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/subscriber"
+)
+
+//Sink delivers the dispatched messages of the subscriber which is not connected through udp,
+//such as the http stream of the gateway, msg is the json encoded Message
+type Sink interface {
+	Send(msg []byte) error
+	Address() string
+}
+
+//AttachSink registers the sink as subscriber of the topic, it is buffered and dispatched like the udp
+//subscriber with the topic overflow policy, a failed send is retried
+//fromSeq replays the stored events from the sequence first, zero starts from the new events
+func (s *ServerImpl) AttachSink(name, topic string, fromSeq uint64, sink Sink) error {
+	if name == "" || topic == "" {
+		return errors.New("sink name and topic are required")
+	}
+
+	if sink == nil {
+		return errors.New("sink is nil")
+	}
+
+	client, err := s.newSubscriber(name, topic, nil)
+	if err != nil {
+		return err
+	}
+
+	if fromSeq > 0 {
+		client.SetLagging(fromSeq)
+	}
+
+	s.sinkMux.Lock()
+	defer s.sinkMux.Unlock()
+
+	err = s.addSubscriber(name, client)
+	if err != nil {
+		return errors.New(fmt.Sprint("unable to attach sink ", err.Error()))
+	}
+
+	if s.sinks == nil {
+		s.sinks = make(map[string]Sink)
+	}
+	s.sinks[name] = sink
+	return nil
+}
+
+//DetachSink removes the sink subscriber, its buffered events are discarded
+func (s *ServerImpl) DetachSink(name string) {
+	s.sinkMux.Lock()
+	defer s.sinkMux.Unlock()
+
+	if _, ok := s.sinks[name]; !ok {
+		return
+	}
+
+	delete(s.sinks, name)
+	if sub, ok := s.Subscribers.Get(name); ok {
+		//keep the dropped events in the topic counter
+		atomic.AddUint64(&s.counter(sub.GetTopicName()).dropped, sub.GetDropped())
+		s.Subscribers.Remove(name)
+		s.forgetBuffer(sub)
+	}
+}
+
+func (s *ServerImpl) getSink(name string) Sink {
+	s.sinkMux.RLock()
+	defer s.sinkMux.RUnlock()
+	return s.sinks[name]
+}
+
+//encodeFor encodes the buffered data with the codec and the frame version of the subscriber
+//the sink always gets unframed json
+func (s *ServerImpl) encodeFor(sb subscriber.Client, data interface{}) ([]byte, error) {
+	if s.getSink(sb.GetName()) != nil {
+		return encodeMessage(codec.JSON{}, 0, data)
+	}
+	return encodeMessage(s.getCodec(sb), sb.GetProtocolVersion(), data)
+}
+
+//deliver sends the message to the sink of the subscriber, or through udp
+func (s *ServerImpl) deliver(sb subscriber.Client, msg []byte) error {
+	if sink := s.getSink(sb.GetName()); sink != nil {
+		return sink.Send(msg)
+	}
+	return s.sendData(msg, sb.GetUDPAddr())
+}
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/syariatifaris/genggar/tracing"
+)
+
+//getTracer returns the configured tracer, nothing is traced when it is not set
+func (s *ServerImpl) getTracer() tracing.Tracer {
+	if s.Tracer == nil {
+		return tracing.Nop{}
+	}
+	return s.Tracer
+}
+
+//traceContext returns the trace headers of ctx, it is nil when ctx is not traced
+func (s *ServerImpl) traceContext(ctx context.Context) tracing.Headers {
+	return injectTrace(s.getTracer(), ctx)
+}
+
+func (c *ClientImpl) getTracer() tracing.Tracer {
+	if c.Tracer == nil {
+		return tracing.Nop{}
+	}
+	return c.Tracer
+}
+
+func injectTrace(tracer tracing.Tracer, ctx context.Context) tracing.Headers {
+	if ctx == nil {
+		return nil
+	}
+
+	headers := make(tracing.Headers)
+	tracer.Inject(ctx, headers)
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
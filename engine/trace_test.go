@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/tracing"
+)
+
+//newTraceClient creates the client connected to the returned conn, which receives the client messages
+func newTraceClient(t *testing.T, tracer tracing.Tracer) (*ClientImpl, *net.UDPConn) {
+	server, err := net.ListenUDP(ProtoUDP, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.DialUDP(ProtoUDP, nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &ClientImpl{
+		Proto:      ProtoUDP,
+		Topic:      "ORDER",
+		ClientConn: conn,
+		Tracer:     tracer,
+		Logger:     logger.Nop{},
+	}, server
+}
+
+//readPublish reads the client messages until the publish message
+func readPublish(t *testing.T, conn *net.UDPConn) *PublishMessage {
+	buf := make([]byte, MaxBuffer)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message, _, err := decodeMessage(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Cmd != CmdPublish {
+			continue
+		}
+
+		var pMsg PublishMessage
+		err = remarshal(message.Data, &pMsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &pMsg
+	}
+}
+
+func TestPublishFromProcessorSpan(t *testing.T) {
+	var spans []*tracing.SpanData
+	tracer := &tracing.W3C{OnEnd: func(span *tracing.SpanData) {
+		spans = append(spans, span)
+	}}
+
+	client, conn := newTraceClient(t, tracer)
+	client.Processors = []*EventProcessor{{
+		Events: []string{"NEW_ORDER"},
+		ContextCallback: func(ctx context.Context, topic, event string, data interface{}) error {
+			cause, err := ParseEvent(data)
+			if err != nil {
+				return err
+			}
+			return client.PublishFrom(ctx, cause, "STOCK", "STOCK_RESERVED", "stock reserved")
+		},
+	}}
+
+	parentCtx, _ := tracer.Start(context.Background(), "publish", nil)
+	parent := make(tracing.Headers)
+	tracer.Inject(parentCtx, parent)
+
+	msg, err := encodeMessage(codec.JSON{}, codec.FrameVersion, Message{
+		Cmd: CmdEvent,
+		Data: EventMessage{
+			Event:         "NEW_ORDER",
+			UUID:          "order-1",
+			CorrelationID: "order-1",
+			TraceContext:  parent,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processor, err := getProcessor(&property{msg: msg, client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = processor.exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spans) != 1 {
+		t.Fatalf("got %d processor spans want 1", len(spans))
+	}
+
+	pMsg := readPublish(t, conn)
+	if pMsg.CausationID != "order-1" || pMsg.CorrelationID != "order-1" {
+		t.Fatalf("unexpected correlation %+v", pMsg)
+	}
+
+	want := spans[0].SpanContext.TraceParent()
+	if got := pMsg.TraceContext[tracing.HeaderTraceParent]; got != want {
+		t.Fatalf("published event is not the child of the processor span, got %s want %s", got, want)
+	}
+}
+
+func TestPublishFromCauseTrace(t *testing.T) {
+	client, conn := newTraceClient(t, &tracing.W3C{})
+
+	cause := &EventMessage{
+		UUID:         "order-1",
+		TraceContext: tracing.Headers{tracing.HeaderTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}
+
+	err := client.PublishFrom(context.Background(), cause, "STOCK", "STOCK_RESERVED", "stock reserved")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pMsg := readPublish(t, conn)
+	if got := pMsg.TraceContext[tracing.HeaderTraceParent]; got != cause.TraceContext[tracing.HeaderTraceParent] {
+		t.Fatalf("untraced context should keep the cause trace, got %s", got)
+	}
+	if pMsg.CorrelationID != "order-1" {
+		t.Fatalf("got correlation %s want order-1", pMsg.CorrelationID)
+	}
+}
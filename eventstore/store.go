@@ -0,0 +1,389 @@
+package eventstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	//KindPublished event is published to the topic
+	KindPublished Kind = "PUBLISHED"
+	//KindProcessed event is processed by the subscriber
+	KindProcessed Kind = "PROCESSED"
+	//KindFailed subscriber fails to process the event
+	KindFailed Kind = "FAILED"
+	//KindScheduled event is scheduled to be published later
+	KindScheduled Kind = "SCHEDULED"
+	//KindFired scheduled event is published
+	KindFired Kind = "FIRED"
+	//KindCancelled scheduled event is cancelled
+	KindCancelled Kind = "CANCELLED"
+	//KindDeadLettered event could not be delivered to the subscriber after the retries
+	KindDeadLettered Kind = "DEAD_LETTERED"
+)
+
+//Record is a single entry of the event history
+type Record struct {
+	Seq           uint64     `json:"seq"`
+	Kind          Kind       `json:"kind"`
+	UUID          string     `json:"uuid"`
+	Topic         string     `json:"topic"`
+	Event         string     `json:"event"`
+	Message       string     `json:"message,omitempty"`
+	CorrelationID string     `json:"correlation_id,omitempty"`
+	CausationID   string     `json:"causation_id,omitempty"`
+	Source        string     `json:"source,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	ScheduleID    string     `json:"schedule_id,omitempty"`
+	DeliverAt     *time.Time `json:"deliver_at,omitempty"`
+	Cron          string     `json:"cron,omitempty"`
+	//TraceContext is the w3c trace context of the published event
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+	//Priority, ReplyTo and Payload of the published event are kept so the replayed event is the same
+	Priority int         `json:"priority,omitempty"`
+	ReplyTo  string      `json:"reply_to,omitempty"`
+	Payload  interface{} `json:"payload,omitempty"`
+	Time     time.Time   `json:"time"`
+}
+
+//Store keeps the event history
+type Store interface {
+	Append(rec *Record) error
+	ByCorrelation(correlationID string) ([]*Record, error)
+	Scan(fromSeq uint64, fn func(rec *Record) bool) error
+}
+
+//indexStep is the number of records between the indexed offsets of the log file
+const indexStep = 1024
+
+//FileStore appends the records as json lines into a single file
+type FileStore struct {
+	mux  sync.Mutex
+	file *os.File
+	seq  uint64
+
+	//size is the length of the written records, index has the offset of every indexStep record,
+	//so the scan from a sequence does not read the log from the beginning
+	size      int64
+	index     []offset
+	unindexed int
+}
+
+//offset is the position of the record in the log file
+type offset struct {
+	seq uint64
+	pos int64
+}
+
+//NewFileStore opens or creates the event log file, the sequence continues from the last record
+func NewFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FileStore{
+		file: file,
+	}
+
+	err = f.load()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+//Append assigns the sequence and writes the record
+func (f *FileStore) Append(rec *Record) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	rec.Seq = f.seq + 1
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.New(fmt.Sprint("marshall record fail ", err.Error()))
+	}
+
+	n, err := f.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+
+	f.addOffset(rec.Seq, f.size)
+	f.size += int64(n)
+	f.seq = rec.Seq
+	return nil
+}
+
+//ByCorrelation reads all records having the correlation id, ordered by sequence
+func (f *FileStore) ByCorrelation(correlationID string) ([]*Record, error) {
+	var records []*Record
+	err := f.Scan(0, func(rec *Record) bool {
+		if rec.CorrelationID == correlationID {
+			records = append(records, rec)
+		}
+		return true
+	})
+
+	return records, err
+}
+
+//Scan reads the records having sequence greater or equal to fromSeq until fn returns false
+//the log is read without holding the store, the records appended during the scan are not read
+func (f *FileStore) Scan(fromSeq uint64, fn func(rec *Record) bool) error {
+	f.mux.Lock()
+	//the opened file is still readable when the log is replaced by Compact
+	reader, err := os.Open(f.file.Name())
+	pos, size := f.offsetOf(fromSeq), f.size
+	f.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return readRecords(reader, pos, size, func(rec *Record, _ int64) bool {
+		if rec.Seq < fromSeq {
+			return true
+		}
+		return fn(rec)
+	})
+}
+
+//Compact removes the records older than before, the schedule records are kept so the pending
+//schedules are still loaded after restart, the sequence is not changed
+func (f *FileStore) Compact(before time.Time) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	path := f.file.Name()
+	tmp, err := os.OpenFile(path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	var writeErr error
+	writer := bufio.NewWriter(tmp)
+	err = f.scan(func(rec *Record) bool {
+		if rec.Time.Before(before) && rec.ScheduleID == "" {
+			removed++
+			return true
+		}
+
+		var data []byte
+		data, writeErr = json.Marshal(rec)
+		if writeErr != nil {
+			return false
+		}
+		_, writeErr = writer.Write(append(data, '\n'))
+		return writeErr == nil
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, errors.New(fmt.Sprint("compact fail ", err.Error()))
+	}
+	tmp.Close()
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, errors.New(fmt.Sprint("compact fail ", err.Error()))
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	f.file.Close()
+	f.file = file
+
+	//the offsets are moved by the removed records
+	seq := f.seq
+	err = f.load()
+	f.seq = seq
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+//Close closes the event log file
+func (f *FileStore) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.file.Close()
+}
+
+//load reads the sequence, the size and the offsets of the log
+func (f *FileStore) load() error {
+	reader, err := os.Open(f.file.Name())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	info, err := reader.Stat()
+	if err != nil {
+		return err
+	}
+
+	f.seq, f.size, f.index, f.unindexed = 0, info.Size(), nil, 0
+	return readRecords(reader, 0, f.size, func(rec *Record, pos int64) bool {
+		f.addOffset(rec.Seq, pos)
+		f.seq = rec.Seq
+		return true
+	})
+}
+
+//addOffset indexes every indexStep record and counts the read or written records
+func (f *FileStore) addOffset(seq uint64, pos int64) {
+	if f.unindexed == 0 {
+		f.index = append(f.index, offset{seq: seq, pos: pos})
+	}
+	f.unindexed = (f.unindexed + 1) % indexStep
+}
+
+//offsetOf returns the position of the last indexed record before the sequence
+func (f *FileStore) offsetOf(seq uint64) int64 {
+	i := sort.Search(len(f.index), func(i int) bool {
+		return f.index[i].seq > seq
+	})
+	if i == 0 {
+		return 0
+	}
+	return f.index[i-1].pos
+}
+
+//scan reads the log from the beginning until fn returns false, the caller holds the store
+func (f *FileStore) scan(fn func(rec *Record) bool) error {
+	reader, err := os.Open(f.file.Name())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return readRecords(reader, 0, f.size, func(rec *Record, _ int64) bool {
+		return fn(rec)
+	})
+}
+
+//readRecords reads the records between pos and size until fn returns false, fn receives the position of the record
+func readRecords(file *os.File, pos, size int64, fn func(rec *Record, pos int64) bool) error {
+	reader := io.NewSectionReader(file, pos, size-pos)
+
+	//read is the position after the line returned by the scanner
+	read := pos
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		read += int64(advance)
+		return advance, token, err
+	})
+
+	start := pos
+	for scanner.Scan() {
+		line := start
+		start = read
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec Record
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return errors.New(fmt.Sprint("corrupted record ", err.Error()))
+		}
+
+		if !fn(&rec, line) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+//MemoryStore keeps the records in memory
+type MemoryStore struct {
+	mux     sync.Mutex
+	records []Record
+}
+
+//NewMemoryStore creates in memory event store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+//Append assigns the sequence and stores copy of the record
+func (m *MemoryStore) Append(rec *Record) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	rec.Seq = uint64(len(m.records)) + 1
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+
+	m.records = append(m.records, *rec)
+	return nil
+}
+
+//ByCorrelation gets all records having the correlation id, ordered by sequence
+func (m *MemoryStore) ByCorrelation(correlationID string) ([]*Record, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var records []*Record
+	for _, rec := range m.records {
+		if rec.CorrelationID == correlationID {
+			rec := rec
+			records = append(records, &rec)
+		}
+	}
+
+	return records, nil
+}
+
+//Scan reads the records having sequence greater or equal to fromSeq until fn returns false
+//the records appended during the scan are not read
+func (m *MemoryStore) Scan(fromSeq uint64, fn func(rec *Record) bool) error {
+	m.mux.Lock()
+	records := make([]Record, len(m.records))
+	copy(records, m.records)
+	m.mux.Unlock()
+
+	for _, rec := range records {
+		if rec.Seq < fromSeq {
+			continue
+		}
+
+		rec := rec
+		if !fn(&rec) {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package eventstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestFileStore(t *testing.T) (*FileStore, string) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, path
+}
+
+//scanSeqs returns the sequences read from the sequence
+func scanSeqs(t *testing.T, store Store, from uint64, limit int) []uint64 {
+	var seqs []uint64
+	err := store.Scan(from, func(rec *Record) bool {
+		seqs = append(seqs, rec.Seq)
+		return len(seqs) < limit
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return seqs
+}
+
+//TestFileStoreScanFrom reads from the indexed offsets, before and after the log is reopened and compacted
+func TestFileStoreScanFrom(t *testing.T) {
+	store, path := newTestFileStore(t)
+
+	total := uint64(3*indexStep + 10)
+	for i := uint64(0); i < total; i++ {
+		err := store.Append(&Record{Kind: KindPublished, Topic: "ORDER", Event: "NEW_ORDER"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	tests := []struct {
+		name string
+		from uint64
+	}{
+		{"beginning", 0},
+		{"first", 1},
+		{"inside first step", 10},
+		{"indexed", indexStep + 1},
+		{"after indexed", indexStep + 2},
+		{"before indexed", 2 * indexStep},
+		{"last", total},
+		{"after last", total + 1},
+	}
+
+	for _, test := range tests {
+		for name, s := range map[string]*FileStore{"written": store, "reopened": reopened} {
+			t.Run(name+"/"+test.name, func(t *testing.T) {
+				seqs := scanSeqs(t, s, test.from, 3)
+
+				first := test.from
+				if first == 0 {
+					first = 1
+				}
+				for i, seq := range seqs {
+					if seq != first+uint64(i) {
+						t.Fatalf("got %v from %d", seqs, test.from)
+					}
+				}
+				if test.from <= total && len(seqs) == 0 {
+					t.Fatalf("nothing is read from %d", test.from)
+				}
+			})
+		}
+	}
+
+	//the removed records move the offsets
+	err = store.Append(&Record{Kind: KindScheduled, ScheduleID: "schedule-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := store.Compact(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != int(total) {
+		t.Fatalf("got %d removed want %d", removed, total)
+	}
+
+	seqs := scanSeqs(t, store, total, 10)
+	if len(seqs) != 1 || seqs[0] != total+1 {
+		t.Fatalf("got %v after compact", seqs)
+	}
+
+	rec := &Record{Kind: KindPublished}
+	err = store.Append(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Seq != total+2 {
+		t.Fatalf("got sequence %d after compact", rec.Seq)
+	}
+	if seqs := scanSeqs(t, store, total+2, 10); len(seqs) != 1 || seqs[0] != total+2 {
+		t.Fatalf("got %v after append", seqs)
+	}
+}
+
+//TestFileStoreScanAppend checks the records appended by fn are not read and the store is not held
+func TestFileStoreScanAppend(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	for i := 0; i < 3; i++ {
+		err := store.Append(&Record{Kind: KindPublished})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := 0
+	err := store.Scan(0, func(rec *Record) bool {
+		read++
+		return store.Append(&Record{Kind: KindPublished}) == nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != 3 {
+		t.Fatalf("got %d records read want 3", read)
+	}
+}
+
+//roundTripRecords is the history of two correlated event chains
+func roundTripRecords() []*Record {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []*Record{
+		{Kind: KindPublished, UUID: "e1", Topic: "ORDER", Event: "NEW_ORDER", Message: "order-1", CorrelationID: "c1", Priority: 2, ReplyTo: "ORDER_REPLY", Payload: "data", TraceContext: map[string]string{"traceparent": "00-01-02-01"}},
+		{Kind: KindProcessed, UUID: "e1", Topic: "ORDER", Event: "NEW_ORDER", CorrelationID: "c1", Source: "stock"},
+		{Kind: KindPublished, UUID: "e2", Topic: "ORDER", Event: "NEW_ORDER", Message: "order-2", CorrelationID: "c2"},
+		{Kind: KindFailed, UUID: "e1", Topic: "ORDER", Event: "NEW_ORDER", CorrelationID: "c1", Source: "payment", Error: "declined"},
+		{Kind: KindScheduled, Topic: "ORDER", Event: "REMIND", ScheduleID: "s1", DeliverAt: &at, Cron: "@daily"},
+		{Kind: KindPublished, UUID: "e3", Topic: "STOCK", Event: "RELEASE_STOCK", CorrelationID: "c1", CausationID: "e1", Time: at},
+	}
+}
+
+//sameRecord compares the stored fields, the time is compared by instant
+func sameRecord(got, want *Record) bool {
+	if got.Seq != want.Seq || got.Kind != want.Kind || got.UUID != want.UUID || got.Topic != want.Topic ||
+		got.Event != want.Event || got.Message != want.Message || got.CorrelationID != want.CorrelationID ||
+		got.CausationID != want.CausationID || got.Source != want.Source || got.Error != want.Error ||
+		got.ScheduleID != want.ScheduleID || got.Cron != want.Cron || got.Priority != want.Priority ||
+		got.ReplyTo != want.ReplyTo || got.Payload != want.Payload || !got.Time.Equal(want.Time) {
+		return false
+	}
+	if (got.DeliverAt == nil) != (want.DeliverAt == nil) || got.DeliverAt != nil && !got.DeliverAt.Equal(*want.DeliverAt) {
+		return false
+	}
+	if len(got.TraceContext) != len(want.TraceContext) {
+		return false
+	}
+	for k, v := range want.TraceContext {
+		if got.TraceContext[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+//TestStoreRoundTrip checks the appended records are read back by Scan and ByCorrelation, the file store after reopen as well
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	stores := []struct {
+		name  string
+		open  func() Store
+		close func(s Store)
+	}{
+		{
+			name: "memory",
+			open: func() Store {
+				return NewMemoryStore()
+			},
+			close: func(s Store) {},
+		},
+		{
+			name: "file",
+			open: func() Store {
+				store, err := NewFileStore(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return store
+			},
+			close: func(s Store) {
+				s.(*FileStore).Close()
+			},
+		},
+	}
+
+	for _, st := range stores {
+		t.Run(st.name, func(t *testing.T) {
+			store := st.open()
+			records := roundTripRecords()
+			for i, rec := range records {
+				err := store.Append(rec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rec.Seq != uint64(i+1) || rec.Time.IsZero() {
+					t.Fatalf("got sequence %d at %v", rec.Seq, rec.Time)
+				}
+			}
+
+			check := func(t *testing.T, store Store) {
+				var read []*Record
+				err := store.Scan(0, func(rec *Record) bool {
+					read = append(read, rec)
+					return true
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(read) != len(records) {
+					t.Fatalf("got %d records want %d", len(read), len(records))
+				}
+				for i := range records {
+					if !sameRecord(read[i], records[i]) {
+						t.Fatalf("got %+v want %+v", read[i], records[i])
+					}
+				}
+
+				tests := []struct {
+					correlation string
+					seqs        []uint64
+				}{
+					{"c1", []uint64{1, 2, 4, 6}},
+					{"c2", []uint64{3}},
+					{"c3", nil},
+				}
+				for _, test := range tests {
+					chain, err := store.ByCorrelation(test.correlation)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(chain) != len(test.seqs) {
+						t.Fatalf("got %d records of %s want %v", len(chain), test.correlation, test.seqs)
+					}
+					for i, seq := range test.seqs {
+						if !sameRecord(chain[i], records[seq-1]) {
+							t.Fatalf("got %+v want %+v", chain[i], records[seq-1])
+						}
+					}
+				}
+			}
+			check(t, store)
+			st.close(store)
+
+			if st.name != "file" {
+				return
+			}
+
+			//the reopened log has the same history and continues the sequence
+			store = st.open()
+			defer st.close(store)
+			check(t, store)
+
+			rec := &Record{Kind: KindPublished, CorrelationID: "c2"}
+			err := store.Append(rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Seq != uint64(len(records)+1) {
+				t.Fatalf("got sequence %d after reopen", rec.Seq)
+			}
+		})
+	}
+}
@@ -40,7 +40,10 @@ func main() {
 	stopChan := make(chan bool)
 	wg.Add(1)
 	go func() {
-		client.StartListen(stopChan)
+		err := client.StartListen(stopChan)
+		if err != nil {
+			glog.ERROR.Fatalln("client err", err.Error())
+		}
 	}()
 
 	wg.Add(1)
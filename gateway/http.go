@@ -0,0 +1,439 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/subscriber"
+	"github.com/syariatifaris/genggar/util"
+)
+
+const (
+	//MaxPublishBody is the max size of the publish request body
+	MaxPublishBody = 1 << 20
+	//StreamHeartbeat is the interval of the comment line keeping the idle stream open
+	StreamHeartbeat = time.Second * 15
+)
+
+//HTTPGateway exposes the event server to the non go clients
+//
+//	POST /topics/{topic}/events          publishes {"event": "NAME", "data": {...}, "priority": 1}
+//	GET  /topics                         topics with their counters
+//	GET  /topics/{topic}                 topic counters and its subscribers
+//	GET  /topics/{topic}/stream          server sent events of the topic, ?events=A,B&from=seq
+//	GET  /subscribers                    subscribers state
+//	POST /subscribers/{name}/pause       holds the dispatch to the subscriber
+//	POST /subscribers/{name}/resume      continues the dispatch to the subscriber
+//	GET  /stats                          topics and subscribers
+//	GET  /ws                             websocket subscriber, see webSocket
+//
+//When the server has an auth token, the request needs "Authorization: Bearer <token>" header
+//or token query parameter, the latter is for the browser EventSource which can not set header
+type HTTPGateway struct {
+	//CheckOrigin allows the websocket from other origin, nil allows the same origin only
+	CheckOrigin func(r *http.Request) bool
+	//Logger receives the gateway logs, logger.Glog is used when it is not set
+	Logger logger.Logger
+
+	server engine.Server
+}
+
+//NewHTTPGateway creates http handler of the server, the event stream uses the server dispatcher
+//so DispatchEventPublisher should be running
+func NewHTTPGateway(server engine.Server) *HTTPGateway {
+	return &HTTPGateway{
+		server: server,
+	}
+}
+
+type publishRequest struct {
+	Event    string              `json:"event"`
+	Data     json.RawMessage     `json:"data,omitempty"`
+	Priority subscriber.Priority `json:"priority,omitempty"`
+}
+
+//publishResponse lists the subscribers failed to receive the published event
+type publishResponse struct {
+	Status string   `json:"status"`
+	Failed []string `json:"failed,omitempty"`
+}
+
+type topicResponse struct {
+	Topic       engine.TopicInfo        `json:"topic"`
+	Subscribers []engine.SubscriberInfo `json:"subscribers"`
+}
+
+//streamEvent is the data of the server sent event, data is the published json message
+type streamEvent struct {
+	Seq           uint64          `json:"seq,omitempty"`
+	Topic         string          `json:"topic"`
+	Event         string          `json:"event"`
+	UUID          string          `json:"uuid"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	CausationID   string          `json:"causation_id,omitempty"`
+	Data          json.RawMessage `json:"data,omitempty"`
+}
+
+func (g *HTTPGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	authorized := g.server.Authorize(requestToken(r))
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	//websocket client may authorize with the token of the registration
+	if len(parts) == 1 && parts[0] == "ws" {
+		g.webSocket(w, r, authorized)
+		return
+	}
+
+	if !authorized {
+		g.writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "stats":
+		g.get(w, r, func() interface{} {
+			return g.server.Inspect()
+		})
+	case len(parts) == 1 && parts[0] == "topics":
+		g.get(w, r, func() interface{} {
+			return g.server.Inspect().Topics
+		})
+	case len(parts) == 1 && parts[0] == "subscribers":
+		g.get(w, r, func() interface{} {
+			return g.server.Inspect().Subscribers
+		})
+	case len(parts) == 2 && parts[0] == "topics":
+		g.get(w, r, func() interface{} {
+			return g.topic(parts[1])
+		})
+	case len(parts) == 3 && parts[0] == "topics" && parts[2] == "events":
+		g.publish(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "topics" && parts[2] == "stream":
+		g.stream(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "subscribers" && (parts[2] == "pause" || parts[2] == "resume"):
+		g.setPaused(w, r, parts[1], parts[2] == "pause")
+	default:
+		g.writeError(w, http.StatusNotFound, errors.New(fmt.Sprint("not found ", r.URL.Path)))
+	}
+}
+
+func (g *HTTPGateway) get(w http.ResponseWriter, r *http.Request, fn func() interface{}) {
+	if r.Method != http.MethodGet {
+		g.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	g.writeJSON(w, http.StatusOK, fn())
+}
+
+//topic gets the topic counters and subscribers, the unknown topic has zero counters
+func (g *HTTPGateway) topic(name string) *topicResponse {
+	result := g.server.Inspect()
+	resp := &topicResponse{
+		Topic:       engine.TopicInfo{Name: name},
+		Subscribers: []engine.SubscriberInfo{},
+	}
+
+	for _, topic := range result.Topics {
+		if topic.Name == name {
+			resp.Topic = topic
+		}
+	}
+
+	for _, sub := range result.Subscribers {
+		if sub.Topic == name {
+			resp.Subscribers = append(resp.Subscribers, sub)
+		}
+	}
+	return resp
+}
+
+//publish publishes the event, the event message is the json data
+func (g *HTTPGateway) publish(w http.ResponseWriter, r *http.Request, topic string) {
+	if r.Method != http.MethodPost {
+		g.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var req publishRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxPublishBody)).Decode(&req)
+	if err != nil {
+		g.writeError(w, http.StatusBadRequest, errors.New(fmt.Sprint("invalid publish request ", err.Error())))
+		return
+	}
+
+	if req.Event == "" {
+		g.writeError(w, http.StatusBadRequest, errors.New("event is required"))
+		return
+	}
+
+	var message bytes.Buffer
+	if len(req.Data) > 0 {
+		err = json.Compact(&message, req.Data)
+		if err != nil {
+			g.writeError(w, http.StatusBadRequest, errors.New(fmt.Sprint("invalid data ", err.Error())))
+			return
+		}
+	}
+
+	//the event rejected by some subscribers is still published to the others
+	err = g.server.PublishPriority(topic, req.Event, message.String(), req.Priority)
+	if fanOut, ok := err.(*engine.FanOutError); ok && fanOut.Delivered == 0 {
+		g.writeJSON(w, http.StatusServiceUnavailable, publishResponse{Status: "rejected", Failed: fanOut.Subscribers})
+		return
+	}
+	if fanOut, ok := err.(*engine.FanOutError); ok {
+		g.writeJSON(w, http.StatusAccepted, publishResponse{Status: "published", Failed: fanOut.Subscribers})
+		return
+	}
+	if err != nil {
+		g.writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusAccepted, publishResponse{Status: "published"})
+}
+
+func (g *HTTPGateway) setPaused(w http.ResponseWriter, r *http.Request, name string, paused bool) {
+	if r.Method != http.MethodPost {
+		g.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var err error
+	if paused {
+		err = g.server.PauseSubscriber(name)
+	} else {
+		err = g.server.ResumeSubscriber(name)
+	}
+	if err != nil {
+		g.writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, map[string]bool{"paused": paused})
+}
+
+//stream attaches the request as subscriber of the topic and writes the events as server sent events
+//the event id is the store sequence, so the reconnecting EventSource continues from Last-Event-ID
+func (g *HTTPGateway) stream(w http.ResponseWriter, r *http.Request, topic string) {
+	if r.Method != http.MethodGet {
+		g.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		g.writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	fromSeq, err := streamOffset(r)
+	if err != nil {
+		g.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := util.NewID()
+	if err != nil {
+		g.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	sink := &sseSink{
+		w:       w,
+		flusher: flusher,
+		topic:   topic,
+		addr:    r.RemoteAddr,
+		events:  splitList(r.URL.Query().Get("events")),
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	name := fmt.Sprint("sse:", id)
+	err = g.server.AttachSink(name, topic, fromSeq, sink)
+	if err != nil {
+		g.getLogger().Error("unable to attach stream", "stream", name, "error", err)
+		return
+	}
+	defer g.server.DetachSink(name)
+	defer sink.close()
+
+	g.getLogger().Debug("stream attached", "stream", name, "topic", topic, "remote", r.RemoteAddr)
+	ticker := time.NewTicker(StreamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			g.getLogger().Debug("stream detached", "stream", name)
+			return
+		case <-ticker.C:
+			if sink.heartbeat() != nil {
+				return
+			}
+		}
+	}
+}
+
+//sseSink writes the dispatched events to the response, it is closed before the handler returns
+type sseSink struct {
+	mux     sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	topic   string
+	addr    string
+	events  []string
+	closed  bool
+}
+
+func (s *sseSink) Send(msg []byte) error {
+	var message engine.Message
+	err := json.Unmarshal(msg, &message)
+	if err != nil {
+		return err
+	}
+
+	if message.Cmd != engine.CmdEvent {
+		return nil
+	}
+
+	evt, err := engine.ParseEvent(message.Data)
+	if err != nil {
+		return err
+	}
+
+	if len(s.events) > 0 && !util.InArrayStr(evt.Event, s.events) {
+		return nil
+	}
+
+	data := streamEvent{
+		Seq:           evt.Seq,
+		Topic:         s.topic,
+		Event:         evt.Event,
+		UUID:          evt.UUID,
+		CorrelationID: evt.CorrelationID,
+		CausationID:   evt.CausationID,
+	}
+	if json.Valid([]byte(evt.Message)) {
+		data.Data = json.RawMessage(evt.Message)
+	} else if evt.Message != "" {
+		data.Data, _ = json.Marshal(evt.Message)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if evt.Seq > 0 {
+		fmt.Fprintf(&buf, "id: %d\n", evt.Seq)
+	}
+	fmt.Fprintf(&buf, "event: %s\ndata: %s\n\n", sseLine.Replace(evt.Event), raw)
+	return s.write(buf.Bytes())
+}
+
+//sseLine strips the line breaks, the event name can not add other fields to the stream
+var sseLine = strings.NewReplacer("\r", "", "\n", "")
+
+func (s *sseSink) Address() string {
+	return s.addr
+}
+
+func (s *sseSink) heartbeat() error {
+	return s.write([]byte(": ping\n\n"))
+}
+
+func (s *sseSink) write(data []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closed {
+		return errors.New("stream closed")
+	}
+
+	_, err := s.w.Write(data)
+	if err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseSink) close() {
+	s.mux.Lock()
+	s.closed = true
+	s.mux.Unlock()
+}
+
+//streamOffset reads the sequence to start from, Last-Event-ID continues after the last received event
+func streamOffset(r *http.Request) (uint64, error) {
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		seq, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			return 0, errors.New(fmt.Sprint("invalid Last-Event-ID ", lastID))
+		}
+		return seq + 1, nil
+	}
+
+	if from := r.URL.Query().Get("from"); from != "" {
+		seq, err := strconv.ParseUint(from, 10, 64)
+		if err != nil {
+			return 0, errors.New(fmt.Sprint("invalid from ", from))
+		}
+		return seq, nil
+	}
+
+	return 0, nil
+}
+
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (g *HTTPGateway) getLogger() logger.Logger {
+	if g.Logger == nil {
+		return logger.Glog{}
+	}
+	return g.Logger
+}
+
+func (g *HTTPGateway) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		g.getLogger().Error("unable to write response", "error", err)
+	}
+}
+
+func (g *HTTPGateway) writeError(w http.ResponseWriter, status int, err error) {
+	g.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
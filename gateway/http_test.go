@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/subscriber"
+)
+
+func newTestServer(t *testing.T) *engine.ServerImpl {
+	conn, err := net.ListenUDP(engine.ProtoUDP, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &engine.ServerImpl{
+		Proto:       engine.ProtoUDP,
+		MsgBuff:     make([]byte, engine.MaxBuffer),
+		ServerConn:  conn,
+		Subscribers: subscriber.NewRegistry(),
+		Logger:      logger.Nop{},
+	}
+}
+
+func addSubscriber(t *testing.T, s *engine.ServerImpl, name, topic string, full bool) {
+	c, err := subscriber.NewClient(subscriber.Property{
+		Name:      name,
+		Topic:     topic,
+		MaxBuffer: 1,
+		Logger:    logger.Nop{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if full {
+		c.PushBack(engine.Message{Cmd: engine.CmdEvent})
+		c.PushBack(engine.Message{Cmd: engine.CmdEvent})
+	}
+
+	err = s.Subscribers.Add(name, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name   string
+		full   string
+		status int
+		want   publishResponse
+	}{
+		{"delivered", "", http.StatusAccepted, publishResponse{Status: "published"}},
+		{"partially rejected", "b", http.StatusAccepted, publishResponse{Status: "published", Failed: []string{"b"}}},
+		{"rejected by every subscriber", "ab", http.StatusServiceUnavailable, publishResponse{Status: "rejected", Failed: []string{"a", "b"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t)
+			for _, name := range []string{"a", "b"} {
+				addSubscriber(t, s, name, "ORDER", strings.Contains(test.full, name))
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/topics/ORDER/events", strings.NewReader(`{"event": "NEW_ORDER", "data": {"order_id": 1}}`))
+			NewHTTPGateway(s).ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Fatalf("got status %d want %d, %s", w.Code, test.status, w.Body.String())
+			}
+
+			var resp publishResponse
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(resp.Failed)
+			if !reflect.DeepEqual(resp, test.want) {
+				t.Fatalf("got %+v want %+v", resp, test.want)
+			}
+		})
+	}
+}
+
+func TestPublishClosedServer(t *testing.T) {
+	s := newTestServer(t)
+	s.ServerConn = nil
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/topics/ORDER/events", strings.NewReader(`{"event": "NEW_ORDER"}`))
+	NewHTTPGateway(s).ServeHTTP(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+//TestStreamEventName checks the line breaks of the event name do not add fields to the stream
+func TestStreamEventName(t *testing.T) {
+	w := httptest.NewRecorder()
+	sink := &sseSink{w: w, flusher: w, topic: "ORDER"}
+
+	msg, err := json.Marshal(engine.Message{
+		Cmd: engine.CmdEvent,
+		Data: engine.EventMessage{
+			Event:   "NEW_ORDER\r\nid: 99\ndata: forged\nretry: 1",
+			Seq:     7,
+			Message: `{"order_id":1}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sink.Send(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got stream %q", w.Body.String())
+	}
+	if lines[0] != "id: 7" || lines[1] != "event: NEW_ORDERid: 99data: forgedretry: 1" || !strings.HasPrefix(lines[2], "data: ") {
+		t.Fatalf("got stream %q", w.Body.String())
+	}
+}
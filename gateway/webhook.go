@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/logger"
+)
+
+const (
+	//DefaultWebhookTimeout bounds the webhook request when the timeout is not set
+	DefaultWebhookTimeout = time.Second * 10
+
+	//HeaderSignature is "sha256=" followed by hex hmac of "<timestamp>.<body>" using the webhook secret
+	HeaderSignature = "X-Genggar-Signature"
+	//HeaderTimestamp is the unix time of the request, the receiver should reject the old one
+	HeaderTimestamp = "X-Genggar-Timestamp"
+	HeaderEvent     = "X-Genggar-Event"
+	HeaderDelivery  = "X-Genggar-Delivery"
+)
+
+//WebhookConfig is the http callback receiving the events of the topic
+type WebhookConfig struct {
+	URL     string
+	Secret  string
+	Timeout time.Duration
+	//Logger receives the webhook logs, logger.Glog is used when it is not set
+	Logger logger.Logger
+}
+
+//Webhook is the subscriber delivering the events by posting them to the url
+//2xx response is the event ack, other response or timeout is failed and sent again with the server retry policy
+type Webhook struct {
+	server engine.Server
+	name   string
+	topic  string
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+//AttachWebhook registers the webhook as subscriber of the topic, the subscriber name is "webhook:<name>"
+func AttachWebhook(server engine.Server, name, topic string, cfg WebhookConfig) (*Webhook, error) {
+	if name == "" {
+		return nil, errors.New("webhook name is required")
+	}
+
+	target, err := url.Parse(cfg.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New(fmt.Sprint("invalid webhook url ", cfg.URL))
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultWebhookTimeout
+	}
+
+	hook := &Webhook{
+		server: server,
+		name:   fmt.Sprint("webhook:", name),
+		topic:  topic,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+
+	err = server.AttachSink(hook.name, topic, 0, hook)
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+//Detach removes the webhook subscriber
+func (h *Webhook) Detach() {
+	h.server.DetachSink(h.name)
+}
+
+//Send posts the event, the body is signed when the webhook has a secret
+func (h *Webhook) Send(msg []byte) error {
+	var message engine.Message
+	err := json.Unmarshal(msg, &message)
+	if err != nil {
+		return err
+	}
+
+	if message.Cmd != engine.CmdEvent {
+		return nil
+	}
+
+	evt, err := engine.ParseEvent(message.Data)
+	if err != nil {
+		return err
+	}
+
+	data := streamEvent{
+		Seq:           evt.Seq,
+		Topic:         h.topic,
+		Event:         evt.Event,
+		UUID:          evt.UUID,
+		CorrelationID: evt.CorrelationID,
+		CausationID:   evt.CausationID,
+	}
+	if json.Valid([]byte(evt.Message)) {
+		data.Data = json.RawMessage(evt.Message)
+	} else if evt.Message != "" {
+		data.Data, _ = json.Marshal(evt.Message)
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, evt.Event)
+	req.Header.Set(HeaderDelivery, evt.UUID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	//the receiver continues the trace of the publisher
+	for key, val := range evt.TraceContext {
+		req.Header.Set(key, val)
+	}
+	if h.cfg.Secret != "" {
+		req.Header.Set(HeaderSignature, SignWebhook(h.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(fmt.Sprint("webhook responded ", resp.Status))
+	}
+
+	err = h.server.Ack(h.name, engine.AckMessage{
+		UUID:          evt.UUID,
+		Topic:         h.topic,
+		Event:         evt.Event,
+		CorrelationID: evt.CorrelationID,
+	})
+	if err != nil {
+		h.getLogger().Debug("unable to ack webhook", "webhook", h.name, "error", err)
+	}
+	return nil
+}
+
+func (h *Webhook) getLogger() logger.Logger {
+	if h.cfg.Logger == nil {
+		return logger.Glog{}
+	}
+	return h.cfg.Logger
+}
+
+func (h *Webhook) Address() string {
+	return h.cfg.URL
+}
+
+//SignWebhook returns the signature header value of the webhook body
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//VerifyWebhook checks the signature of the received webhook, it is used by the go receiver
+func VerifyWebhook(secret, timestamp, signature string, body []byte) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,252 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/util"
+)
+
+const (
+	//WebSocketWriteTimeout bounds a single frame write, the failed event is dispatched again
+	WebSocketWriteTimeout = time.Second * 10
+	//WebSocketPongTimeout closes the connection which does not answer the ping
+	WebSocketPongTimeout = time.Second * 60
+
+	wsPingInterval = WebSocketPongTimeout * 9 / 10
+)
+
+//AllowOrigins is HTTPGateway.CheckOrigin allowing the websocket from the origins, "*" allows any origin
+func AllowOrigins(origins ...string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || util.InArrayStr("*", origins) || util.InArrayStr(origin, origins)
+	}
+}
+
+//wsConn is a websocket subscriber connection, every registered topic is a sink subscriber
+//the frames are the protocol messages: the client sends [REG] and [ACK], the server sends [INF] and [EVT]
+type wsConn struct {
+	server     engine.Server
+	logger     logger.Logger
+	conn       *websocket.Conn
+	addr       string
+	id         string
+	authorized bool
+
+	writeMux sync.Mutex
+	mux      sync.Mutex
+	topics   map[string]string
+	closed   bool
+}
+
+//wsSink delivers the dispatched events of a topic to the connection
+type wsSink struct {
+	conn *wsConn
+}
+
+func (s *wsSink) Send(msg []byte) error {
+	return s.conn.write(msg)
+}
+
+func (s *wsSink) Address() string {
+	return s.conn.addr
+}
+
+//webSocket upgrades the request and serves the subscriber protocol until the connection is closed
+//authorized connection can register without token, otherwise [REG] should carry the token
+func (g *HTTPGateway) webSocket(w http.ResponseWriter, r *http.Request, authorized bool) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: g.CheckOrigin,
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		g.getLogger().Debug("websocket upgrade fail", "error", err)
+		return
+	}
+
+	id, err := util.NewID()
+	if err != nil {
+		conn.Close()
+		g.getLogger().Error("websocket id fail", "error", err)
+		return
+	}
+
+	ws := &wsConn{
+		server:     g.server,
+		logger:     g.getLogger(),
+		conn:       conn,
+		addr:       r.RemoteAddr,
+		id:         id,
+		authorized: authorized,
+		topics:     make(map[string]string),
+	}
+	defer ws.close()
+
+	go ws.ping()
+	ws.serve()
+}
+
+//serve reads the client frames, the unknown and invalid frames are answered with [INF]
+func (c *wsConn) serve() {
+	c.conn.SetReadDeadline(time.Now().Add(WebSocketPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(WebSocketPongTimeout))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				c.logger.Debug("websocket read fail", "remote", c.addr, "error", err)
+			}
+			return
+		}
+
+		c.conn.SetReadDeadline(time.Now().Add(WebSocketPongTimeout))
+
+		var message engine.Message
+		err = json.Unmarshal(data, &message)
+		if err != nil {
+			c.info(fmt.Sprint("invalid message ", err.Error()))
+			continue
+		}
+
+		switch message.Cmd {
+		case engine.CmdReg:
+			err = c.register(message.Data)
+		case engine.CmdAck:
+			err = c.ack(message.Data)
+		default:
+			err = errors.New(fmt.Sprint("unsupported command ", message.Cmd))
+		}
+
+		if err != nil {
+			c.logger.Debug("websocket command fail", "remote", c.addr, "error", err)
+			c.info(err.Error())
+		}
+	}
+}
+
+//register attaches the connection as subscriber of the topic, like the udp [REG] command
+func (c *wsConn) register(data interface{}) error {
+	var reg engine.RegisterMessage
+	raw, _ := json.Marshal(data)
+	err := json.Unmarshal(raw, &reg)
+	if err != nil {
+		return errors.New(fmt.Sprint("obtain topic fail ", err.Error()))
+	}
+
+	if reg.Topic == "" {
+		return errors.New("topic is required")
+	}
+
+	if !c.authorized && !c.server.Authorize(reg.Token) {
+		return errors.New("client registration rejected")
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		return errors.New("connection closed")
+	}
+
+	if _, ok := c.topics[reg.Topic]; ok {
+		return errors.New(fmt.Sprint("subscriber exists ", reg.Topic))
+	}
+
+	name := fmt.Sprint("ws:", c.id, ":", reg.Topic)
+	err = c.server.AttachSink(name, reg.Topic, reg.FromSeq, &wsSink{conn: c})
+	if err != nil {
+		return err
+	}
+
+	c.topics[reg.Topic] = name
+	c.info("client registration success")
+	return nil
+}
+
+//ack records the processing result of the event, the topic is optional when only one topic is registered
+func (c *wsConn) ack(data interface{}) error {
+	var ack engine.AckMessage
+	raw, _ := json.Marshal(data)
+	err := json.Unmarshal(raw, &ack)
+	if err != nil {
+		return errors.New(fmt.Sprint("obtain ack fail ", err.Error()))
+	}
+
+	c.mux.Lock()
+	name, ok := c.topics[ack.Topic]
+	if ack.Topic == "" && len(c.topics) == 1 {
+		for _, n := range c.topics {
+			name, ok = n, true
+		}
+	}
+	c.mux.Unlock()
+
+	if !ok {
+		return errors.New(fmt.Sprint("ack of unregistered topic ", ack.Topic))
+	}
+	return c.server.Ack(name, ack)
+}
+
+func (c *wsConn) info(msg string) {
+	data, err := json.Marshal(engine.Message{
+		Cmd: engine.CmdInfo,
+		Msg: msg,
+	})
+	if err != nil {
+		return
+	}
+
+	err = c.write(data)
+	if err != nil {
+		c.logger.Debug("websocket write fail", "remote", c.addr, "error", err)
+	}
+}
+
+func (c *wsConn) write(data []byte) error {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(WebSocketWriteTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+//ping keeps the idle connection open, it stops when the connection is closed
+func (c *wsConn) ping() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.writeMux.Lock()
+		err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WebSocketWriteTimeout))
+		c.writeMux.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+//close detaches every topic subscriber of the connection
+func (c *wsConn) close() {
+	c.mux.Lock()
+	c.closed = true
+	topics := c.topics
+	c.topics = nil
+	c.mux.Unlock()
+
+	for _, name := range topics {
+		c.server.DetachSink(name)
+	}
+	c.conn.Close()
+}
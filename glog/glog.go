@@ -1,15 +1,13 @@
 package glog
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"strings"
+	"sync"
 
 	"github.com/agtorre/gocolorize"
-	"github.com/syariatifaris/genggar/util"
 )
 
 //Log Level All Flag
@@ -21,8 +19,12 @@ type Tag struct {
 }
 
 var (
-	//Global Log Level
-	globalLogLevels []string
+	//outputMux guards the console writer and the file of the level logs
+	outputMux sync.RWMutex
+
+	//Output format of the console and the log files
+	consoleFormat = FormatText
+	fileFormat    = FormatText
 
 	//Colorize Map
 	colors = map[string]gocolorize.Colorize{
@@ -34,11 +36,14 @@ var (
 	}
 
 	//Log with level
-	warnLog  = tokopediaLogs{c: colors["warn"], w: os.Stdout, k: "warn"}
-	infoLog  = tokopediaLogs{c: colors["info"], w: os.Stdout, k: "info"}
-	errorLog = tokopediaLogs{c: colors["error"], w: os.Stderr, k: "error"}
-	debugLog = tokopediaLogs{c: colors["debug"], w: os.Stdout, k: "debug"}
-	traceLog = tokopediaLogs{c: colors["trace"], w: os.Stdout, k: "trace"}
+	warnLog  = tokopediaLogs{c: colors["warn"], w: os.Stdout, k: "warn", l: LevelWarn}
+	infoLog  = tokopediaLogs{c: colors["info"], w: os.Stdout, k: "info", l: LevelInfo}
+	errorLog = tokopediaLogs{c: colors["error"], w: os.Stderr, k: "error", l: LevelError}
+	debugLog = tokopediaLogs{c: colors["debug"], w: os.Stdout, k: "debug", l: LevelDebug}
+	traceLog = tokopediaLogs{c: colors["trace"], w: os.Stdout, k: "trace", l: LevelTrace}
+
+	//levelLogs are the level logs ordered by level
+	levelLogs = []*tokopediaLogs{&traceLog, &debugLog, &infoLog, &warnLog, &errorLog}
 
 	//Print calls with level
 	DEBUG = log.New(&debugLog, "DEBUG ", log.Ldate|log.Ltime|log.Lshortfile)
@@ -49,62 +54,153 @@ var (
 )
 
 //Config tokolog config structure
+//LogLevels is the minimum level, such as "info", or the comma list of the printed levels
+//ErrorLogPath receives warn and error, AccessLogPath receives trace, debug and info
 type Config struct {
 	LogLevels,
 	ErrorLogPath,
 	AccessLogPath string
+
+	//PackageLevels is the minimum level of the packages, see SetPackageLevel
+	PackageLevels map[string]Level
+	//LevelPaths routes the level into its own file instead of ErrorLogPath or AccessLogPath
+	LevelPaths map[Level]string
+
+	//ConsoleFormat and FileFormat are the output format, FormatText is used when it is not set
+	ConsoleFormat,
+	FileFormat Format
+
+	//Rotation rotates ErrorLogPath and AccessLogPath, they are not rotated when it is not set
+	Rotation Rotation
 }
 
 //tokopediaLogs structure
 type tokopediaLogs struct {
 	c gocolorize.Colorize
 	w io.Writer
-	f *os.File
+	f *logFile
 	k string
+	l Level
 }
 
-//Write write the log
+//Write write the log, the filtered level is discarded without error
 func (r *tokopediaLogs) Write(p []byte) (n int, err error) {
-	if util.InArray(globalLogLevels, r.k) || util.InArray(globalLogLevels, logLevelAll) || len(globalLogLevels) == 0 {
-		//write both file and on console
-		colorizedBytes := []byte(r.c.Paint(string(p)))
-		r.f.Write(colorizedBytes)
-		return r.w.Write(colorizedBytes)
+	if !enabled(r.l) {
+		return len(p), nil
+	}
+
+	outputMux.RLock()
+	defer outputMux.RUnlock()
+
+	//write both file and on console
+	if r.f != nil {
+		r.f.Write(r.format(fileFormat, p, false))
 	}
 
-	return 0, errors.New("message wont be printed")
+	if r.w != nil {
+		_, err := r.w.Write(r.format(consoleFormat, p, isTerminal(r.w)))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+//format formats the line for the writer, the text is colorized only on the terminal
+func (r *tokopediaLogs) format(format Format, p []byte, colorize bool) []byte {
+	if format == FormatJSON {
+		return formatJSON(r.k, p)
+	}
+
+	if colorize {
+		return []byte(r.c.Paint(string(p)))
+	}
+	return p
 }
 
 //Init initialize tokopedia log level
 func Init(cfg *Config) {
-	globalLogLevels = strings.Split(cfg.LogLevels, ",")
+	levelMux.Lock()
+	setLevels(cfg.LogLevels)
+	pkgLevels = make(map[string]Level)
+	for pkg, level := range cfg.PackageLevels {
+		pkgLevels[pkg] = level
+	}
+	levelMux.Unlock()
 
-	//set file for error and warn
-	if f := reopen(cfg.ErrorLogPath); f != nil {
-		errorLog.f = f
+	outputMux.Lock()
+	defer outputMux.Unlock()
+
+	consoleFormat, fileFormat = FormatText, FormatText
+	if cfg.ConsoleFormat != "" {
+		consoleFormat = cfg.ConsoleFormat
+	}
+	if cfg.FileFormat != "" {
+		fileFormat = cfg.FileFormat
+	}
+
+	filesMux.Lock()
+	defer filesMux.Unlock()
+
+	//the files of the previous init are closed
+	for _, f := range files {
+		f.close()
+	}
+	files = nil
+	errorLog.f, debugLog.f, traceLog.f, infoLog.f, warnLog.f = nil, nil, nil, nil, nil
+
+	//the same path shares the rotated file
+	opened := make(map[string]*logFile)
+	open := func(path string) *logFile {
+		if f, ok := opened[path]; ok {
+			return f
+		}
+
+		f := reopen(path, cfg.Rotation)
+		opened[path] = f
+		return f
 	}
 
-	//set log location for access
-	if f := reopen(cfg.AccessLogPath); f != nil {
-		debugLog.f = f
-		traceLog.f = f
-		infoLog.f = f
-		warnLog.f = f
+	for _, r := range levelLogs {
+		path := cfg.AccessLogPath
+		if r.l >= LevelWarn {
+			//set file for error and warn
+			path = cfg.ErrorLogPath
+		}
+
+		if levelPath, ok := cfg.LevelPaths[r.l]; ok {
+			path = levelPath
+		}
+		r.f = open(path)
+	}
+}
+
+//SetOutput routes the console output of the level to the writer, nil disables the console output
+func SetOutput(level Level, w io.Writer) {
+	outputMux.Lock()
+	defer outputMux.Unlock()
+
+	for _, r := range levelLogs {
+		if r.l == level {
+			r.w = w
+		}
 	}
 }
 
-//reopen opens the existing files as a log destination
-func reopen(filename string) *os.File {
+//reopen opens the existing files as a log destination, the caller should hold filesMux
+func reopen(filename string, rot Rotation) *logFile {
 	if filename == "" {
 		return nil
 	}
 
-	logFile, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	f, err := openLogFile(filename, rot)
 	if err != nil {
+		fmt.Fprintln(os.Stderr, "glog: unable to open log", filename, err.Error())
 		return nil
 	}
 
-	return logFile
+	files = append(files, f)
+	return f
 }
 
 //SetInfo sets the information of log such as prefixes, and tags
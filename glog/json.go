@@ -0,0 +1,139 @@
+package glog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+//Format is the output format of the log writer
+type Format string
+
+const (
+	//FormatText is the free text line, it is colorized on the terminal console
+	FormatText Format = "text"
+	//FormatJSON is one json object per line with level, time, caller, msg and the tag fields
+	FormatJSON Format = "json"
+)
+
+//jsonLine is the structured log line
+type jsonLine struct {
+	Level    string            `json:"level"`
+	Time     string            `json:"time"`
+	Caller   string            `json:"caller,omitempty"`
+	Msg      string            `json:"msg"`
+	Prefixes []string          `json:"prefixes,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+//Entry logs the message with the tags, the tags are the fields of the json format
+type Entry struct {
+	tags     []Tag
+	prefixes []string
+}
+
+//With creates the log entry with the tags
+func With(tags ...Tag) *Entry {
+	return &Entry{tags: tags}
+}
+
+//Prefix adds the prefixes of the entry
+func (e *Entry) Prefix(prefixes ...string) *Entry {
+	return &Entry{
+		tags:     e.tags,
+		prefixes: append(append([]string(nil), e.prefixes...), prefixes...),
+	}
+}
+
+func (e *Entry) Debug(v ...interface{}) { e.output(DEBUG.Output, v) }
+func (e *Entry) Info(v ...interface{})  { e.output(INFO.Output, v) }
+func (e *Entry) Warn(v ...interface{})  { e.output(WARN.Output, v) }
+func (e *Entry) Error(v ...interface{}) { e.output(ERROR.Output, v) }
+func (e *Entry) Trace(v ...interface{}) { e.output(TRACE.Output, v) }
+
+//output writes the message with SetInfo header, the caller is the caller of the entry method
+func (e *Entry) output(fn func(calldepth int, s string) error, v []interface{}) {
+	fn(3, SetInfo(e.tags, e.prefixes...)+" "+fmt.Sprintln(v...))
+}
+
+//formatJSON converts the log line written by the logger of the level into json line
+//the line is "<PREFIX><date> <time> <file:line>: <message>", the SetInfo header of the message is the fields
+func formatJSON(level string, p []byte) []byte {
+	line := jsonLine{
+		Level: level,
+		Time:  time.Now().Format(time.RFC3339Nano),
+		Msg:   strings.TrimRight(string(p), "\n"),
+	}
+
+	rest := strings.TrimPrefix(line.Msg, strings.ToUpper(level)+" ")
+	parts := strings.SplitN(rest, " ", 3)
+	if len(parts) == 3 {
+		if idx := strings.Index(parts[2], ": "); idx > 0 && !strings.Contains(parts[2][:idx], " ") {
+			line.Caller = parts[2][:idx]
+			line.Msg = parts[2][idx+2:]
+		}
+	}
+
+	line.Msg, line.Prefixes, line.Fields = parseInfo(line.Msg)
+	data, err := json.Marshal(line)
+	if err != nil {
+		return p
+	}
+	return append(data, '\n')
+}
+
+//parseInfo reads the leading SetInfo header, [prefix] is the prefix and [name:value] is the field
+func parseInfo(msg string) (string, []string, map[string]string) {
+	var prefixes []string
+	var fields map[string]string
+	for strings.HasPrefix(msg, "[") {
+		end := closingBracket(msg)
+		if end < 0 {
+			break
+		}
+
+		group := msg[1:end]
+		if idx := strings.Index(group, ":"); idx > 0 {
+			if fields == nil {
+				fields = make(map[string]string)
+			}
+			fields[group[:idx]] = group[idx+1:]
+		} else {
+			prefixes = append(prefixes, group)
+		}
+		msg = msg[end+1:]
+	}
+
+	return strings.TrimLeft(msg, " "), prefixes, fields
+}
+
+//closingBracket returns the index of the bracket closing the leading one, so the value like [::1]:4000 is kept
+func closingBracket(msg string) int {
+	depth := 0
+	for i := 0; i < len(msg); i++ {
+		switch msg[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+//isTerminal reports whether the writer is a terminal, only the terminal is colorized
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
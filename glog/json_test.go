@@ -0,0 +1,67 @@
+package glog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      string
+		want     string
+		prefixes []string
+		fields   map[string]string
+	}{
+		{"no header", "server started", "server started", nil, nil},
+		{"prefix", "[server] started", "started", []string{"server"}, nil},
+		{"field", "[topic:ORDER] published", "published", nil, map[string]string{"topic": "ORDER"}},
+		{"ipv6 address", "[remote:[::1]:4000][topic:ORDER] attached", "attached", nil, map[string]string{"remote": "[::1]:4000", "topic": "ORDER"}},
+		{"nested value", "[app][data:map[id:[1 2]]] read", "read", []string{"app"}, map[string]string{"data": "map[id:[1 2]]"}},
+		{"value with colon", "[url:http://host:80] sent", "sent", nil, map[string]string{"url": "http://host:80"}},
+		{"unclosed", "[remote:[::1 lost", "[remote:[::1 lost", nil, nil},
+		{"bracket in message", "[server] got [1 2]", "got [1 2]", []string{"server"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, prefixes, fields := parseInfo(test.msg)
+			if msg != test.want {
+				t.Fatalf("got message %q want %q", msg, test.want)
+			}
+			if len(prefixes) != len(test.prefixes) {
+				t.Fatalf("got prefixes %v want %v", prefixes, test.prefixes)
+			}
+			for i := range test.prefixes {
+				if prefixes[i] != test.prefixes[i] {
+					t.Fatalf("got prefixes %v want %v", prefixes, test.prefixes)
+				}
+			}
+			if len(fields) != len(test.fields) {
+				t.Fatalf("got fields %v want %v", fields, test.fields)
+			}
+			for k, v := range test.fields {
+				if fields[k] != v {
+					t.Fatalf("got fields %v want %v", fields, test.fields)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	header := SetInfo([]Tag{{Name: "remote", Value: "[::1]:4000"}}, "gateway")
+	raw := formatJSON("info", []byte("INFO 2024/01/02 03:04:05 http.go:10: "+header+" stream attached\n"))
+
+	var line jsonLine
+	err := json.Unmarshal(raw, &line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.Caller != "http.go:10" || line.Msg != "stream attached" {
+		t.Fatalf("got caller %q message %q", line.Caller, line.Msg)
+	}
+	if len(line.Prefixes) != 1 || line.Prefixes[0] != "gateway" || line.Fields["remote"] != "[::1]:4000" {
+		t.Fatalf("got prefixes %v fields %v", line.Prefixes, line.Fields)
+	}
+}
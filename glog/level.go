@@ -0,0 +1,216 @@
+package glog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Level is the ordered log level, the logs below the minimum level are not written
+type Level int
+
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"trace", "debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelTrace || l > LevelError {
+		return fmt.Sprint("level(", int(l), ")")
+	}
+	return levelNames[l]
+}
+
+//ParseLevel reads the level name, it is case insensitive
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, levelName := range levelNames {
+		if levelName == name {
+			return Level(i), nil
+		}
+	}
+	return LevelTrace, errors.New(fmt.Sprint("unknown log level ", name))
+}
+
+var (
+	levelMux sync.RWMutex
+	//minLevel is the global minimum level
+	minLevel = LevelTrace
+	//listLevels are the printed levels set with the comma list, it is used instead of minLevel when it is set
+	listLevels []string
+	//pkgLevels are the minimum level of the packages, they override the global level
+	pkgLevels map[string]Level
+
+	//glogPkg is the import path of glog, the frames of glog and its logger adapter are not the caller package
+	glogPkg   = reflect.TypeOf(Tag{}).PkgPath()
+	loggerPkg = strings.TrimSuffix(glogPkg, "glog") + "logger"
+)
+
+//SetLevel sets the global minimum level, it replaces the levels set with SetLevels
+func SetLevel(level Level) {
+	levelMux.Lock()
+	defer levelMux.Unlock()
+
+	minLevel = level
+	listLevels = nil
+}
+
+//GetLevel returns the global minimum level
+func GetLevel() Level {
+	levelMux.RLock()
+	defer levelMux.RUnlock()
+	return minLevel
+}
+
+//SetLevels changes the printed log levels without reopening the log files
+//levels is the comma list of the printed levels or "all", a single level name is the minimum level
+func SetLevels(levels string) {
+	levelMux.Lock()
+	defer levelMux.Unlock()
+	setLevels(levels)
+}
+
+//setLevels applies the levels, the caller should hold levelMux
+func setLevels(levels string) {
+	minLevel = LevelTrace
+	listLevels = nil
+
+	levels = strings.TrimSpace(levels)
+	if levels == "" || levels == logLevelAll {
+		return
+	}
+
+	if level, err := ParseLevel(levels); err == nil {
+		minLevel = level
+		return
+	}
+
+	for _, level := range strings.Split(levels, ",") {
+		listLevels = append(listLevels, strings.ToLower(strings.TrimSpace(level)))
+	}
+}
+
+//SetPackageLevel sets the minimum level of the package and its sub packages, such as
+//"github.com/syariatifaris/genggar/engine", the longest matching package is used
+func SetPackageLevel(pkg string, level Level) {
+	levelMux.Lock()
+	defer levelMux.Unlock()
+
+	if pkgLevels == nil {
+		pkgLevels = make(map[string]Level)
+	}
+	pkgLevels[pkg] = level
+}
+
+//SetPackageLevels replaces every package level
+func SetPackageLevels(levels map[string]Level) {
+	levelMux.Lock()
+	defer levelMux.Unlock()
+
+	pkgLevels = make(map[string]Level, len(levels))
+	for pkg, level := range levels {
+		pkgLevels[pkg] = level
+	}
+}
+
+//ClearPackageLevel removes the level of the package, it follows the global level again
+func ClearPackageLevel(pkg string) {
+	levelMux.Lock()
+	defer levelMux.Unlock()
+	delete(pkgLevels, pkg)
+}
+
+//PackageLevels returns a copy of the package levels
+func PackageLevels() map[string]Level {
+	levelMux.RLock()
+	defer levelMux.RUnlock()
+
+	levels := make(map[string]Level, len(pkgLevels))
+	for pkg, level := range pkgLevels {
+		levels[pkg] = level
+	}
+	return levels
+}
+
+//enabled reports whether the log of the level is written, the package level of the caller is looked up
+//only when a package level is set
+func enabled(level Level) bool {
+	levelMux.RLock()
+	defer levelMux.RUnlock()
+
+	if len(pkgLevels) > 0 {
+		if pkgLevel, ok := packageLevel(callerPackage()); ok {
+			return level >= pkgLevel
+		}
+	}
+
+	if listLevels != nil {
+		name := level.String()
+		for _, listLevel := range listLevels {
+			if listLevel == name || listLevel == logLevelAll {
+				return true
+			}
+		}
+		return false
+	}
+
+	return level >= minLevel
+}
+
+//packageLevel finds the level of the longest package matching pkg, the caller should hold levelMux
+func packageLevel(pkg string) (Level, bool) {
+	if pkg == "" {
+		return LevelTrace, false
+	}
+
+	pkgs := make([]string, 0, len(pkgLevels))
+	for p := range pkgLevels {
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return len(pkgs[i]) > len(pkgs[j])
+	})
+
+	for _, p := range pkgs {
+		if pkg == p || strings.HasPrefix(pkg, p+"/") {
+			return pkgLevels[p], true
+		}
+	}
+	return LevelTrace, false
+}
+
+//callerPackage returns the package of the first frame outside the log packages
+func callerPackage() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		pkg := funcPackage(frame.Function)
+		if pkg != "log" && pkg != glogPkg && pkg != loggerPkg {
+			return pkg
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
+
+//funcPackage reads the package of the function name, such as "github.com/a/b/pkg.(*Type).Method"
+func funcPackage(name string) string {
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
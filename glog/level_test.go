@@ -0,0 +1,60 @@
+package glog
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestSetLevels(t *testing.T) {
+	defer SetLevels(logLevelAll)
+
+	tests := []struct {
+		levels string
+		want   map[Level]bool
+	}{
+		{"all", map[Level]bool{LevelTrace: true, LevelInfo: true, LevelError: true}},
+		{"warn", map[Level]bool{LevelInfo: false, LevelWarn: true, LevelError: true}},
+		{"info,error", map[Level]bool{LevelInfo: true, LevelWarn: false, LevelError: true}},
+		{"", map[Level]bool{LevelTrace: true, LevelError: true}},
+	}
+
+	for _, test := range tests {
+		SetLevels(test.levels)
+		for level, want := range test.want {
+			if got := enabled(level); got != want {
+				t.Fatalf("levels %q, %s enabled got %v want %v", test.levels, level, got, want)
+			}
+		}
+	}
+}
+
+//TestSetLevelsConcurrent reloads the levels while logging like SIGHUP, it should be run with -race
+func TestSetLevelsConcurrent(t *testing.T) {
+	defer SetLevels(logLevelAll)
+	SetOutput(LevelInfo, ioutil.Discard)
+	SetOutput(LevelError, ioutil.Discard)
+	defer SetOutput(LevelError, os.Stderr)
+	defer SetOutput(LevelInfo, os.Stdout)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetLevels([]string{"info", "error", "info,warn", "all"}[j%4])
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				INFO.Println("reloaded")
+				ERROR.Println("reloaded")
+				GetLevel()
+			}
+		}()
+	}
+	wg.Wait()
+}
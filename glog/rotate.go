@@ -0,0 +1,291 @@
+package glog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//rotatedTime is the suffix of the rotated file, it sorts by the rotation time
+const rotatedTime = "20060102-150405.000"
+
+//Rotation is the log file rotation, the zero value does not rotate
+type Rotation struct {
+	//MaxSize rotates the file before it grows beyond the bytes
+	MaxSize int64
+	//Interval rotates the file at every interval boundary, such as every hour or every day (UTC)
+	Interval time.Duration
+	//MaxFiles is the rotated files kept, the oldest are removed, 0 keeps all
+	MaxFiles int
+	//Compress gzips the rotated files
+	Compress bool
+}
+
+//logFile is the log destination rotated by size and time, the rotated file is "<path>.<time>[.gz]"
+type logFile struct {
+	mux    sync.Mutex
+	path   string
+	rot    Rotation
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	//cleanMux keeps one compress and cleanup running at a time
+	cleanMux sync.Mutex
+}
+
+var (
+	filesMux sync.Mutex
+	//files are the opened log files, they are reopened by Reopen
+	files []*logFile
+)
+
+func openLogFile(path string, rot Rotation) (*logFile, error) {
+	f := &logFile{
+		path: path,
+		rot:  rot,
+	}
+
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+//open opens the file in append mode, the caller should hold the lock
+func (f *logFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	f.file = file
+	f.size = 0
+	f.opened = time.Now()
+	if info, err := file.Stat(); err == nil {
+		f.size = info.Size()
+		if f.size > 0 {
+			f.opened = info.ModTime()
+		}
+	}
+	return nil
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.file == nil {
+		return 0, errors.New("log file is closed")
+	}
+
+	if f.shouldRotate(len(p)) {
+		err := f.rotate()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glog: rotate fail", f.path, err.Error())
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *logFile) shouldRotate(n int) bool {
+	if f.rot.MaxSize > 0 && f.size > 0 && f.size+int64(n) > f.rot.MaxSize {
+		return true
+	}
+
+	if f.rot.Interval > 0 {
+		next := f.opened.Truncate(f.rot.Interval).Add(f.rot.Interval)
+		return !time.Now().Before(next)
+	}
+	return false
+}
+
+//rotate renames the current file and opens the new one, the caller should hold the lock
+func (f *logFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	rotated := fmt.Sprint(f.path, ".", time.Now().Format(rotatedTime))
+	err := os.Rename(f.path, rotated)
+	if err != nil && !os.IsNotExist(err) {
+		f.open()
+		return err
+	}
+
+	err = f.open()
+	if err != nil {
+		return err
+	}
+
+	go f.clean(rotated)
+	return nil
+}
+
+//reopen closes and opens the file again, the file renamed by logrotate is released
+func (f *logFile) reopen() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+func (f *logFile) close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+//clean compresses the rotated file and removes the oldest rotated files beyond MaxFiles
+func (f *logFile) clean(rotated string) {
+	f.cleanMux.Lock()
+	defer f.cleanMux.Unlock()
+
+	if f.rot.Compress {
+		err := compress(rotated)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glog: compress fail", rotated, err.Error())
+		}
+	}
+
+	if f.rot.MaxFiles <= 0 {
+		return
+	}
+
+	dir, base := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".gz")
+		if !strings.HasPrefix(name, base+".") || len(suffix) != len(rotatedTime) {
+			continue
+		}
+
+		if _, err := time.Parse(rotatedTime, suffix); err == nil {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	for i := 0; i < len(names)-f.rot.MaxFiles; i++ {
+		os.Remove(filepath.Join(dir, names[i]))
+	}
+}
+
+//compress gzips the file into "<path>.gz" and removes the file
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(dst)
+	_, err = io.Copy(writer, src)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+//Reopen closes and opens the log files again, it is called after the files are moved by logrotate
+func Reopen() error {
+	filesMux.Lock()
+	defer filesMux.Unlock()
+
+	var failed []string
+	for _, f := range files {
+		err := f.reopen()
+		if err != nil {
+			failed = append(failed, fmt.Sprint(f.path, " ", err.Error()))
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(fmt.Sprint("unable to reopen log ", strings.Join(failed, ", ")))
+	}
+	return nil
+}
+
+//ReopenOnSignal reopens the log files on the signals, SIGHUP when no signal is given
+//it is used by the application which does not handle the signal itself, stop ends it
+func ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigChan, sigs...)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigChan:
+				err := Reopen()
+				if err != nil {
+					ERROR.Println(err.Error())
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigChan)
+			close(done)
+		})
+	}
+}
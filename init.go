@@ -1,6 +1,7 @@
 package genggar
 
 import (
+	"errors"
 	"net"
 
 	"fmt"
@@ -9,40 +10,151 @@ import (
 	"github.com/syariatifaris/genggar/subscriber"
 )
 
-func NewEventServer(serverAddr string, port int) (engine.Server, error) {
+//NewEventServer creates the event server listening on the address and port
+func NewEventServer(serverAddr string, port int, opts ...Option) (engine.Server, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.checkServer()
+	if err != nil {
+		return nil, err
+	}
+
+	if serverAddr != "" && net.ParseIP(serverAddr) == nil {
+		return nil, errors.New(fmt.Sprint("invalid server address ", serverAddr))
+	}
+
+	err = validatePort(port)
+	if err != nil {
+		return nil, err
+	}
+
 	addr := net.UDPAddr{
 		Port: port,
 		IP:   net.ParseIP(serverAddr),
 	}
 
-	server, err := net.ListenUDP(engine.ProtoUDP, &addr)
+	server, err := net.ListenUDP(o.transport, &addr)
 	if err != nil {
 		return nil, err
 	}
 
 	return &engine.ServerImpl{
 		Port:  port,
-		Proto: engine.ProtoUDP,
+		Proto: o.transport,
+		IDGen: o.idGen,
+
+		EventStore:       o.store,
+		SubscriberBuffer: o.subscriberBuffer,
+		RequestTimeout:   o.requestTimeout,
+		AuthToken:        o.authToken,
+		Retry:            o.retry,
+		Metrics:          o.metrics,
+		Tracer:           o.tracer,
+		Logger:           o.logger,
+		TopicOverflow:    o.topicOverflow,
+		SpillDir:         o.spillDir,
+		SpillHead:        o.spillHead,
 
 		ServerConn:  server,
-		MsgBuff:     make([]byte, engine.MaxBuffer),
-		Subscribers: make(map[string]subscriber.Client),
+		MsgBuff:     make([]byte, o.bufferSize),
+		Subscribers: subscriber.NewRegistry(),
 	}, nil
 }
 
-func NewSubscriberClient(serverAddr string, port int, topic string, processors []*engine.EventProcessor) (engine.Client, error) {
-	conn, err := net.Dial(engine.ProtoUDP, fmt.Sprint(serverAddr, ":", port))
+//NewSubscriberClient creates the subscriber client of the topic connected to the server
+func NewSubscriberClient(serverAddr string, port int, topic string, processors []*engine.EventProcessor, opts ...Option) (engine.Client, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.checkClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if serverAddr == "" {
+		return nil, errors.New("server address is required")
+	}
+
+	err = validatePort(port)
+	if err != nil {
+		return nil, err
+	}
+
+	if topic == "" {
+		return nil, errors.New("subscriber topic is required")
+	}
+
+	conn, err := net.DialTimeout(o.transport, fmt.Sprint(serverAddr, ":", port), o.dialTimeout)
 	if err != nil {
 		return nil, err
 	}
 
 	return &engine.ClientImpl{
-		Proto: engine.ProtoUDP,
+		Proto: o.transport,
 		Port:  port,
 		Topic: topic,
 
-		MsgBuff:    make([]byte, engine.MaxBuffer),
+		MsgBuff:    make([]byte, o.bufferSize),
 		ClientConn: conn,
 		Processors: processors,
+		Token:      o.authToken,
+		FromSeq:    o.fromSeq,
+		Metrics:    o.metrics,
+		Tracer:     o.tracer,
+		Logger:     o.logger,
+		Codec:      o.codec,
+		Version:    o.protocolVersion,
 	}, nil
 }
+
+//NewAdminClient creates the client querying the server state, it accepts the subscriber client options
+func NewAdminClient(serverAddr string, port int, opts ...Option) (*engine.AdminClient, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.checkClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if serverAddr == "" {
+		return nil, errors.New("server address is required")
+	}
+
+	err = validatePort(port)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout(o.transport, fmt.Sprint(serverAddr, ":", port), o.dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	//the answer carries the whole server state, so it reads up to the max udp payload
+	size := o.bufferSize
+	if size < DefaultBufferSize {
+		size = DefaultBufferSize
+	}
+
+	return &engine.AdminClient{
+		Conn:    conn,
+		Token:   o.authToken,
+		MsgBuff: make([]byte, size),
+	}, nil
+}
+
+func validatePort(port int) error {
+	if port < 0 || port > 65535 {
+		return errors.New(fmt.Sprint("invalid port ", port))
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/syariatifaris/genggar/glog"
+)
+
+//Logger receives the logs of the server, the client and the subscriber buffers
+//kv is the list of key and value pairs of the message
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+//Nop discards the logs
+type Nop struct{}
+
+func (Nop) Debug(msg string, kv ...interface{}) {}
+func (Nop) Info(msg string, kv ...interface{})  {}
+func (Nop) Warn(msg string, kv ...interface{})  {}
+func (Nop) Error(msg string, kv ...interface{}) {}
+
+//Glog writes the logs with the glog level loggers, the key and value pairs are the glog tags
+//it is the default logger
+type Glog struct{}
+
+func (Glog) Debug(msg string, kv ...interface{}) { glog.DEBUG.Output(2, glogLine(msg, kv)) }
+func (Glog) Info(msg string, kv ...interface{})  { glog.INFO.Output(2, glogLine(msg, kv)) }
+func (Glog) Warn(msg string, kv ...interface{})  { glog.WARN.Output(2, glogLine(msg, kv)) }
+func (Glog) Error(msg string, kv ...interface{}) { glog.ERROR.Output(2, glogLine(msg, kv)) }
+
+//glogLine writes the pairs as SetInfo header, so the json format reads them as fields
+func glogLine(msg string, kv []interface{}) string {
+	if len(kv) == 0 {
+		return msg
+	}
+	return strings.TrimSpace(glog.SetInfo(Tags(kv)) + " " + msg)
+}
+
+//Tags converts the key and value pairs into glog tags, the key without value is kept with empty value
+func Tags(kv []interface{}) []glog.Tag {
+	tags := make([]glog.Tag, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		var val interface{} = ""
+		if i+1 < len(kv) {
+			val = kv[i+1]
+		}
+		tags = append(tags, glog.Tag{Name: fmt.Sprint(kv[i]), Value: val})
+	}
+	return tags
+}
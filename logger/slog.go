@@ -0,0 +1,44 @@
+//go:build go1.21
+//+build go1.21
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+//slogLogger writes the logs with the log/slog logger
+type slogLogger struct {
+	l *slog.Logger
+}
+
+//Slog adapts the log/slog logger, the source of the record is the caller of the logger
+func Slog(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Debug(msg string, kv ...interface{}) { s.log(slog.LevelDebug, msg, kv) }
+func (s *slogLogger) Info(msg string, kv ...interface{})  { s.log(slog.LevelInfo, msg, kv) }
+func (s *slogLogger) Warn(msg string, kv ...interface{})  { s.log(slog.LevelWarn, msg, kv) }
+func (s *slogLogger) Error(msg string, kv ...interface{}) { s.log(slog.LevelError, msg, kv) }
+
+func (s *slogLogger) log(level slog.Level, msg string, kv []interface{}) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+
+	//skip runtime.Callers, log and the level method
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	rec := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	rec.Add(kv...)
+	s.l.Handler().Handle(ctx, rec)
+}
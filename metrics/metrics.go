@@ -0,0 +1,75 @@
+package metrics
+
+//Metrics receives the measurements of the server and the client, it is implemented by Registry
+//or by an adapter of another metrics library
+type Metrics interface {
+	//Add increases the counter
+	Add(name string, value float64, labels ...Label)
+	//Set sets the gauge
+	Set(name string, value float64, labels ...Label)
+	//Observe records the value into the histogram
+	Observe(name string, value float64, labels ...Label)
+	//Delete removes the series of the labels, such as the gauge of the removed subscriber
+	Delete(name string, labels ...Label)
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+//L creates the label
+func L(name, value string) Label {
+	return Label{Name: name, Value: value}
+}
+
+//Nop discards every measurement, it is used when the metrics is not configured
+type Nop struct{}
+
+func (Nop) Add(name string, value float64, labels ...Label)     {}
+func (Nop) Set(name string, value float64, labels ...Label)     {}
+func (Nop) Observe(name string, value float64, labels ...Label) {}
+func (Nop) Delete(name string, labels ...Label)                 {}
+
+//metric names of the server
+const (
+	EventsPublished      = "genggar_events_published_total"
+	EventsDispatched     = "genggar_events_dispatched_total"
+	EventsRejected       = "genggar_events_rejected_total"
+	EventsProcessed      = "genggar_events_processed_total"
+	EventsFailed         = "genggar_events_failed_total"
+	EventsRetried        = "genggar_events_retried_total"
+	EventsDeadLetter     = "genggar_events_dead_lettered_total"
+	SendErrors           = "genggar_send_errors_total"
+	SendDuration         = "genggar_send_duration_seconds"
+	SubscriberBuffer     = "genggar_subscriber_buffer_depth"
+	SubscriberReconnects = "genggar_subscriber_reconnects_total"
+)
+
+//metric names of the client
+const (
+	ClientEventsReceived    = "genggar_client_events_received_total"
+	ClientProcessorErrors   = "genggar_client_processor_errors_total"
+	ClientProcessorDuration = "genggar_client_processor_duration_seconds"
+	ClientSendErrors        = "genggar_client_send_errors_total"
+)
+
+//help is the description of the known metrics
+var help = map[string]string{
+	EventsPublished:      "Events published to the topic.",
+	EventsDispatched:     "Events sent to the subscribers of the topic.",
+	EventsRejected:       "Events which could not be buffered for a subscriber.",
+	EventsProcessed:      "Events acknowledged as processed by the subscribers.",
+	EventsFailed:         "Events acknowledged as failed by the subscribers.",
+	EventsRetried:        "Failed sends which are sent again.",
+	EventsDeadLetter:     "Events dead lettered after the retries.",
+	SendErrors:           "Errors sending the event to the subscriber.",
+	SendDuration:         "Duration of sending the event to the subscriber.",
+	SubscriberBuffer:     "Buffered events of the subscriber.",
+	SubscriberReconnects: "Registrations of an already registered subscriber.",
+
+	ClientEventsReceived:    "Events received by the subscriber client.",
+	ClientProcessorErrors:   "Event processors returning an error.",
+	ClientProcessorDuration: "Duration of the event processors.",
+	ClientSendErrors:        "Errors sending to the server.",
+}
@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//DefaultBuckets are the histogram upper bounds in seconds
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type kind string
+
+const (
+	kindCounter   kind = "counter"
+	kindGauge     kind = "gauge"
+	kindHistogram kind = "histogram"
+)
+
+//family is a metric name with all its label sets
+type family struct {
+	kind   kind
+	series map[string]*series
+}
+
+type series struct {
+	labels  []Label
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+//Registry keeps the measurements in memory and writes them in prometheus text format
+//a metric name keeps the kind of its first measurement, the measurement of another kind is ignored
+type Registry struct {
+	mux      sync.Mutex
+	buckets  []float64
+	families map[string]*family
+}
+
+//NewRegistry creates the registry, the histograms use DefaultBuckets when buckets are not given
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Registry{
+		buckets:  sorted,
+		families: make(map[string]*family),
+	}
+}
+
+func (r *Registry) Add(name string, value float64, labels ...Label) {
+	r.update(name, kindCounter, labels, func(s *series) {
+		s.value += value
+	})
+}
+
+func (r *Registry) Set(name string, value float64, labels ...Label) {
+	r.update(name, kindGauge, labels, func(s *series) {
+		s.value = value
+	})
+}
+
+func (r *Registry) Observe(name string, value float64, labels ...Label) {
+	r.update(name, kindHistogram, labels, func(s *series) {
+		if s.buckets == nil {
+			s.buckets = make([]uint64, len(r.buckets))
+		}
+
+		for i, upper := range r.buckets {
+			if value <= upper {
+				s.buckets[i]++
+			}
+		}
+		s.value += value
+		s.count++
+	})
+}
+
+//Delete removes the series, it is not written anymore until it is measured again
+func (r *Registry) Delete(name string, labels ...Label) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		delete(f.series, labelKey(labels))
+	}
+}
+
+func (r *Registry) update(name string, k kind, labels []Label, fn func(s *series)) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{
+			kind:   k,
+			series: make(map[string]*series),
+		}
+		r.families[name] = f
+	}
+
+	if f.kind != k {
+		return
+	}
+
+	key := labelKey(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]Label(nil), labels...)}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+//ServeHTTP writes the metrics in prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(r.Text())
+}
+
+//Text returns the metrics in prometheus text format, ordered by name and labels
+func (r *Registry) Text() []byte {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		f := r.families[name]
+		if h, ok := help[name]; ok {
+			fmt.Fprintf(&buf, "# HELP %s %s\n", name, h)
+		}
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != kindHistogram {
+				fmt.Fprintf(&buf, "%s%s %s\n", name, formatLabels(s.labels), formatValue(s.value))
+				continue
+			}
+
+			for i, upper := range r.buckets {
+				le := append(append([]Label(nil), s.labels...), L("le", formatValue(upper)))
+				fmt.Fprintf(&buf, "%s_bucket%s %d\n", name, formatLabels(le), s.buckets[i])
+			}
+			inf := append(append([]Label(nil), s.labels...), L("le", "+Inf"))
+			fmt.Fprintf(&buf, "%s_bucket%s %d\n", name, formatLabels(inf), s.count)
+			fmt.Fprintf(&buf, "%s_sum%s %s\n", name, formatLabels(s.labels), formatValue(s.value))
+			fmt.Fprintf(&buf, "%s_count%s %d\n", name, formatLabels(s.labels), s.count)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func labelKey(labels []Label) string {
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = label.Name + "\xff" + label.Value
+	}
+	return strings.Join(parts, "\xfe")
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = fmt.Sprintf("%s=\"%s\"", label.Name, escape(label.Value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escape(val string) string {
+	val = strings.Replace(val, `\`, `\\`, -1)
+	val = strings.Replace(val, `"`, `\"`, -1)
+	return strings.Replace(val, "\n", `\n`, -1)
+}
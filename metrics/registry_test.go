@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryText(t *testing.T) {
+	r := NewRegistry(1, 5)
+	r.Add(EventsPublished, 2, L("topic", "ORDER"))
+	r.Add(EventsPublished, 1, L("topic", "ORDER"))
+	r.Set(SubscriberBuffer, 3, L("topic", "ORDER"), L("subscriber", "a"))
+	r.Observe(SendDuration, 2, L("topic", "ORDER"))
+
+	text := string(r.Text())
+	for _, want := range []string{
+		`genggar_events_published_total{topic="ORDER"} 3`,
+		`genggar_subscriber_buffer_depth{topic="ORDER",subscriber="a"} 3`,
+		`genggar_send_duration_seconds_bucket{topic="ORDER",le="1"} 0`,
+		`genggar_send_duration_seconds_bucket{topic="ORDER",le="5"} 1`,
+		`genggar_send_duration_seconds_count{topic="ORDER"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("missing %s in\n%s", want, text)
+		}
+	}
+}
+
+func TestRegistryDelete(t *testing.T) {
+	r := NewRegistry()
+	r.Set(SubscriberBuffer, 3, L("topic", "ORDER"), L("subscriber", "a"))
+	r.Set(SubscriberBuffer, 4, L("topic", "ORDER"), L("subscriber", "b"))
+
+	r.Delete(SubscriberBuffer, L("topic", "ORDER"), L("subscriber", "a"))
+	r.Delete(SubscriberBuffer, L("topic", "ORDER"), L("subscriber", "unknown"))
+	r.Delete("unknown")
+
+	text := string(r.Text())
+	if strings.Contains(text, `subscriber="a"`) {
+		t.Fatalf("deleted series is written\n%s", text)
+	}
+	if !strings.Contains(text, `genggar_subscriber_buffer_depth{topic="ORDER",subscriber="b"} 4`) {
+		t.Fatalf("other series is deleted\n%s", text)
+	}
+}
@@ -0,0 +1,341 @@
+package genggar
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/eventstore"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/metrics"
+	"github.com/syariatifaris/genggar/subscriber"
+	"github.com/syariatifaris/genggar/tracing"
+	"github.com/syariatifaris/genggar/util"
+)
+
+//DefaultBufferSize is the read buffer fitting the largest frame of a udp datagram
+const DefaultBufferSize = codec.MaxPayload + codec.FrameHeaderLen
+
+//Option configures the event server or the subscriber client
+type Option func(o *options) error
+
+//options holds the configuration of the constructors
+//serverOnly and clientOnly keep the name of the options which are not applicable to the other side
+type options struct {
+	transport        string
+	bufferSize       int
+	subscriberBuffer int
+	idGen            util.IDGenerator
+	store            eventstore.Store
+	requestTimeout   time.Duration
+	dialTimeout      time.Duration
+	spillDir         string
+	spillHead        int
+	topicOverflow    map[string]subscriber.OverflowConfig
+	authToken        string
+	fromSeq          uint64
+	retry            engine.RetryPolicy
+	metrics          metrics.Metrics
+	tracer           tracing.Tracer
+	logger           logger.Logger
+	codec            string
+	protocolVersion  uint8
+
+	serverOnly []string
+	clientOnly []string
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		transport:       engine.ProtoUDP,
+		bufferSize:      DefaultBufferSize,
+		protocolVersion: codec.FrameVersion,
+	}
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+//checkClient fails when server only options are given to the subscriber client
+func (o *options) checkClient() error {
+	if len(o.serverOnly) > 0 {
+		return errors.New(fmt.Sprint("options not supported by subscriber client: ", strings.Join(o.serverOnly, ", ")))
+	}
+	return nil
+}
+
+//checkServer fails when subscriber only options are given to the event server
+//the spill client can not spill its overflow again, so WithSpill is not combined with the spill overflow
+func (o *options) checkServer() error {
+	if len(o.clientOnly) > 0 {
+		return errors.New(fmt.Sprint("options not supported by event server: ", strings.Join(o.clientOnly, ", ")))
+	}
+
+	if o.spillDir != "" {
+		var topics []string
+		for topic, cfg := range o.topicOverflow {
+			if cfg.Policy == subscriber.OverflowSpill {
+				topics = append(topics, topic)
+			}
+		}
+		if len(topics) > 0 {
+			sort.Strings(topics)
+			return errors.New(fmt.Sprint("WithSpill can not be combined with spill overflow of topics: ", strings.Join(topics, ", ")))
+		}
+	}
+	return nil
+}
+
+//WithTransport sets the network transport, only udp is supported
+//the server and the subscriber speak the udp datagrams, the other transports are not implemented yet and are rejected
+func WithTransport(proto string) Option {
+	return func(o *options) error {
+		if proto != engine.ProtoUDP {
+			return errors.New(fmt.Sprint("unsupported transport ", strconv.Quote(proto), ", only ", engine.ProtoUDP, " is supported"))
+		}
+
+		o.transport = proto
+		return nil
+	}
+}
+
+//WithBufferSize sets the size of the read buffer, the message bigger than the size is truncated
+//DefaultBufferSize is used when it is not set, so every frame is read whole
+func WithBufferSize(size int) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return errors.New(fmt.Sprint("buffer size should more than 0, got ", size))
+		}
+
+		o.bufferSize = size
+		return nil
+	}
+}
+
+//WithSubscriberBuffer sets the max buffered events of every subscriber
+func WithSubscriberBuffer(size int) Option {
+	return func(o *options) error {
+		o.serverOnly = append(o.serverOnly, "WithSubscriberBuffer")
+		if size <= 0 {
+			return errors.New(fmt.Sprint("subscriber buffer should more than 0, got ", size))
+		}
+
+		o.subscriberBuffer = size
+		return nil
+	}
+}
+
+//WithIDGenerator sets the event id generator
+func WithIDGenerator(gen util.IDGenerator) Option {
+	return func(o *options) error {
+		o.serverOnly = append(o.serverOnly, "WithIDGenerator")
+		if gen == nil {
+			return errors.New("id generator is nil")
+		}
+
+		o.idGen = gen
+		return nil
+	}
+}
+
+//WithStore sets the event store recording the event history
+func WithStore(store eventstore.Store) Option {
+	return func(o *options) error {
+		o.serverOnly = append(o.serverOnly, "WithStore")
+		if store == nil {
+			return errors.New("event store is nil")
+		}
+
+		o.store = store
+		return nil
+	}
+}
+
+//WithRequestTimeout sets the timeout of the request without deadline
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		o.serverOnly = append(o.serverOnly, "WithRequestTimeout")
+		if timeout <= 0 {
+			return errors.New(fmt.Sprint("request timeout should more than 0, got ", timeout))
+		}
+
+		o.requestTimeout = timeout
+		return nil
+	}
+}
+
+//WithDialTimeout sets the timeout of connecting to the server
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout <= 0 {
+			return errors.New(fmt.Sprint("dial timeout should more than 0, got ", timeout))
+		}
+
+		o.dialTimeout = timeout
+		return nil
+	}
+}
+
+//WithSpill creates the subscribers as spill client, keeping head events in memory and the rest inside dir
+func WithSpill(dir string, head int) Option {
+	return func(o *options) error {
+		o.serverOnly = append(o.serverOnly, "WithSpill")
+		if dir == "" {
+			return errors.New("spill dir is required")
+		}
+
+		if head <= 0 {
+			return errors.New(fmt.Sprint("spill head should more than 0, got ", head))
+		}
+
+		o.spillDir = dir
+		o.spillHead = head
+		return nil
+	}
+}
+
+//WithTopicOverflow sets the overflow policy of the topic subscribers
+func WithTopicOverflow(topic string, cfg subscriber.OverflowConfig) Option {
+	return func(o *options) error {
+		o.serverOnly = append(o.serverOnly, "WithTopicOverflow")
+		if topic == "" {
+			return errors.New("overflow topic is required")
+		}
+
+		err := cfg.Validate()
+		if err != nil {
+			return errors.New(fmt.Sprint("invalid overflow of topic ", topic, ": ", err.Error()))
+		}
+
+		if o.topicOverflow == nil {
+			o.topicOverflow = make(map[string]subscriber.OverflowConfig)
+		}
+		o.topicOverflow[topic] = cfg
+		return nil
+	}
+}
+
+//WithAuthToken sets the registration token, the server rejects the subscriber with different token
+func WithAuthToken(token string) Option {
+	return func(o *options) error {
+		if token == "" {
+			return errors.New("auth token is empty")
+		}
+
+		o.authToken = token
+		return nil
+	}
+}
+
+//WithRetry sets the redelivery of the event which the subscriber failed to receive
+func WithRetry(policy engine.RetryPolicy) Option {
+	return func(o *options) error {
+		o.serverOnly = append(o.serverOnly, "WithRetry")
+		if policy.MaxAttempts <= 0 {
+			return errors.New(fmt.Sprint("retry max attempts should more than 0, got ", policy.MaxAttempts))
+		}
+
+		if policy.Backoff < 0 || policy.MaxBackoff < 0 {
+			return errors.New("retry backoff should not be negative")
+		}
+
+		o.retry = policy
+		return nil
+	}
+}
+
+//WithOffset replays the stored events of the topic from the sequence before the new events,
+//the server needs an event store
+func WithOffset(seq uint64) Option {
+	return func(o *options) error {
+		o.clientOnly = append(o.clientOnly, "WithOffset")
+		if seq == 0 {
+			return errors.New("offset should start from 1")
+		}
+
+		o.fromSeq = seq
+		return nil
+	}
+}
+
+//WithMetrics sets the receiver of the server or client measurements, metrics.Registry serves them
+//in prometheus text format
+func WithMetrics(m metrics.Metrics) Option {
+	return func(o *options) error {
+		if m == nil {
+			return errors.New("metrics is nil")
+		}
+
+		o.metrics = m
+		return nil
+	}
+}
+
+//WithTracer sets the tracer propagating the trace context through the events, the subscriber client
+//starts a child span around every event processor
+func WithTracer(t tracing.Tracer) Option {
+	return func(o *options) error {
+		if t == nil {
+			return errors.New("tracer is nil")
+		}
+
+		o.tracer = t
+		return nil
+	}
+}
+
+//WithLogger sets the logger of the server or the subscriber client, logger.Nop silences them
+func WithLogger(l logger.Logger) Option {
+	return func(o *options) error {
+		if l == nil {
+			return errors.New("logger is nil")
+		}
+
+		o.logger = l
+		return nil
+	}
+}
+
+//WithCodec sets the wire codec of the subscriber client, it is negotiated on registration
+//the server accepts every registered codec, see the codec package
+func WithCodec(name string) Option {
+	return func(o *options) error {
+		o.clientOnly = append(o.clientOnly, "WithCodec")
+		_, err := codec.Get(name)
+		if err != nil {
+			return err
+		}
+
+		o.codec = name
+		return nil
+	}
+}
+
+//WithProtocolVersion sets the frame version of the subscriber client, 0 sends the unframed json of the
+//servers older than the frame, the server downgrades a version newer than it supports
+func WithProtocolVersion(version uint8) Option {
+	return func(o *options) error {
+		o.clientOnly = append(o.clientOnly, "WithProtocolVersion")
+		if version != 0 && !codec.SupportedVersion(version) {
+			return &codec.VersionError{Version: version}
+		}
+
+		o.protocolVersion = version
+		return nil
+	}
+}
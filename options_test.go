@@ -0,0 +1,60 @@
+package genggar
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/syariatifaris/genggar/codec"
+	"github.com/syariatifaris/genggar/subscriber"
+)
+
+//TestDefaultBufferSize checks the largest frame fits the default read buffer
+func TestDefaultBufferSize(t *testing.T) {
+	o, err := newOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := codec.WriteFrame(codec.FrameVersion, 1, bytes.Repeat([]byte("a"), codec.MaxPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frame) > o.bufferSize {
+		t.Fatalf("got buffer %d for frame of %d bytes", o.bufferSize, len(frame))
+	}
+}
+
+func TestCheckServerSpill(t *testing.T) {
+	spill := subscriber.OverflowConfig{Policy: subscriber.OverflowSpill, SpillDir: "/tmp/overflow"}
+	block := subscriber.OverflowConfig{Policy: subscriber.OverflowBlock}
+
+	tests := []struct {
+		name string
+		opts []Option
+		ok   bool
+	}{
+		{"spill client", []Option{WithSpill("/tmp/spill", 10)}, true},
+		{"spill overflow", []Option{WithTopicOverflow("ORDER", spill)}, true},
+		{"spill client with other overflow", []Option{WithSpill("/tmp/spill", 10), WithTopicOverflow("ORDER", block)}, true},
+		{"spill client with spill overflow", []Option{WithSpill("/tmp/spill", 10), WithTopicOverflow("ORDER", spill)}, false},
+		{"spill overflow with spill client", []Option{WithTopicOverflow("ORDER", block), WithTopicOverflow("PAYMENT", spill), WithSpill("/tmp/spill", 10)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o, err := newOptions(test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = o.checkServer()
+			if (err == nil) != test.ok {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+
+	_, err := NewEventServer("127.0.0.1", 0, WithSpill(t.TempDir(), 10), WithTopicOverflow("ORDER", spill))
+	if err == nil {
+		t.Fatal("event server is created with the spill client and the spill overflow")
+	}
+}
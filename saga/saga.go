@@ -0,0 +1,384 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/util"
+)
+
+type Status string
+
+const (
+	StatusRunning      Status = "RUNNING"
+	StatusCompensating Status = "COMPENSATING"
+	StatusCompleted    Status = "COMPLETED"
+	StatusCompensated  Status = "COMPENSATED"
+)
+
+var (
+	ErrSagaNotFound = errors.New("saga definition not found")
+	ErrCompensated  = errors.New("saga compensated")
+	ErrStepTimeout  = errors.New("saga step timeout")
+)
+
+//FallbackFunc is called when the step times out, it returns the event used as the step reply
+type FallbackFunc func(ctx context.Context, state *State) (string, error)
+
+//Step is a single saga transaction, Command is sent as request to the Topic subscribers,
+//the subscriber replies with one of SuccessEvents or FailureEvents
+//when Timeout is set and no reply arrives in time, TimeoutEvent is published and the Fallback decides
+//the step result, without Fallback the saga is compensated
+type Step struct {
+	Name          string
+	Topic         string
+	Command       string
+	SuccessEvents []string
+	FailureEvents []string
+	Compensation  string
+	Timeout       time.Duration
+	TimeoutEvent  string
+	Fallback      FallbackFunc
+}
+
+//Definition declares the saga as ordered list of steps
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+//State is the persisted state of a saga instance
+//Step points to the running step, or the next step to compensate backward while compensating
+type State struct {
+	ID        string      `json:"id"`
+	Saga      string      `json:"saga"`
+	Status    Status      `json:"status"`
+	Step      int         `json:"step"`
+	Payload   interface{} `json:"payload,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+//CommandPayload is the request payload received by the step participant
+type CommandPayload struct {
+	SagaID string      `json:"saga_id"`
+	Step   string      `json:"step"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+//Orchestrator drives the saga steps through the event server
+type Orchestrator struct {
+	mux    sync.Mutex
+	server engine.Server
+	store  Store
+	timers *TimerService
+	sagas  map[string]*Definition
+
+	//Logger receives the orchestrator logs, logger.Glog is used when it is not set
+	Logger logger.Logger
+}
+
+//NewOrchestrator creates saga orchestrator, the step timers are persisted when the store is a TimerStore
+func NewOrchestrator(server engine.Server, store Store) *Orchestrator {
+	timerStore, ok := store.(TimerStore)
+	if !ok {
+		timerStore = NewMemoryStore()
+	}
+
+	o := &Orchestrator{
+		server: server,
+		store:  store,
+		sagas:  make(map[string]*Definition),
+	}
+	o.timers = NewTimerService(timerStore, o.publishTimeout)
+	return o
+}
+
+//StartTimers publishes the timeout event of the steps passing their deadline until stopChan receives,
+//the deadlines passed while the orchestrator was stopped are published on start
+func (o *Orchestrator) StartTimers(stopChan <-chan bool) {
+	o.timers.Logger = o.getLogger()
+	o.timers.Run(stopChan)
+}
+
+//Register adds the saga definition
+func (o *Orchestrator) Register(def *Definition) error {
+	if def == nil || def.Name == "" {
+		return errors.New("saga name is required")
+	}
+
+	if len(def.Steps) == 0 {
+		return errors.New("saga should have at least one step")
+	}
+
+	for _, step := range def.Steps {
+		if step.Topic == "" || step.Command == "" {
+			return errors.New(fmt.Sprint("step topic and command are required ", step.Name))
+		}
+	}
+
+	o.mux.Lock()
+	o.sagas[def.Name] = def
+	o.mux.Unlock()
+	return nil
+}
+
+//Execute starts new saga instance and runs it until it is completed or compensated
+func (o *Orchestrator) Execute(ctx context.Context, sagaName string, payload interface{}) (*State, error) {
+	def, err := o.getSaga(sagaName)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	state := &State{
+		ID:        id,
+		Saga:      sagaName,
+		Status:    StatusRunning,
+		Payload:   payload,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = o.store.Save(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, o.run(ctx, def, state)
+}
+
+//Resume continues every unfinished saga instance found in the store, it is meant to be called on startup
+//the running step command is sent again, so the participants should be idempotent by saga id
+func (o *Orchestrator) Resume(ctx context.Context) error {
+	states, err := o.store.List()
+	if err != nil {
+		return err
+	}
+
+	for _, state := range states {
+		if state.Status != StatusRunning && state.Status != StatusCompensating {
+			continue
+		}
+
+		def, err := o.getSaga(state.Saga)
+		if err != nil {
+			o.getLogger().Error("resume saga fail", "saga", state.ID, "error", err)
+			continue
+		}
+
+		err = o.run(ctx, def, state)
+		if err != nil && err != ErrCompensated {
+			o.getLogger().Error("resume saga fail", "saga", state.ID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (o *Orchestrator) getLogger() logger.Logger {
+	if o.Logger == nil {
+		return logger.Glog{}
+	}
+	return o.Logger
+}
+
+func (o *Orchestrator) getSaga(name string) (*Definition, error) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	def, ok := o.sagas[name]
+	if !ok {
+		return nil, ErrSagaNotFound
+	}
+	return def, nil
+}
+
+//run executes the steps forward, and compensates backward when a step fails
+//the saga is left running when ctx is done, so it continues on Resume
+func (o *Orchestrator) run(ctx context.Context, def *Definition, state *State) error {
+	for state.Status == StatusRunning && state.Step < len(def.Steps) {
+		step := def.Steps[state.Step]
+		err := o.execStep(ctx, state, step)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			o.getLogger().Info("saga step fail", "saga", state.ID, "step", step.Name, "error", err)
+			state.Status = StatusCompensating
+			state.Error = err.Error()
+		} else {
+			state.Step++
+		}
+
+		err = o.save(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	if state.Status == StatusRunning {
+		state.Status = StatusCompleted
+		return o.save(state)
+	}
+
+	if state.Status == StatusCompensating {
+		err := o.compensate(def, state)
+		if err != nil {
+			return err
+		}
+		return ErrCompensated
+	}
+
+	return nil
+}
+
+//execStep sends the step command and checks the reply event
+func (o *Orchestrator) execStep(ctx context.Context, state *State, step Step) error {
+	parent := ctx
+	var timer *Timer
+	if step.Timeout > 0 {
+		var err error
+		timer, err = o.timers.Start(state.ID, state.Step, step.Topic, step.TimeoutEvent, step.Timeout)
+		if err != nil {
+			return err
+		}
+
+		if timer.Expired() {
+			defer o.stopTimer(state.ID)
+			return o.timeout(parent, state, step)
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, timer.Deadline)
+		defer cancel()
+	}
+
+	reply, err := o.server.Request(ctx, step.Topic, step.Command, CommandPayload{
+		SagaID: state.ID,
+		Step:   step.Name,
+		Data:   state.Payload,
+	})
+	if err != nil {
+		//the interrupted step keeps its timer, the deadline continues on Resume
+		if parent.Err() != nil {
+			return err
+		}
+
+		if timer != nil {
+			defer o.stopTimer(state.ID)
+			if timer.Expired() {
+				return o.timeout(parent, state, step)
+			}
+		}
+		return err
+	}
+
+	if timer != nil {
+		defer o.stopTimer(state.ID)
+	}
+
+	event, err := replyEvent(reply)
+	if err != nil {
+		return err
+	}
+
+	return checkEvent(step, event)
+}
+
+//timeout publishes the step timeout event unless the timer loop did, then runs the fallback
+func (o *Orchestrator) timeout(ctx context.Context, state *State, step Step) error {
+	o.getLogger().Info("saga step timeout", "saga", state.ID, "step", step.Name)
+	err := o.timers.Fire(state.ID)
+	if err != nil {
+		o.getLogger().Error("unable to publish timeout event", "saga", state.ID, "error", err)
+	}
+
+	if step.Fallback == nil {
+		return ErrStepTimeout
+	}
+
+	event, err := step.Fallback(ctx, state)
+	if err != nil {
+		return errors.New(fmt.Sprint("step fallback fail ", err.Error()))
+	}
+
+	return checkEvent(step, event)
+}
+
+//publishTimeout publishes the timeout event of the step, the event message is the saga id
+func (o *Orchestrator) publishTimeout(timer *Timer) error {
+	return o.server.PublishEvent(timer.Topic, timer.Event, timer.SagaID)
+}
+
+func (o *Orchestrator) stopTimer(sagaID string) {
+	err := o.timers.Stop(sagaID)
+	if err != nil {
+		o.getLogger().Error("unable to stop saga timer", "saga", sagaID, "error", err)
+	}
+}
+
+//compensate publishes compensation event of completed steps in reverse order
+//the compensation message is the saga id
+func (o *Orchestrator) compensate(def *Definition, state *State) error {
+	for state.Step > 0 {
+		step := def.Steps[state.Step-1]
+		if step.Compensation != "" {
+			err := o.server.PublishEvent(step.Topic, step.Compensation, state.ID)
+			if err != nil {
+				return errors.New(fmt.Sprint("compensation fail ", step.Name, " ", err.Error()))
+			}
+		}
+
+		state.Step--
+		err := o.save(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	state.Status = StatusCompensated
+	return o.save(state)
+}
+
+func (o *Orchestrator) save(state *State) error {
+	state.UpdatedAt = time.Now()
+	return o.store.Save(state)
+}
+
+//checkEvent checks whether the reply event is a success of the step
+func checkEvent(step Step, event string) error {
+	if util.InArrayStr(event, step.FailureEvents) {
+		return errors.New(fmt.Sprint("step replied with failure ", event))
+	}
+
+	if len(step.SuccessEvents) > 0 && !util.InArrayStr(event, step.SuccessEvents) {
+		return errors.New(fmt.Sprint("unexpected reply event ", event))
+	}
+
+	return nil
+}
+
+//replyEvent reads reply event name, the reply is either the event name or an object with event field
+func replyEvent(reply interface{}) (string, error) {
+	switch v := reply.(type) {
+	case string:
+		return v, nil
+	case map[string]interface{}:
+		if event, ok := v["event"].(string); ok {
+			return event, nil
+		}
+	}
+	return "", errors.New(fmt.Sprint("unable to read reply event ", reply))
+}
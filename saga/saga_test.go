@@ -0,0 +1,371 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/syariatifaris/genggar/engine"
+	"github.com/syariatifaris/genggar/logger"
+)
+
+//fakeServer answers the step commands with the configured replies and records the published events
+//the command without reply waits until the request context is done
+type fakeServer struct {
+	engine.Server
+
+	mux       sync.Mutex
+	replies   map[string]interface{}
+	requests  []string
+	published []string
+}
+
+func newFakeServer(replies map[string]interface{}) *fakeServer {
+	return &fakeServer{replies: replies}
+}
+
+func (f *fakeServer) Request(ctx context.Context, topic, event string, payload interface{}) (interface{}, error) {
+	f.mux.Lock()
+	f.requests = append(f.requests, event)
+	reply, ok := f.replies[event]
+	f.mux.Unlock()
+
+	if !ok {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if err, ok := reply.(error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (f *fakeServer) PublishEvent(topic, event, message string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.published = append(f.published, fmt.Sprint(topic, "/", event))
+	return nil
+}
+
+func (f *fakeServer) getRequests() []string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func (f *fakeServer) getPublished() []string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]string(nil), f.published...)
+}
+
+func orderSaga() *Definition {
+	return &Definition{
+		Name: "ORDER",
+		Steps: []Step{
+			{Name: "reserve", Topic: "STOCK", Command: "RESERVE_STOCK", Compensation: "RELEASE_STOCK"},
+			{Name: "charge", Topic: "PAYMENT", Command: "CHARGE", FailureEvents: []string{"CHARGE_FAILED"}, Compensation: "REFUND"},
+			{Name: "notify", Topic: "MAIL", Command: "NOTIFY"},
+			{Name: "ship", Topic: "SHIPPING", Command: "SHIP", SuccessEvents: []string{"SHIPPED"}},
+		},
+	}
+}
+
+func newTestOrchestrator(t *testing.T, server engine.Server, store Store) *Orchestrator {
+	o := NewOrchestrator(server, store)
+	o.Logger = logger.Nop{}
+	err := o.Register(orderSaga())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func sameStrings(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestExecute(t *testing.T) {
+	success := map[string]interface{}{
+		"RESERVE_STOCK": "STOCK_RESERVED",
+		"CHARGE":        map[string]interface{}{"event": "CHARGED"},
+		"NOTIFY":        "NOTIFIED",
+		"SHIP":          "SHIPPED",
+	}
+	with := func(command string, reply interface{}) map[string]interface{} {
+		replies := make(map[string]interface{})
+		for k, v := range success {
+			replies[k] = v
+		}
+		replies[command] = reply
+		return replies
+	}
+
+	tests := []struct {
+		name      string
+		replies   map[string]interface{}
+		status    Status
+		requests  []string
+		published []string
+	}{
+		{
+			name:     "completed",
+			replies:  success,
+			status:   StatusCompleted,
+			requests: []string{"RESERVE_STOCK", "CHARGE", "NOTIFY", "SHIP"},
+		},
+		{
+			name:     "first step fails",
+			replies:  with("RESERVE_STOCK", errors.New("out of stock")),
+			status:   StatusCompensated,
+			requests: []string{"RESERVE_STOCK"},
+		},
+		{
+			name:      "failure event",
+			replies:   with("CHARGE", "CHARGE_FAILED"),
+			status:    StatusCompensated,
+			requests:  []string{"RESERVE_STOCK", "CHARGE"},
+			published: []string{"STOCK/RELEASE_STOCK"},
+		},
+		{
+			name:      "unexpected event of the last step",
+			replies:   with("SHIP", "DELAYED"),
+			status:    StatusCompensated,
+			requests:  []string{"RESERVE_STOCK", "CHARGE", "NOTIFY", "SHIP"},
+			published: []string{"PAYMENT/REFUND", "STOCK/RELEASE_STOCK"},
+		},
+		{
+			name:      "unreadable reply",
+			replies:   with("SHIP", map[string]interface{}{"status": "SHIPPED"}),
+			status:    StatusCompensated,
+			requests:  []string{"RESERVE_STOCK", "CHARGE", "NOTIFY", "SHIP"},
+			published: []string{"PAYMENT/REFUND", "STOCK/RELEASE_STOCK"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(test.replies)
+			store := NewMemoryStore()
+			o := newTestOrchestrator(t, server, store)
+
+			state, err := o.Execute(context.Background(), "ORDER", "order-1")
+			if test.status == StatusCompensated && err != ErrCompensated {
+				t.Fatalf("got %v want %v", err, ErrCompensated)
+			}
+			if test.status == StatusCompleted && err != nil {
+				t.Fatal(err)
+			}
+
+			if state.Status != test.status || state.Step != 0 && test.status == StatusCompensated {
+				t.Fatalf("got %s at step %d", state.Status, state.Step)
+			}
+			if got := server.getRequests(); !sameStrings(got, test.requests) {
+				t.Fatalf("got requests %v want %v", got, test.requests)
+			}
+			if got := server.getPublished(); !sameStrings(got, test.published) {
+				t.Fatalf("got compensations %v want %v", got, test.published)
+			}
+
+			saved, err := store.Load(state.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.Status != test.status {
+				t.Fatalf("got saved %s want %s", saved.Status, test.status)
+			}
+		})
+	}
+
+	o := newTestOrchestrator(t, newFakeServer(success), NewMemoryStore())
+	if _, err := o.Execute(context.Background(), "UNKNOWN", nil); err != ErrSagaNotFound {
+		t.Fatalf("got %v want %v", err, ErrSagaNotFound)
+	}
+}
+
+//TestExecuteInterrupted checks the saga is left running when ctx is done, so it continues on Resume
+func TestExecuteInterrupted(t *testing.T) {
+	server := newFakeServer(map[string]interface{}{"RESERVE_STOCK": "STOCK_RESERVED"})
+	store := NewMemoryStore()
+	o := newTestOrchestrator(t, server, store)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	state, err := o.Execute(ctx, "ORDER", nil)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v want %v", err, context.DeadlineExceeded)
+	}
+
+	saved, err := store.Load(state.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusRunning || saved.Step != 1 {
+		t.Fatalf("got %s at step %d", saved.Status, saved.Step)
+	}
+	if got := server.getPublished(); len(got) != 0 {
+		t.Fatalf("got compensations %v", got)
+	}
+}
+
+func TestResume(t *testing.T) {
+	replies := map[string]interface{}{
+		"RESERVE_STOCK": "STOCK_RESERVED",
+		"CHARGE":        "CHARGED",
+		"NOTIFY":        "NOTIFIED",
+		"SHIP":          "SHIPPED",
+	}
+
+	tests := []struct {
+		name      string
+		state     State
+		status    Status
+		requests  []string
+		published []string
+	}{
+		{
+			name:     "running",
+			state:    State{Saga: "ORDER", Status: StatusRunning, Step: 2},
+			status:   StatusCompleted,
+			requests: []string{"NOTIFY", "SHIP"},
+		},
+		{
+			name:      "compensating",
+			state:     State{Saga: "ORDER", Status: StatusCompensating, Step: 3},
+			status:    StatusCompensated,
+			published: []string{"PAYMENT/REFUND", "STOCK/RELEASE_STOCK"},
+		},
+		{
+			name:   "completed",
+			state:  State{Saga: "ORDER", Status: StatusCompleted, Step: 4},
+			status: StatusCompleted,
+		},
+		{
+			name:   "unknown saga",
+			state:  State{Saga: "REFUND", Status: StatusRunning, Step: 1},
+			status: StatusRunning,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(replies)
+			store := NewMemoryStore()
+			o := newTestOrchestrator(t, server, store)
+
+			state := test.state
+			state.ID = "saga-1"
+			err := store.Save(&state)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = o.Resume(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			saved, err := store.Load("saga-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.Status != test.status {
+				t.Fatalf("got %s want %s", saved.Status, test.status)
+			}
+			if got := server.getRequests(); !sameStrings(got, test.requests) {
+				t.Fatalf("got requests %v want %v", got, test.requests)
+			}
+			if got := server.getPublished(); !sameStrings(got, test.published) {
+				t.Fatalf("got compensations %v want %v", got, test.published)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name string
+		def  *Definition
+		ok   bool
+	}{
+		{"valid", orderSaga(), true},
+		{"nil", nil, false},
+		{"without name", &Definition{Steps: orderSaga().Steps}, false},
+		{"without steps", &Definition{Name: "ORDER"}, false},
+		{"step without command", &Definition{Name: "ORDER", Steps: []Step{{Name: "reserve", Topic: "STOCK"}}}, false},
+		{"step without topic", &Definition{Name: "ORDER", Steps: []Step{{Name: "reserve", Command: "RESERVE_STOCK"}}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewOrchestrator(newFakeServer(nil), NewMemoryStore()).Register(test.def)
+			if (err == nil) != test.ok {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		success []string
+		failure []string
+		event   string
+		ok      bool
+	}{
+		{"any event", nil, nil, "DONE", true},
+		{"success event", []string{"DONE", "SKIPPED"}, nil, "SKIPPED", true},
+		{"not a success event", []string{"DONE"}, nil, "PENDING", false},
+		{"failure event", nil, []string{"FAILED"}, "FAILED", false},
+		{"other than failure event", nil, []string{"FAILED"}, "DONE", true},
+		{"failure listed as success", []string{"FAILED"}, []string{"FAILED"}, "FAILED", false},
+		{"empty event", []string{"DONE"}, nil, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkEvent(Step{SuccessEvents: test.success, FailureEvents: test.failure}, test.event)
+			if (err == nil) != test.ok {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestReplyEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply interface{}
+		event string
+		ok    bool
+	}{
+		{"event name", "DONE", "DONE", true},
+		{"object", map[string]interface{}{"event": "DONE", "id": 1}, "DONE", true},
+		{"object without event", map[string]interface{}{"status": "DONE"}, "", false},
+		{"object with non string event", map[string]interface{}{"event": 1}, "", false},
+		{"number", 1, "", false},
+		{"nil", nil, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := replyEvent(test.reply)
+			if (err == nil) != test.ok || event != test.event {
+				t.Fatalf("got %q, %v", event, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package saga
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const timerDir = "timers"
+
+var (
+	ErrStateNotFound = errors.New("saga state not found")
+	ErrTimerNotFound = errors.New("saga timer not found")
+)
+
+//Store persists the saga instance state
+type Store interface {
+	Save(state *State) error
+	Load(id string) (*State, error)
+	List() ([]*State, error)
+}
+
+//FileStore keeps each saga instance as a json file inside a directory
+type FileStore struct {
+	mux sync.Mutex
+	dir string
+}
+
+//NewFileStore creates file store, the directory is created when it does not exist
+//the step timers are kept inside timers sub directory
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(filepath.Join(dir, timerDir), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStore{
+		dir: dir,
+	}, nil
+}
+
+//Save writes the state into temporary file and renames it, so a crash never leaves partial state
+func (f *FileStore) Save(state *State) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.New(fmt.Sprint("marshall state fail ", err.Error()))
+	}
+
+	tmp := f.path(state.ID) + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.path(state.ID))
+}
+
+//Load reads the state by saga instance id
+func (f *FileStore) Load(id string) (*State, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return f.read(f.path(id))
+}
+
+//List reads all the stored states
+func (f *FileStore) List() ([]*State, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []*State
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		state, err := f.read(filepath.Join(f.dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+//SaveTimer writes the step timer
+func (f *FileStore) SaveTimer(timer *Timer) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	data, err := json.Marshal(timer)
+	if err != nil {
+		return errors.New(fmt.Sprint("marshall timer fail ", err.Error()))
+	}
+
+	path := f.timerPath(timer.SagaID)
+	err = ioutil.WriteFile(path+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+//LoadTimer reads the step timer of the saga
+func (f *FileStore) LoadTimer(sagaID string) (*Timer, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	data, err := ioutil.ReadFile(f.timerPath(sagaID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrTimerNotFound
+		}
+		return nil, err
+	}
+
+	var timer Timer
+	err = json.Unmarshal(data, &timer)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("unmarshall timer fail ", err.Error()))
+	}
+
+	return &timer, nil
+}
+
+//DeleteTimer removes the step timer of the saga
+func (f *FileStore) DeleteTimer(sagaID string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	err := os.Remove(f.timerPath(sagaID))
+	if os.IsNotExist(err) {
+		return ErrTimerNotFound
+	}
+	return err
+}
+
+//ListTimers reads all the step timers
+func (f *FileStore) ListTimers() ([]*Timer, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	files, err := ioutil.ReadDir(filepath.Join(f.dir, timerDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var timers []*Timer
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(f.dir, timerDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var timer Timer
+		err = json.Unmarshal(data, &timer)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("unmarshall timer fail ", err.Error()))
+		}
+		timers = append(timers, &timer)
+	}
+
+	return timers, nil
+}
+
+func (f *FileStore) timerPath(sagaID string) string {
+	return filepath.Join(f.dir, timerDir, sagaID+".json")
+}
+
+func (f *FileStore) path(id string) string {
+	return filepath.Join(f.dir, id+".json")
+}
+
+func (f *FileStore) read(path string) (*State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrStateNotFound
+		}
+		return nil, err
+	}
+
+	var state State
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("unmarshall state fail ", err.Error()))
+	}
+
+	return &state, nil
+}
+
+//MemoryStore keeps the states in memory, state is lost on restart
+type MemoryStore struct {
+	mux    sync.Mutex
+	states map[string]State
+	timers map[string]Timer
+}
+
+//NewMemoryStore creates in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[string]State),
+		timers: make(map[string]Timer),
+	}
+}
+
+//Save stores copy of the state
+func (m *MemoryStore) Save(state *State) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.states[state.ID] = *state
+	return nil
+}
+
+//Load gets copy of the state by saga instance id
+func (m *MemoryStore) Load(id string) (*State, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	state, ok := m.states[id]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return &state, nil
+}
+
+//List gets copy of all states
+func (m *MemoryStore) List() ([]*State, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var states []*State
+	for _, state := range m.states {
+		state := state
+		states = append(states, &state)
+	}
+
+	return states, nil
+}
+
+//SaveTimer stores copy of the step timer
+func (m *MemoryStore) SaveTimer(timer *Timer) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.timers[timer.SagaID] = *timer
+	return nil
+}
+
+//LoadTimer gets copy of the step timer of the saga
+func (m *MemoryStore) LoadTimer(sagaID string) (*Timer, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	timer, ok := m.timers[sagaID]
+	if !ok {
+		return nil, ErrTimerNotFound
+	}
+	return &timer, nil
+}
+
+//DeleteTimer removes the step timer of the saga
+func (m *MemoryStore) DeleteTimer(sagaID string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if _, ok := m.timers[sagaID]; !ok {
+		return ErrTimerNotFound
+	}
+
+	delete(m.timers, sagaID)
+	return nil
+}
+
+//ListTimers gets copy of all step timers
+func (m *MemoryStore) ListTimers() ([]*Timer, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var timers []*Timer
+	for _, timer := range m.timers {
+		timer := timer
+		timers = append(timers, &timer)
+	}
+
+	return timers, nil
+}
@@ -0,0 +1,180 @@
+package saga
+
+import (
+	"sync"
+	"time"
+
+	"github.com/syariatifaris/genggar/logger"
+)
+
+//DefaultTimerInterval is the interval of checking the due timers
+const DefaultTimerInterval = time.Second
+
+//Timer is the deadline of the running saga step, Event is published to the Topic when the deadline passes
+//Fired is set once the timeout event is published, so it is published once across restarts
+type Timer struct {
+	SagaID   string    `json:"saga_id"`
+	Step     int       `json:"step"`
+	Topic    string    `json:"topic,omitempty"`
+	Event    string    `json:"event,omitempty"`
+	Deadline time.Time `json:"deadline"`
+	Fired    bool      `json:"fired,omitempty"`
+}
+
+//Expired returns true when the deadline has passed
+func (t *Timer) Expired() bool {
+	return !time.Now().Before(t.Deadline)
+}
+
+//TimerStore persists the step timers, a saga instance has at most one timer
+type TimerStore interface {
+	SaveTimer(timer *Timer) error
+	LoadTimer(sagaID string) (*Timer, error)
+	DeleteTimer(sagaID string) error
+	ListTimers() ([]*Timer, error)
+}
+
+//TimeoutFunc publishes the timeout event of the timer
+type TimeoutFunc func(timer *Timer) error
+
+//TimerService keeps durable step deadline, the deadline is kept across restarts
+//Run publishes the timeout event of the due timers, including the timers which passed while stopped
+type TimerService struct {
+	mux      sync.Mutex
+	store    TimerStore
+	onExpire TimeoutFunc
+
+	//Interval of checking the due timers, DefaultTimerInterval is used when it is not set
+	Interval time.Duration
+	//Logger receives the timer logs, logger.Glog is used when it is not set
+	Logger logger.Logger
+}
+
+//NewTimerService creates timer service, onExpire is called once for every timer passing its deadline
+func NewTimerService(store TimerStore, onExpire TimeoutFunc) *TimerService {
+	return &TimerService{
+		store:    store,
+		onExpire: onExpire,
+	}
+}
+
+//Start starts the timer of the saga step, the persisted timer of the same step is reused
+func (t *TimerService) Start(sagaID string, step int, topic, event string, timeout time.Duration) (*Timer, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	timer, err := t.store.LoadTimer(sagaID)
+	if err == nil && timer.Step == step {
+		return timer, nil
+	}
+
+	if err != nil && err != ErrTimerNotFound {
+		return nil, err
+	}
+
+	timer = &Timer{
+		SagaID:   sagaID,
+		Step:     step,
+		Topic:    topic,
+		Event:    event,
+		Deadline: time.Now().Add(timeout),
+	}
+
+	err = t.store.SaveTimer(timer)
+	if err != nil {
+		return nil, err
+	}
+
+	return timer, nil
+}
+
+//Stop removes the timer of the saga
+func (t *TimerService) Stop(sagaID string) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	err := t.store.DeleteTimer(sagaID)
+	if err == ErrTimerNotFound {
+		return nil
+	}
+	return err
+}
+
+//Fire publishes the timeout event of the saga timer when it is due and not published yet
+func (t *TimerService) Fire(sagaID string) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	timer, err := t.store.LoadTimer(sagaID)
+	if err == ErrTimerNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return t.fire(timer)
+}
+
+//Run checks the due timers until stopChan receives, the timers due before the start are fired first
+func (t *TimerService) Run(stopChan <-chan bool) {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = DefaultTimerInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		t.FireDue()
+
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//FireDue publishes the timeout event of every due timer, the failed one is tried again on the next check
+func (t *TimerService) FireDue() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	timers, err := t.store.ListTimers()
+	if err != nil {
+		t.getLogger().Error("unable to list saga timers", "error", err)
+		return
+	}
+
+	for _, timer := range timers {
+		err := t.fire(timer)
+		if err != nil {
+			t.getLogger().Error("unable to fire saga timer", "saga", timer.SagaID, "error", err)
+		}
+	}
+}
+
+func (t *TimerService) getLogger() logger.Logger {
+	if t.Logger == nil {
+		return logger.Glog{}
+	}
+	return t.Logger
+}
+
+func (t *TimerService) fire(timer *Timer) error {
+	if timer.Fired || !timer.Expired() {
+		return nil
+	}
+
+	if t.onExpire != nil && timer.Event != "" {
+		err := t.onExpire(timer)
+		if err != nil {
+			return err
+		}
+	}
+
+	timer.Fired = true
+	return t.store.SaveTimer(timer)
+}
@@ -0,0 +1,263 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimerServiceFireDue(t *testing.T) {
+	tests := []struct {
+		name     string
+		deadline time.Duration
+		fired    bool
+		event    string
+		failing  bool
+		calls    int
+		wantFire bool
+	}{
+		{"expired", -time.Second, false, "TIMEOUT", false, 1, true},
+		{"not expired", time.Hour, false, "TIMEOUT", false, 0, false},
+		{"already fired", -time.Second, true, "TIMEOUT", false, 0, true},
+		{"without timeout event", -time.Second, false, "", false, 0, true},
+		{"publish fails", -time.Second, false, "TIMEOUT", true, 2, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			err := store.SaveTimer(&Timer{
+				SagaID:   "saga-1",
+				Topic:    "PAYMENT",
+				Event:    test.event,
+				Deadline: time.Now().Add(test.deadline),
+				Fired:    test.fired,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calls := 0
+			timers := NewTimerService(store, func(timer *Timer) error {
+				calls++
+				if test.failing {
+					return errors.New("server is closed")
+				}
+				return nil
+			})
+
+			//the fired timer is not published again, the failed one is tried again
+			timers.FireDue()
+			timers.FireDue()
+
+			if calls != test.calls {
+				t.Fatalf("got %d timeout events want %d", calls, test.calls)
+			}
+			timer, err := store.LoadTimer("saga-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if timer.Fired != test.wantFire {
+				t.Fatalf("got fired %v", timer.Fired)
+			}
+		})
+	}
+}
+
+func TestTimerServiceStart(t *testing.T) {
+	store := NewMemoryStore()
+	timers := NewTimerService(store, nil)
+
+	first, err := timers.Start("saga-1", 0, "STOCK", "TIMEOUT", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the resumed step keeps its deadline
+	again, err := timers.Start("saga-1", 0, "STOCK", "TIMEOUT", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Deadline.Equal(first.Deadline) {
+		t.Fatalf("got deadline %v want %v", again.Deadline, first.Deadline)
+	}
+
+	next, err := timers.Start("saga-1", 1, "PAYMENT", "TIMEOUT", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Step != 1 || !next.Deadline.Before(first.Deadline) {
+		t.Fatalf("got step %d deadline %v", next.Step, next.Deadline)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = timers.Stop("saga-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.LoadTimer("saga-1"); err != ErrTimerNotFound {
+		t.Fatalf("got %v want %v", err, ErrTimerNotFound)
+	}
+}
+
+//timeoutSaga is the order saga having the charge step without reply until its timeout
+func timeoutSaga(fallback FallbackFunc) *Definition {
+	def := orderSaga()
+	def.Steps[1].Timeout = 20 * time.Millisecond
+	def.Steps[1].TimeoutEvent = "CHARGE_TIMEOUT"
+	def.Steps[1].Fallback = fallback
+	return def
+}
+
+func TestStepTimeout(t *testing.T) {
+	replies := map[string]interface{}{
+		"RESERVE_STOCK": "STOCK_RESERVED",
+		"NOTIFY":        "NOTIFIED",
+		"SHIP":          "SHIPPED",
+	}
+	fallback := func(event string, err error) FallbackFunc {
+		return func(ctx context.Context, state *State) (string, error) {
+			return event, err
+		}
+	}
+
+	tests := []struct {
+		name      string
+		fallback  FallbackFunc
+		status    Status
+		stateErr  string
+		requests  []string
+		published []string
+	}{
+		{
+			name:      "fallback succeeds",
+			fallback:  fallback("CHARGED", nil),
+			status:    StatusCompleted,
+			requests:  []string{"RESERVE_STOCK", "CHARGE", "NOTIFY", "SHIP"},
+			published: []string{"PAYMENT/CHARGE_TIMEOUT"},
+		},
+		{
+			name:      "fallback replies failure",
+			fallback:  fallback("CHARGE_FAILED", nil),
+			status:    StatusCompensated,
+			requests:  []string{"RESERVE_STOCK", "CHARGE"},
+			published: []string{"PAYMENT/CHARGE_TIMEOUT", "STOCK/RELEASE_STOCK"},
+		},
+		{
+			name:      "fallback fails",
+			fallback:  fallback("", errors.New("payment is unknown")),
+			status:    StatusCompensated,
+			requests:  []string{"RESERVE_STOCK", "CHARGE"},
+			published: []string{"PAYMENT/CHARGE_TIMEOUT", "STOCK/RELEASE_STOCK"},
+		},
+		{
+			name:      "without fallback",
+			status:    StatusCompensated,
+			stateErr:  ErrStepTimeout.Error(),
+			requests:  []string{"RESERVE_STOCK", "CHARGE"},
+			published: []string{"PAYMENT/CHARGE_TIMEOUT", "STOCK/RELEASE_STOCK"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(replies)
+			store := NewMemoryStore()
+			o := NewOrchestrator(server, store)
+			err := o.Register(timeoutSaga(test.fallback))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state, err := o.Execute(context.Background(), "ORDER", nil)
+			if test.status == StatusCompleted && err != nil || test.status == StatusCompensated && err != ErrCompensated {
+				t.Fatalf("got %v", err)
+			}
+			if state.Status != test.status {
+				t.Fatalf("got %s want %s", state.Status, test.status)
+			}
+			if test.stateErr != "" && state.Error != test.stateErr {
+				t.Fatalf("got error %q want %q", state.Error, test.stateErr)
+			}
+			if got := server.getRequests(); !sameStrings(got, test.requests) {
+				t.Fatalf("got requests %v want %v", got, test.requests)
+			}
+			if got := server.getPublished(); !sameStrings(got, test.published) {
+				t.Fatalf("got published %v want %v", got, test.published)
+			}
+
+			//the timer of the finished step is removed
+			timers, err := store.ListTimers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(timers) != 0 {
+				t.Fatalf("got timers %v", timers)
+			}
+		})
+	}
+}
+
+//TestResumeExpiredTimer checks the deadline passed while stopped runs the fallback without sending the command,
+//and the timeout event published by the timer loop is not published again
+func TestResumeExpiredTimer(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Save(&State{ID: "saga-1", Saga: "ORDER", Status: StatusRunning, Step: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SaveTimer(&Timer{
+		SagaID:   "saga-1",
+		Step:     1,
+		Topic:    "PAYMENT",
+		Event:    "CHARGE_TIMEOUT",
+		Deadline: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the restarted orchestrator fires the due timer first
+	server := newFakeServer(map[string]interface{}{"NOTIFY": "NOTIFIED", "SHIP": "SHIPPED"})
+	store, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := NewOrchestrator(server, store)
+	err = o.Register(timeoutSaga(func(ctx context.Context, state *State) (string, error) {
+		return "CHARGED", nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.timers.FireDue()
+
+	err = o.Resume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := store.Load("saga-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != StatusCompleted {
+		t.Fatalf("got %s want %s", state.Status, StatusCompleted)
+	}
+	if got, want := server.getRequests(), []string{"NOTIFY", "SHIP"}; !sameStrings(got, want) {
+		t.Fatalf("got requests %v want %v", got, want)
+	}
+	if got, want := server.getPublished(), []string{"PAYMENT/CHARGE_TIMEOUT"}; !sameStrings(got, want) {
+		t.Fatalf("got published %v want %v", got, want)
+	}
+	if _, err := store.LoadTimer("saga-1"); err != ErrTimerNotFound {
+		t.Fatalf("got %v want %v", err, ErrTimerNotFound)
+	}
+}
@@ -0,0 +1,82 @@
+package saga
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/syariatifaris/genggar/eventstore"
+	"github.com/syariatifaris/genggar/util"
+)
+
+//TimelineEntry is a record of the saga event chain
+//Compensation is true when the published event is one of the compensation events
+type TimelineEntry struct {
+	*eventstore.Record
+	Compensation bool `json:"compensation"`
+}
+
+//Timeline is the reconstructed chain of events sharing the same correlation id
+type Timeline struct {
+	CorrelationID string           `json:"correlation_id"`
+	Entries       []*TimelineEntry `json:"entries"`
+	Participants  []string         `json:"participants"`
+	Failures      []*TimelineEntry `json:"failures"`
+	Compensations []*TimelineEntry `json:"compensations"`
+}
+
+//Trace reconstructs choreography saga timeline from the event store
+//compensations lists the event names treated as compensation
+func Trace(store eventstore.Store, correlationID string, compensations ...string) (*Timeline, error) {
+	if correlationID == "" {
+		return nil, errors.New("correlation id is required")
+	}
+
+	records, err := store.ByCorrelation(correlationID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+
+	timeline := &Timeline{
+		CorrelationID: correlationID,
+	}
+
+	for _, rec := range records {
+		entry := &TimelineEntry{
+			Record:       rec,
+			Compensation: rec.Kind == eventstore.KindPublished && util.InArrayStr(rec.Event, compensations),
+		}
+		timeline.Entries = append(timeline.Entries, entry)
+
+		switch rec.Kind {
+		case eventstore.KindProcessed, eventstore.KindFailed:
+			if !util.InArrayStr(rec.Source, timeline.Participants) {
+				timeline.Participants = append(timeline.Participants, rec.Source)
+			}
+		}
+
+		if rec.Kind == eventstore.KindFailed {
+			timeline.Failures = append(timeline.Failures, entry)
+		}
+
+		if entry.Compensation {
+			timeline.Compensations = append(timeline.Compensations, entry)
+		}
+	}
+
+	return timeline, nil
+}
+
+//CausedBy returns the published entries directly caused by the event uuid
+func (t *Timeline) CausedBy(uuid string) []*TimelineEntry {
+	var entries []*TimelineEntry
+	for _, entry := range t.Entries {
+		if entry.Kind == eventstore.KindPublished && entry.CausationID == uuid {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,80 @@
+package saga
+
+import (
+	"testing"
+
+	"github.com/syariatifaris/genggar/eventstore"
+)
+
+func TestTrace(t *testing.T) {
+	store := eventstore.NewMemoryStore()
+	records := []*eventstore.Record{
+		{Kind: eventstore.KindPublished, UUID: "e1", Event: "NEW_ORDER", CorrelationID: "c1"},
+		{Kind: eventstore.KindProcessed, UUID: "e1", Event: "NEW_ORDER", CorrelationID: "c1", Source: "stock"},
+		{Kind: eventstore.KindPublished, UUID: "e2", Event: "STOCK_RESERVED", CorrelationID: "c1", CausationID: "e1"},
+		{Kind: eventstore.KindPublished, UUID: "x1", Event: "NEW_ORDER", CorrelationID: "c2"},
+		{Kind: eventstore.KindProcessed, UUID: "e2", Event: "STOCK_RESERVED", CorrelationID: "c1", Source: "stock"},
+		{Kind: eventstore.KindFailed, UUID: "e2", Event: "STOCK_RESERVED", CorrelationID: "c1", Source: "payment"},
+		{Kind: eventstore.KindPublished, UUID: "e3", Event: "RELEASE_STOCK", CorrelationID: "c1", CausationID: "e2"},
+		{Kind: eventstore.KindProcessed, UUID: "e3", Event: "RELEASE_STOCK", CorrelationID: "c1", Source: "stock"},
+	}
+	for _, rec := range records {
+		err := store.Append(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timeline, err := Trace(store, "c1", "RELEASE_STOCK")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uuids []string
+	for _, entry := range timeline.Entries {
+		uuids = append(uuids, entry.UUID)
+	}
+	if want := []string{"e1", "e1", "e2", "e2", "e2", "e3", "e3"}; !sameStrings(uuids, want) {
+		t.Fatalf("got entries %v want %v", uuids, want)
+	}
+	if want := []string{"stock", "payment"}; !sameStrings(timeline.Participants, want) {
+		t.Fatalf("got participants %v want %v", timeline.Participants, want)
+	}
+	if len(timeline.Failures) != 1 || timeline.Failures[0].Source != "payment" {
+		t.Fatalf("got failures %v", timeline.Failures)
+	}
+
+	//only the published compensation is a compensation entry
+	if len(timeline.Compensations) != 1 || timeline.Compensations[0].Seq != 7 {
+		t.Fatalf("got compensations %v", timeline.Compensations)
+	}
+
+	tests := []struct {
+		uuid   string
+		caused []string
+	}{
+		{"e1", []string{"e2"}},
+		{"e2", []string{"e3"}},
+		{"e3", nil},
+		{"x1", nil},
+	}
+	for _, test := range tests {
+		var caused []string
+		for _, entry := range timeline.CausedBy(test.uuid) {
+			caused = append(caused, entry.UUID)
+		}
+		if !sameStrings(caused, test.caused) {
+			t.Fatalf("got %v caused by %s want %v", caused, test.uuid, test.caused)
+		}
+	}
+
+	_, err = Trace(store, "")
+	if err == nil {
+		t.Fatal("empty correlation id is traced")
+	}
+
+	empty, err := Trace(store, "c3")
+	if err != nil || len(empty.Entries) != 0 {
+		t.Fatalf("got %v, %v for unknown correlation", empty, err)
+	}
+}
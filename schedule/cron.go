@@ -0,0 +1,162 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//cron field bounds
+type bounds struct {
+	min, max uint
+}
+
+var (
+	minuteBound = bounds{0, 59}
+	hourBound   = bounds{0, 23}
+	domBound    = bounds{1, 31}
+	monthBound  = bounds{1, 12}
+	dowBound    = bounds{0, 6}
+
+	descriptors = map[string]string{
+		"@yearly":  "0 0 1 1 *",
+		"@monthly": "0 0 1 * *",
+		"@weekly":  "0 0 * * 0",
+		"@daily":   "0 0 * * *",
+		"@hourly":  "0 * * * *",
+	}
+)
+
+//Cron is parsed five fields cron expression: minute hour day-of-month month day-of-week
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+//ParseCron parses the cron expression, it supports *, lists, ranges, steps and @daily like descriptors
+func ParseCron(spec string) (*Cron, error) {
+	spec = strings.TrimSpace(spec)
+	if desc, ok := descriptors[spec]; ok {
+		spec = desc
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprint("cron should have 5 fields ", spec))
+	}
+
+	var err error
+	c := &Cron{
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+
+	if c.minute, err = parseField(fields[0], minuteBound); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseField(fields[1], hourBound); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseField(fields[2], domBound); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseField(fields[3], monthBound); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseField(fields[4], dowBound); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+//Next returns the next activation time after t, zero time when there is none in five years
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !c.dayMatch(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+//dayMatch follows the standard cron rule, when both day fields are restricted either one matches
+func (c *Cron) dayMatch(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+//parseField parses comma separated cron field into bit set
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := uint(1)
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.ParseUint(part[idx+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, errors.New(fmt.Sprint("invalid cron step ", part))
+			}
+			step = uint(s)
+			part = part[:idx]
+		}
+
+		start, end := b.min, b.max
+		if part != "*" {
+			rng := strings.SplitN(part, "-", 2)
+			v, err := strconv.ParseUint(rng[0], 10, 8)
+			if err != nil {
+				return 0, errors.New(fmt.Sprint("invalid cron value ", part))
+			}
+			start, end = uint(v), uint(v)
+
+			if len(rng) == 2 {
+				v, err = strconv.ParseUint(rng[1], 10, 8)
+				if err != nil {
+					return 0, errors.New(fmt.Sprint("invalid cron range ", part))
+				}
+				end = uint(v)
+			} else if step > 1 {
+				end = b.max
+			}
+		}
+
+		if start < b.min || end > b.max || start > end {
+			return 0, errors.New(fmt.Sprint("cron value out of range ", part))
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
@@ -0,0 +1,101 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"@daily", true},
+		{" @hourly ", true},
+		{"*/15 * * * *", true},
+		{"0-30/10 9-17 * * 1-5", true},
+		{"5/20 * * * *", true},
+		{"0 0 1,15 * *", true},
+		{"59 23 31 12 6", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"@every 5m", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * 32 * *", false},
+		{"* * * 0 *", false},
+		{"* * * 13 *", false},
+		{"* * * * 7", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"a * * * *", false},
+		{"-1 * * * *", false},
+		{"30-10 * * * *", false},
+		{"1-x * * * *", false},
+		{"1,,2 * * * *", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			_, err := ParseCron(test.spec)
+			if (err == nil) != test.ok {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", date(2024, 1, 1, 10, 0, 30), date(2024, 1, 1, 10, 1, 0)},
+		{"current minute is excluded", "0 * * * *", date(2024, 1, 1, 10, 0, 0), date(2024, 1, 1, 11, 0, 0)},
+		{"next day", "@hourly", date(2024, 1, 1, 23, 30, 0), date(2024, 1, 2, 0, 0, 0)},
+		{"step", "*/15 * * * *", date(2024, 1, 1, 10, 14, 0), date(2024, 1, 1, 10, 15, 0)},
+		{"step to next hour", "*/15 * * * *", date(2024, 1, 1, 10, 45, 0), date(2024, 1, 1, 11, 0, 0)},
+		{"step from value", "5/20 * * * *", date(2024, 1, 1, 10, 6, 0), date(2024, 1, 1, 10, 25, 0)},
+		{"list", "0 0 1,15 * *", date(2024, 1, 2, 0, 0, 0), date(2024, 1, 15, 0, 0, 0)},
+		{"next year", "@yearly", date(2024, 6, 1, 0, 0, 0), date(2025, 1, 1, 0, 0, 0)},
+		{"end of year", "59 23 31 12 *", date(2024, 12, 31, 23, 59, 0), date(2025, 12, 31, 23, 59, 0)},
+		{"month range", "0 12 * 6-8 *", date(2024, 9, 1, 0, 0, 0), date(2025, 6, 1, 12, 0, 0)},
+		{"day missing in month", "0 0 31 * *", date(2024, 4, 1, 0, 0, 0), date(2024, 5, 31, 0, 0, 0)},
+		{"leap day", "0 0 29 2 *", date(2024, 3, 1, 0, 0, 0), date(2028, 2, 29, 0, 0, 0)},
+		{"never", "0 0 30 2 *", date(2024, 1, 1, 0, 0, 0), time.Time{}},
+		{"sunday", "@weekly", date(2024, 1, 1, 0, 0, 0), date(2024, 1, 7, 0, 0, 0)},
+		{"weekdays", "0 9 * * 1-5", date(2024, 1, 6, 10, 0, 0), date(2024, 1, 8, 9, 0, 0)},
+		{"day of month or weekday", "0 0 13 * 5", date(2024, 1, 1, 0, 0, 0), date(2024, 1, 5, 0, 0, 0)},
+		{"day of month before weekday", "0 0 13 * 5", date(2024, 2, 10, 0, 0, 0), date(2024, 2, 13, 0, 0, 0)},
+		{"day of month with any weekday", "0 0 13 * *", date(2024, 1, 1, 0, 0, 0), date(2024, 1, 13, 0, 0, 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cron, err := ParseCron(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cron.Next(test.from); !got.Equal(test.want) {
+				t.Fatalf("got %v want %v", got, test.want)
+			}
+		})
+	}
+
+	//the activation is in the location of the given time
+	jakarta := time.FixedZone("WIB", 7*3600)
+	cron, _ := ParseCron("@daily")
+	got := cron.Next(time.Date(2024, 1, 1, 12, 0, 0, 0, jakarta))
+	if want := time.Date(2024, 1, 2, 0, 0, 0, 0, jakarta); !got.Equal(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+}
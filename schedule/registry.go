@@ -0,0 +1,292 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/syariatifaris/genggar/eventstore"
+	"github.com/syariatifaris/genggar/logger"
+	"github.com/syariatifaris/genggar/util"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+const (
+	//retryBackoff is the first wait of the schedule failed to publish, doubled up to maxRetryBackoff
+	retryBackoff    = time.Second
+	maxRetryBackoff = time.Minute
+)
+
+//PublishFunc publishes the event when the schedule is due, the error means the event is not published
+//so it is tried again later, a partial fan out should not be reported as error
+type PublishFunc func(topic, event, message string) error
+
+//Entry is a pending scheduled event, Cron is set for recurring event
+type Entry struct {
+	ID      string    `json:"id"`
+	Topic   string    `json:"topic"`
+	Event   string    `json:"event"`
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at"`
+	Cron    string    `json:"cron,omitempty"`
+
+	cron     *Cron
+	attempts int
+	retryAt  time.Time
+}
+
+//Registry keeps the scheduled events, every change is recorded into the event store
+//so the pending schedules are rebuilt by Load after restart
+type Registry struct {
+	mux     sync.Mutex
+	store   eventstore.Store
+	publish PublishFunc
+	entries map[string]*Entry
+
+	//Logger receives the registry logs, logger.Glog is used when it is not set
+	Logger logger.Logger
+}
+
+//NewRegistry creates schedule registry, store can be nil for non durable schedules
+func NewRegistry(store eventstore.Store, publish PublishFunc) *Registry {
+	return &Registry{
+		store:   store,
+		publish: publish,
+		entries: make(map[string]*Entry),
+	}
+}
+
+//Load rebuilds the pending schedules from the event store
+func (r *Registry) Load() error {
+	if r.store == nil {
+		return nil
+	}
+
+	entries := make(map[string]*Entry)
+	err := r.store.Scan(0, func(rec *eventstore.Record) bool {
+		switch rec.Kind {
+		case eventstore.KindScheduled:
+			entry := &Entry{
+				ID:      rec.ScheduleID,
+				Topic:   rec.Topic,
+				Event:   rec.Event,
+				Message: rec.Message,
+				Cron:    rec.Cron,
+			}
+			if rec.DeliverAt != nil {
+				entry.At = *rec.DeliverAt
+			}
+			entries[rec.ScheduleID] = entry
+		case eventstore.KindFired:
+			entry, ok := entries[rec.ScheduleID]
+			if ok && entry.Cron == "" {
+				delete(entries, rec.ScheduleID)
+			}
+		case eventstore.KindCancelled:
+			delete(entries, rec.ScheduleID)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for id, entry := range entries {
+		if entry.Cron == "" {
+			continue
+		}
+
+		//missed recurring activations during downtime are skipped
+		entry.cron, err = ParseCron(entry.Cron)
+		if err != nil {
+			r.getLogger().Error("invalid stored cron", "schedule", id, "error", err)
+			delete(entries, id)
+			continue
+		}
+		entry.At = entry.cron.Next(now)
+	}
+
+	r.mux.Lock()
+	r.entries = entries
+	r.mux.Unlock()
+	return nil
+}
+
+//At schedules the event to be published at the given time
+func (r *Registry) At(topic, event, message string, at time.Time) (string, error) {
+	return r.add(&Entry{
+		Topic:   topic,
+		Event:   event,
+		Message: message,
+		At:      at,
+	})
+}
+
+//Cron schedules recurring event using cron expression
+func (r *Registry) Cron(topic, event, message, spec string) (string, error) {
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return "", err
+	}
+
+	next := cron.Next(time.Now())
+	if next.IsZero() {
+		return "", errors.New(fmt.Sprint("cron has no next activation ", spec))
+	}
+
+	return r.add(&Entry{
+		Topic:   topic,
+		Event:   event,
+		Message: message,
+		At:      next,
+		Cron:    spec,
+		cron:    cron,
+	})
+}
+
+//Cancel cancels the pending schedule
+func (r *Registry) Cancel(id string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entry, ok := r.entries[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+
+	err := r.record(eventstore.KindCancelled, entry)
+	if err != nil {
+		return err
+	}
+
+	delete(r.entries, id)
+	return nil
+}
+
+//List returns the pending schedules ordered by the next delivery time
+func (r *Registry) List() []Entry {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entries := make([]Entry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	return entries
+}
+
+//FireDue publishes every schedule due at the given time, the publishing is not holding the registry
+//the schedule failed to publish is tried again with backoff
+func (r *Registry) FireDue(now time.Time) {
+	for _, entry := range r.due(now) {
+		err := r.publish(entry.Topic, entry.Event, entry.Message)
+		r.fired(entry, now, err)
+	}
+}
+
+//due returns the copy of the due schedules
+func (r *Registry) due(now time.Time) []Entry {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var entries []Entry
+	for _, entry := range r.entries {
+		if entry.At.After(now) || entry.retryAt.After(now) {
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+//fired records the publish result of the schedule, the schedule cancelled meanwhile is left removed
+func (r *Registry) fired(fired Entry, now time.Time, pubErr error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entry, ok := r.entries[fired.ID]
+	if !ok {
+		return
+	}
+
+	if pubErr != nil {
+		backoff := retryBackoff << uint(entry.attempts)
+		if backoff > maxRetryBackoff || backoff <= 0 {
+			backoff = maxRetryBackoff
+		}
+		entry.attempts++
+		entry.retryAt = now.Add(backoff)
+		r.getLogger().Error("unable to publish scheduled event", "schedule", entry.ID, "retry_in", backoff.String(), "error", pubErr)
+		return
+	}
+	entry.attempts = 0
+	entry.retryAt = time.Time{}
+
+	err := r.record(eventstore.KindFired, entry)
+	if err != nil {
+		r.getLogger().Error("unable to record scheduled event", "schedule", entry.ID, "error", err)
+	}
+
+	if entry.cron == nil {
+		delete(r.entries, entry.ID)
+		return
+	}
+
+	entry.At = entry.cron.Next(now)
+	if entry.At.IsZero() {
+		delete(r.entries, entry.ID)
+	}
+}
+
+func (r *Registry) getLogger() logger.Logger {
+	if r.Logger == nil {
+		return logger.Glog{}
+	}
+	return r.Logger
+}
+
+func (r *Registry) add(entry *Entry) (string, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return "", err
+	}
+	entry.ID = id
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	err = r.record(eventstore.KindScheduled, entry)
+	if err != nil {
+		return "", err
+	}
+
+	r.entries[id] = entry
+	return id, nil
+}
+
+func (r *Registry) record(kind eventstore.Kind, entry *Entry) error {
+	if r.store == nil {
+		return nil
+	}
+
+	at := entry.At
+	return r.store.Append(&eventstore.Record{
+		Kind:       kind,
+		Topic:      entry.Topic,
+		Event:      entry.Event,
+		Message:    entry.Message,
+		ScheduleID: entry.ID,
+		DeliverAt:  &at,
+		Cron:       entry.Cron,
+	})
+}
@@ -0,0 +1,227 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/syariatifaris/genggar/eventstore"
+	"github.com/syariatifaris/genggar/logger"
+)
+
+//testPublisher records the published schedules, it fails while err is set
+type testPublisher struct {
+	mux       sync.Mutex
+	err       error
+	published []string
+}
+
+func (p *testPublisher) publish(topic, event, message string) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, fmt.Sprint(topic, "/", event))
+	return nil
+}
+
+func (p *testPublisher) count() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return len(p.published)
+}
+
+func scheduleIDs(r *Registry) map[string]Entry {
+	entries := make(map[string]Entry)
+	for _, entry := range r.List() {
+		entries[entry.ID] = entry
+	}
+	return entries
+}
+
+//TestRegistryLoad checks the pending schedules are rebuilt after the cancel and the fire
+func TestRegistryLoad(t *testing.T) {
+	store := eventstore.NewMemoryStore()
+	pub := &testPublisher{}
+	r := NewRegistry(store, pub.publish)
+	now := time.Now()
+
+	pending, err := r.At("ORDER", "REMIND", "order-1", now.Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := r.At("ORDER", "EXPIRE", "order-1", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fired, err := r.At("ORDER", "NOTIFY", "order-1", now.Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recurring, err := r.Cron("REPORT", "DAILY_REPORT", "", "@daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Cancel(cancelled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Cancel(cancelled); err != ErrScheduleNotFound {
+		t.Fatalf("got %v want %v", err, ErrScheduleNotFound)
+	}
+
+	//the recurring schedule is fired as well and stays pending
+	r.FireDue(now.Add(25 * time.Hour).Add(-30 * time.Minute))
+	if pub.count() != 2 {
+		t.Fatalf("got published %v", pub.published)
+	}
+
+	//the stored schedule with invalid cron is dropped
+	err = store.Append(&eventstore.Record{Kind: eventstore.KindScheduled, ScheduleID: "invalid", Cron: "* *"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewRegistry(store, pub.publish)
+	restarted.Logger = logger.Nop{}
+	err = restarted.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := scheduleIDs(restarted)
+	tests := []struct {
+		name    string
+		id      string
+		pending bool
+	}{
+		{"pending", pending, true},
+		{"cancelled", cancelled, false},
+		{"fired", fired, false},
+		{"recurring", recurring, true},
+		{"invalid cron", "invalid", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, ok := entries[test.id]
+			if ok != test.pending {
+				t.Fatalf("got pending %v", ok)
+			}
+		})
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d pending schedules want 2", len(entries))
+	}
+
+	entry := entries[pending]
+	if entry.Topic != "ORDER" || entry.Event != "REMIND" || entry.Message != "order-1" || !entry.At.Equal(now.Add(48*time.Hour)) {
+		t.Fatalf("got %+v", entry)
+	}
+
+	//the missed recurring activation is skipped
+	entry = entries[recurring]
+	if !entry.At.After(time.Now()) || entry.At.After(time.Now().Add(24*time.Hour)) {
+		t.Fatalf("got next activation %v", entry.At)
+	}
+
+	restarted.FireDue(entry.At)
+	if pub.count() != 3 || len(restarted.List()) != 2 {
+		t.Fatalf("got published %v, %d pending", pub.published, len(restarted.List()))
+	}
+}
+
+//TestRegistryFireDue checks the failed schedule is retried with the doubled backoff up to maxRetryBackoff
+func TestRegistryFireDue(t *testing.T) {
+	pub := &testPublisher{err: errors.New("topic has no subscriber")}
+	r := NewRegistry(nil, pub.publish)
+	r.Logger = logger.Nop{}
+	now := time.Now()
+
+	id, err := r.At("ORDER", "REMIND", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{5, 32 * time.Second},
+		{6, maxRetryBackoff},
+		{40, maxRetryBackoff},
+		{100, maxRetryBackoff},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint("attempt ", test.attempts), func(t *testing.T) {
+			r.mux.Lock()
+			r.entries[id].attempts = test.attempts
+			r.entries[id].retryAt = time.Time{}
+			r.mux.Unlock()
+
+			r.FireDue(now)
+			entry := r.entries[id]
+			if entry.attempts != test.attempts+1 || !entry.retryAt.Equal(now.Add(test.backoff)) {
+				t.Fatalf("got %d attempts retry in %v", entry.attempts, entry.retryAt.Sub(now))
+			}
+
+			//the schedule is not tried again before its backoff
+			r.FireDue(now.Add(test.backoff - time.Millisecond))
+			if r.entries[id].attempts != test.attempts+1 {
+				t.Fatal("schedule is retried before its backoff")
+			}
+		})
+	}
+
+	pub.mux.Lock()
+	pub.err = nil
+	pub.mux.Unlock()
+
+	r.FireDue(now.Add(maxRetryBackoff))
+	if pub.count() != 1 || len(r.List()) != 0 {
+		t.Fatalf("got published %v, %d pending", pub.published, len(r.List()))
+	}
+}
+
+//TestRegistryFiredCancelled checks the schedule cancelled while it is published is not restored
+func TestRegistryFiredCancelled(t *testing.T) {
+	store := eventstore.NewMemoryStore()
+	r := NewRegistry(store, nil)
+	r.publish = func(topic, event, message string) error {
+		for _, entry := range r.List() {
+			if err := r.Cancel(entry.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err := r.Cron("REPORT", "DAILY_REPORT", "", "* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.FireDue(time.Now().Add(time.Hour))
+	if len(r.List()) != 0 {
+		t.Fatalf("got pending %v", r.List())
+	}
+
+	var kinds []eventstore.Kind
+	err = store.Scan(0, func(rec *eventstore.Record) bool {
+		kinds = append(kinds, rec.Kind)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kinds) != 2 || kinds[1] != eventstore.KindCancelled {
+		t.Fatalf("got records %v", kinds)
+	}
+}
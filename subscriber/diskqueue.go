@@ -0,0 +1,350 @@
+package subscriber
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+//compactSize is the read prefix from which the file is compacted, when it is more than half of the file
+const compactSize = 64 * 1024
+
+//diskQueue is a file backed fifo queue, every item is stored as a json line
+//the file is truncated when all items have been read, and compacted when the read prefix is its larger half
+//the items pushed to the front are kept in a separate stack file and served first
+//the read position is kept in the offset file, so the queue is reopened with its unread items after restart
+type diskQueue struct {
+	mux    sync.Mutex
+	path   string
+	file   *os.File
+	reader *bufio.Reader
+	head   int64
+	size   int64
+	count  int
+
+	offset  *os.File
+	stack   *os.File
+	offsets []int64
+}
+
+//diskItem is the stored line, the priority is restored when the item is moved back to memory
+type diskItem struct {
+	Priority Priority        `json:"priority,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func newDiskQueue(path string) (*diskQueue, error) {
+	q := &diskQueue{path: path}
+
+	var err error
+	q.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err == nil {
+		q.stack, err = os.OpenFile(path+".front", os.O_RDWR|os.O_CREATE, 0644)
+	}
+	if err == nil {
+		q.offset, err = os.OpenFile(path+".offset", os.O_RDWR|os.O_CREATE, 0644)
+	}
+	if err == nil {
+		err = q.load()
+	}
+	if err != nil {
+		q.close()
+		return nil, errors.New(fmt.Sprint("open disk queue fail ", err.Error()))
+	}
+
+	return q, nil
+}
+
+//load rebuilds the queue from the files, the partial line of the interrupted write is discarded
+func (q *diskQueue) load() error {
+	data, err := ioutil.ReadAll(q.offset)
+	if err != nil {
+		return err
+	}
+	if len(data) >= 8 {
+		q.head = int64(binary.BigEndian.Uint64(data))
+	}
+
+	info, err := q.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	//the read position beyond the end is a stale offset of the replaced file, the queue starts again
+	if q.head > info.Size() {
+		q.head = 0
+	}
+
+	q.size, q.count, err = scanLines(q.file, q.head, nil)
+	if err != nil {
+		return err
+	}
+
+	err = q.file.Truncate(q.size)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.file.Seek(q.head, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	q.reader = bufio.NewReader(q.file)
+
+	stackSize, _, err := scanLines(q.stack, 0, func(end int64) {
+		q.offsets = append(q.offsets, end)
+	})
+	if err != nil {
+		return err
+	}
+	return q.stack.Truncate(stackSize)
+}
+
+//scanLines counts the complete lines from the start, fn receives the end of every line
+//it returns the end of the last complete line
+func scanLines(file *os.File, start int64, fn func(end int64)) (int64, int, error) {
+	_, err := file.Seek(start, io.SeekStart)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	end := start
+	count := 0
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return end, count, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		end += int64(len(line))
+		count++
+		if fn != nil {
+			fn(end)
+		}
+	}
+}
+
+//push appends the item at the end of the file
+func (q *diskQueue) push(data interface{}) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	line, err := encodeDiskItem(data, priorityOf(data))
+	if err != nil {
+		return err
+	}
+
+	//write at the tracked end, the file offset belongs to the reader
+	n, err := q.file.WriteAt(line, q.size)
+	q.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	q.count++
+	return nil
+}
+
+//pushFront puts the item before all queued items
+func (q *diskQueue) pushFront(data interface{}, priority Priority) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	line, err := encodeDiskItem(data, priority)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if n := len(q.offsets); n > 0 {
+		offset = q.offsets[n-1]
+	}
+
+	//the stack file holds the lines back to back, offsets keeps the end of every line
+	_, err = q.stack.WriteAt(line, offset)
+	if err != nil {
+		return err
+	}
+
+	q.offsets = append(q.offsets, offset+int64(len(line)))
+	return nil
+}
+
+//pop reads the front item, the item is returned as raw json with its priority
+func (q *diskQueue) pop() (json.RawMessage, Priority, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if n := len(q.offsets); n > 0 {
+		return q.popStack()
+	}
+
+	if q.count == 0 {
+		return nil, PriorityNormal, errors.New("disk queue empty")
+	}
+
+	line, err := q.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, PriorityNormal, err
+	}
+
+	q.count--
+	q.head += int64(len(line))
+	switch {
+	case q.count == 0:
+		err = q.reset()
+	case q.head >= compactSize && q.head > q.size/2:
+		err = q.compact()
+	default:
+		err = q.saveHead()
+	}
+	if err != nil {
+		return nil, PriorityNormal, err
+	}
+
+	return decodeDiskItem(line)
+}
+
+//popStack reads the last item pushed to the front, the caller should hold the lock
+func (q *diskQueue) popStack() (json.RawMessage, Priority, error) {
+	n := len(q.offsets)
+	var start int64
+	if n > 1 {
+		start = q.offsets[n-2]
+	}
+
+	line := make([]byte, q.offsets[n-1]-start)
+	_, err := q.stack.ReadAt(line, start)
+	if err != nil {
+		return nil, PriorityNormal, err
+	}
+
+	err = q.stack.Truncate(start)
+	if err != nil {
+		return nil, PriorityNormal, err
+	}
+
+	q.offsets = q.offsets[:n-1]
+	return decodeDiskItem(line)
+}
+
+func (q *diskQueue) len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return q.count + len(q.offsets)
+}
+
+//reset truncates the drained file
+func (q *diskQueue) reset() error {
+	err := q.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	q.head = 0
+	q.size = 0
+	q.reader.Reset(q.file)
+	return q.saveHead()
+}
+
+//compact replaces the file with its unread items, so the file does not grow when the queue is never drained
+//the read position is saved after the file is replaced, the interrupted compaction leaves the position
+//beyond the end of the new file, which is read from the start by load, the caller should hold the lock
+func (q *diskQueue) compact() error {
+	tmp, err := os.OpenFile(q.path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmp, io.NewSectionReader(q.file, q.head, q.size-q.head))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), q.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.New(fmt.Sprint("compact disk queue fail ", err.Error()))
+	}
+
+	q.file.Close()
+	q.file = tmp
+	q.size -= q.head
+	q.head = 0
+
+	_, err = q.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	q.reader.Reset(q.file)
+	return q.saveHead()
+}
+
+//saveHead writes the read position, the caller should hold the lock
+func (q *diskQueue) saveHead() error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(q.head))
+	_, err := q.offset.WriteAt(buf[:], 0)
+	return err
+}
+
+func (q *diskQueue) close() error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.offset != nil {
+		q.offset.Close()
+	}
+	if q.stack != nil {
+		q.stack.Close()
+	}
+	if q.file == nil {
+		return nil
+	}
+	return q.file.Close()
+}
+
+func encodeDiskItem(data interface{}, priority Priority) ([]byte, error) {
+	item := diskItem{
+		Priority: priority,
+	}
+
+	var err error
+	item.Data, err = json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+func decodeDiskItem(line []byte) (json.RawMessage, Priority, error) {
+	var item diskItem
+	err := json.Unmarshal(bytes.TrimSuffix(line, []byte{'\n'}), &item)
+	if err != nil {
+		return nil, PriorityNormal, errors.New(fmt.Sprint("corrupted disk queue item ", err.Error()))
+	}
+	return item.Data, item.Priority, nil
+}
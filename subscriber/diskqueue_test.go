@@ -0,0 +1,135 @@
+package subscriber
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func popString(t *testing.T, q *diskQueue) string {
+	raw, _, err := q.pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Trim(string(raw), `"`)
+}
+
+//TestDiskQueueCompact checks the file stays bounded while the queue is never drained
+func TestDiskQueueCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub.queue")
+	q, err := newDiskQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	item := strings.Repeat("a", 1000)
+	pushed, popped := 0, 0
+	push := func() {
+		err := q.push(fmt.Sprint(pushed, "-", item))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pushed++
+	}
+
+	for i := 0; i < 10; i++ {
+		push()
+	}
+
+	//steady load, a few events are always pending
+	var maxSize int64
+	for i := 0; i < 1000; i++ {
+		push()
+		if got, want := popString(t, q), fmt.Sprint(popped, "-", item); got != want {
+			t.Fatalf("got %.10s want %.10s", got, want)
+		}
+		popped++
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > maxSize {
+			maxSize = info.Size()
+		}
+	}
+
+	if maxSize > 2*compactSize+10*1024 {
+		t.Fatalf("spill file grows to %d bytes", maxSize)
+	}
+	if q.len() != 10 {
+		t.Fatalf("got %d pending want 10", q.len())
+	}
+
+	//the compacted queue is reopened with its pending items
+	q.close()
+	q, err = newDiskQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for q.len() > 0 {
+		if got, want := popString(t, q), fmt.Sprint(popped, "-", item); got != want {
+			t.Fatalf("got %.10s want %.10s after reopen", got, want)
+		}
+		popped++
+	}
+	if popped != pushed {
+		t.Fatalf("got %d popped want %d", popped, pushed)
+	}
+}
+
+//TestDiskQueueInterruptedCompact checks the read position of the replaced file is not applied to the compacted one
+func TestDiskQueueInterruptedCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub.queue")
+	q, err := newDiskQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := strings.Repeat("b", 1000)
+	for i := 0; i < 100; i++ {
+		err := q.push(fmt.Sprint(i, "-", item))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var head int64
+	popped := 0
+	for q.head >= head {
+		head = q.head
+		popString(t, q)
+		popped++
+	}
+	q.close()
+
+	//the process stopped after the file was replaced, before its read position was saved
+	offset, err := os.OpenFile(path+".offset", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(head))
+	_, err = offset.WriteAt(buf[:], 0)
+	offset.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = newDiskQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	if got, want := popString(t, q), fmt.Sprint(popped, "-", item); got != want {
+		t.Fatalf("got %.10s want %.10s", got, want)
+	}
+	if q.len() != 100-popped-1 {
+		t.Fatalf("got %d pending want %d", q.len(), 100-popped-1)
+	}
+}
@@ -3,26 +3,71 @@ package subscriber
 import (
 	"container/list"
 	"errors"
-	"log"
 	"net"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/syariatifaris/genggar/logger"
+)
+
+//Priority is the event priority, higher priority event is dispatched first
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical
+
+	numPriority = int(PriorityCritical-PriorityLow) + 1
+
+	//DefaultStarvationTimeout is the maximum wait of lower priority event before it is served first
+	DefaultStarvationTimeout = time.Second * 5
 )
 
 var (
 	ErrBufferFull = errors.New("buffer full")
 )
 
+//Prioritized is implemented by the buffered data having priority, other data uses normal priority
+type Prioritized interface {
+	GetPriority() Priority
+}
+
 type Client interface {
 	PushBack(data interface{}) error
+	//TryPushBack is PushBack which does not wait for space on block policy
+	TryPushBack(data interface{}) error
+	//Reserve takes the place of the next push, PushReserved pushes in the order of the reservation
+	//so the publisher can wait for the space without holding its own lock
+	Reserve() uint64
+	PushReserved(ticket uint64, data interface{}) error
 	PushFront(data interface{}) error
 	PopFront() (interface{}, error)
 	GetBufferLen() int
 
+	GetName() string
 	GetUDPAddr() *net.UDPAddr
 	SetDispatching(bool)
 	IsDispatched() bool
 	GetTopicName() string
 
+	SetOverflow(cfg OverflowConfig) error
+	GetOverflow() OverflowConfig
+	SetLagging(fromSeq uint64)
+	GetLagging() (bool, uint64)
+	ClearLagging()
+	GetDropped() uint64
+	SetPaused(bool)
+	IsPaused() bool
+	Touch()
+	GetLastSeen() time.Time
+	SetCodec(name string)
+	GetCodec() string
+	SetProtocolVersion(version uint8)
+	GetProtocolVersion() uint8
+
 	LogAllElemFront()
 }
 
@@ -31,74 +76,338 @@ type Property struct {
 	Topic     string
 	Address   *net.UDPAddr
 	MaxBuffer int
+
+	//StarvationTimeout, when the front event of lower priority waits longer, it is served first
+	StarvationTimeout time.Duration
+	Overflow          OverflowConfig
+
+	//Logger receives the logs of the client, logger.Glog is used when it is not set
+	Logger logger.Logger
 }
 
+//bufferItem is the buffered data with its enqueue time
+type bufferItem struct {
+	data     interface{}
+	priority Priority
+	enqueued time.Time
+}
+
+//clientImpl buffers the events in one fifo list per priority level
 type clientImpl struct {
 	mux        sync.Mutex
 	prop       Property
-	evtBuffer  *list.List
+	evtBuffer  [numPriority]*list.List
 	dispatched bool
+
+	spill   *diskQueue
+	lagging bool
+	lagFrom uint64
+	dropped uint64
+
+	//tickets is the next reservation, serving is the reservation allowed to push
+	tickets   uint64
+	serving   uint64
+	abandoned map[uint64]bool
+
+	//popped is the last popped event, it keeps the enqueue time when the event is pushed back to the front
+	popped *bufferItem
+
+	paused   bool
+	lastSeen time.Time
+	codec    string
+	version  uint8
 }
 
 func NewClient(prop Property) (Client, error) {
 	if prop.MaxBuffer == 0 {
 		return nil, errors.New("buffer length should more than 0")
 	}
-	return &clientImpl{
-		prop:      prop,
-		evtBuffer: list.New(),
-	}, nil
+
+	if prop.StarvationTimeout == 0 {
+		prop.StarvationTimeout = DefaultStarvationTimeout
+	}
+
+	if prop.Logger == nil {
+		prop.Logger = logger.Glog{}
+	}
+
+	c := &clientImpl{
+		prop:     prop,
+		lastSeen: time.Now(),
+	}
+	for i := range c.evtBuffer {
+		c.evtBuffer[i] = list.New()
+	}
+
+	err := c.SetOverflow(prop.Overflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
 }
 
+//PushBack pushes the event to the buffer, the overflow policy is applied when the buffer is full
 func (c *clientImpl) PushBack(data interface{}) error {
-	if c.evtBuffer != nil {
-		if c.evtBuffer.Len() <= c.prop.MaxBuffer {
-			c.mux.Lock()
-			c.evtBuffer.PushBack(data)
-			c.mux.Unlock()
-			return nil
-		}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.pushBack(data, c.blockDeadline())
+}
+
+func (c *clientImpl) TryPushBack(data interface{}) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.pushBack(data, time.Time{})
+}
+
+//Reserve takes the place of the next PushReserved
+func (c *clientImpl) Reserve() uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	ticket := c.tickets
+	c.tickets++
+	return ticket
+}
+
+//PushReserved waits for the earlier reservations, then pushes like PushBack
+//the wait for the turn and the space is bounded by the block timeout
+func (c *clientImpl) PushReserved(ticket uint64, data interface{}) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	deadline := c.blockDeadline()
+	if !c.waitTurn(ticket, deadline) {
 		return ErrBufferFull
 	}
-	return errors.New("buffer is not initialized")
+	defer c.nextTurn()
+
+	return c.pushBack(data, deadline)
 }
 
-func (c *clientImpl) PushFront(data interface{}) error {
-	if c.evtBuffer != nil {
-		if c.evtBuffer.Len() <= c.prop.MaxBuffer {
-			c.mux.Lock()
-			c.evtBuffer.PushFront(data)
-			c.mux.Unlock()
+//pushBack pushes the event, the block policy waits for space until the deadline, the zero deadline does not wait
+//the caller should hold the lock
+func (c *clientImpl) pushBack(data interface{}, deadline time.Time) error {
+	//keep fifo order while the spilled events are not drained
+	if c.spill != nil && c.spill.len() > 0 {
+		return c.spill.push(data)
+	}
+
+	if c.len() > c.prop.MaxBuffer {
+		switch c.prop.Overflow.Policy {
+		case OverflowBlock:
+			if !c.waitSpace(deadline) {
+				return ErrBufferFull
+			}
+		case OverflowDropNewest:
+			c.dropped++
 			return nil
+		case OverflowDropOldest:
+			c.dropOldest()
+		case OverflowSpill:
+			return c.spill.push(data)
+		default:
+			return ErrBufferFull
 		}
+	}
+
+	item := newBufferItem(data)
+	c.level(item.priority).PushBack(item)
+	return nil
+}
+
+//PushFront puts the event back in front of its priority level, it is meant for the last popped event
+func (c *clientImpl) PushFront(data interface{}) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.len() > c.prop.MaxBuffer {
 		return ErrBufferFull
 	}
-	return errors.New("buffer is not initialized")
+
+	item := c.requeued(data)
+	c.level(item.priority).PushFront(item)
+	return nil
 }
 
+//PopFront pops the front event of the highest priority level,
+//unless a lower priority front event has waited longer than the starvation timeout
 func (c *clientImpl) PopFront() (interface{}, error) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
+	return c.popFront()
+}
+
+//popFront pops the front event, the caller should hold the lock
+func (c *clientImpl) popFront() (interface{}, error) {
+	var selected *list.List
+	var starved *list.List
+	var oldest time.Time
+	now := time.Now()
+
+	for i := numPriority - 1; i >= 0; i-- {
+		elem := c.evtBuffer[i].Front()
+		if elem == nil {
+			continue
+		}
+
+		if selected == nil {
+			selected = c.evtBuffer[i]
+			continue
+		}
+
+		enqueued := elem.Value.(*bufferItem).enqueued
+		if now.Sub(enqueued) > c.prop.StarvationTimeout && (starved == nil || enqueued.Before(oldest)) {
+			starved = c.evtBuffer[i]
+			oldest = enqueued
+		}
+	}
+
+	if starved != nil {
+		selected = starved
+	}
 
-	if c.evtBuffer != nil {
-		if c.evtBuffer.Len() > 0 {
-			elem := c.evtBuffer.Front()
-			defer func() {
-				if elem != nil {
-					c.evtBuffer.Remove(elem)
-				}
-			}()
-			return elem.Value, nil
+	if selected == nil {
+		c.popped = nil
+		if c.spill != nil && c.spill.len() > 0 {
+			data, _, err := c.spill.pop()
+			return data, err
 		}
 		return nil, errors.New("buffer empty")
 	}
-	return nil, errors.New("buffer is not initialized")
+
+	elem := selected.Front()
+	selected.Remove(elem)
+	c.popped = elem.Value.(*bufferItem)
+	return c.popped.data, nil
 }
 
 func (c *clientImpl) GetBufferLen() int {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	return c.evtBuffer.Len()
+
+	n := c.len()
+	if c.spill != nil {
+		n += c.spill.len()
+	}
+	return n
+}
+
+//SetOverflow changes the overflow policy, the spill file is created inside SpillDir
+func (c *clientImpl) SetOverflow(cfg OverflowConfig) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if cfg.Policy == OverflowSpill && c.spill == nil {
+		c.spill, err = newDiskQueue(filepath.Join(cfg.SpillDir, spillName(c.prop.Name)+".spill"))
+		if err != nil {
+			return err
+		}
+	}
+
+	c.prop.Overflow = cfg
+	return nil
+}
+
+func (c *clientImpl) GetOverflow() OverflowConfig {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.prop.Overflow
+}
+
+//SetLagging marks the subscriber as lagging, the events from the sequence should be caught up from the store
+func (c *clientImpl) SetLagging(fromSeq uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.lagging = true
+	c.lagFrom = fromSeq
+}
+
+//GetLagging returns the lagging state and the next sequence to catch up
+func (c *clientImpl) GetLagging() (bool, uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.lagging, c.lagFrom
+}
+
+//ClearLagging marks the subscriber as caught up
+func (c *clientImpl) ClearLagging() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.lagging = false
+	c.lagFrom = 0
+}
+
+//GetDropped returns the number of dropped events
+func (c *clientImpl) GetDropped() uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.dropped
+}
+
+//SetCodec sets the wire codec negotiated by the subscriber registration
+func (c *clientImpl) SetCodec(name string) {
+	c.mux.Lock()
+	c.codec = name
+	c.mux.Unlock()
+}
+
+//GetCodec gets the wire codec of the subscriber, empty is json
+func (c *clientImpl) GetCodec() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.codec
+}
+
+//SetProtocolVersion sets the frame version negotiated by the subscriber registration, 0 is unframed
+func (c *clientImpl) SetProtocolVersion(version uint8) {
+	c.mux.Lock()
+	c.version = version
+	c.mux.Unlock()
+}
+
+//GetProtocolVersion gets the frame version of the subscriber
+func (c *clientImpl) GetProtocolVersion() uint8 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.version
+}
+
+//SetPaused holds the dispatch to the subscriber, the events are still buffered
+func (c *clientImpl) SetPaused(paused bool) {
+	c.mux.Lock()
+	c.paused = paused
+	c.mux.Unlock()
+}
+
+func (c *clientImpl) IsPaused() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.paused
+}
+
+//Touch marks the subscriber as seen now, it is called on every message received from the subscriber
+func (c *clientImpl) Touch() {
+	c.mux.Lock()
+	c.lastSeen = time.Now()
+	c.mux.Unlock()
+}
+
+func (c *clientImpl) GetLastSeen() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.lastSeen
+}
+
+func (c *clientImpl) GetName() string {
+	return c.prop.Name
 }
 
 func (c *clientImpl) GetUDPAddr() *net.UDPAddr {
@@ -110,18 +419,24 @@ func (c *clientImpl) GetTopicName() string {
 }
 
 func (c *clientImpl) LogAllElemFront() {
-	if c.evtBuffer.Len() == 0 {
-		log.Println("buffer empty")
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.len() == 0 {
+		c.prop.Logger.Info("buffer empty", "subscriber", c.prop.Name)
 	}
 
-	for el := c.evtBuffer.Front(); el != nil; el = el.Next() {
-		log.Println("buffer data:", el.Value)
+	for i := numPriority - 1; i >= 0; i-- {
+		for el := c.evtBuffer[i].Front(); el != nil; el = el.Next() {
+			item := el.Value.(*bufferItem)
+			c.prop.Logger.Info("buffer data", "subscriber", c.prop.Name, "priority", item.priority, "data", item.data)
+		}
 	}
 }
 
-func (c *clientImpl) SetDispatching(bool) {
+func (c *clientImpl) SetDispatching(dispatching bool) {
 	c.mux.Lock()
-	c.dispatched = true
+	c.dispatched = dispatching
 	c.mux.Unlock()
 }
 
@@ -130,3 +445,116 @@ func (c *clientImpl) IsDispatched() bool {
 	defer c.mux.Unlock()
 	return c.dispatched
 }
+
+//len returns total buffered events of all levels, the caller should hold the lock
+func (c *clientImpl) len() int {
+	var n int
+	for _, level := range c.evtBuffer {
+		n += level.Len()
+	}
+	return n
+}
+
+//level returns the buffer of the priority, out of range priority is clamped
+func (c *clientImpl) level(priority Priority) *list.List {
+	if priority < PriorityLow {
+		priority = PriorityLow
+	}
+
+	if priority > PriorityCritical {
+		priority = PriorityCritical
+	}
+
+	return c.evtBuffer[priority-PriorityLow]
+}
+
+func newBufferItem(data interface{}) *bufferItem {
+	return &bufferItem{
+		data:     data,
+		priority: priorityOf(data),
+		enqueued: time.Now(),
+	}
+}
+
+//priorityOf is the priority of the Prioritized data, other data has normal priority
+func priorityOf(data interface{}) Priority {
+	if p, ok := data.(Prioritized); ok {
+		return p.GetPriority()
+	}
+	return PriorityNormal
+}
+
+//requeued returns the buffer item of the event pushed back to the front, the last popped event keeps
+//its priority and enqueue time so the failed send does not reset its starvation age, the caller should hold the lock
+func (c *clientImpl) requeued(data interface{}) *bufferItem {
+	item := c.popped
+	c.popped = nil
+	if item == nil {
+		return newBufferItem(data)
+	}
+
+	item.data = data
+	return item
+}
+
+//blockDeadline is the end of the wait for space of the block policy, the caller should hold the lock
+func (c *clientImpl) blockDeadline() time.Time {
+	timeout := c.prop.Overflow.BlockTimeout
+	if timeout <= 0 {
+		timeout = DefaultBlockTimeout
+	}
+	return time.Now().Add(timeout)
+}
+
+//waitTurn waits until the earlier reservations are pushed, the reservation is abandoned after the deadline
+//the caller should hold the lock
+func (c *clientImpl) waitTurn(ticket uint64, deadline time.Time) bool {
+	for c.serving != ticket {
+		if time.Now().After(deadline) {
+			if c.abandoned == nil {
+				c.abandoned = make(map[uint64]bool)
+			}
+			c.abandoned[ticket] = true
+			return false
+		}
+
+		c.mux.Unlock()
+		time.Sleep(time.Millisecond)
+		c.mux.Lock()
+	}
+	return true
+}
+
+//nextTurn passes the turn to the next reservation which is still waiting, the caller should hold the lock
+func (c *clientImpl) nextTurn() {
+	c.serving++
+	for c.abandoned[c.serving] {
+		delete(c.abandoned, c.serving)
+		c.serving++
+	}
+}
+
+//waitSpace waits until the buffer has space or the deadline, the caller should hold the lock
+func (c *clientImpl) waitSpace(deadline time.Time) bool {
+	for c.len() > c.prop.MaxBuffer {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		c.mux.Unlock()
+		time.Sleep(time.Millisecond)
+		c.mux.Lock()
+	}
+	return true
+}
+
+//dropOldest removes the front event of the lowest priority level, the caller should hold the lock
+func (c *clientImpl) dropOldest() {
+	for _, level := range c.evtBuffer {
+		if elem := level.Front(); elem != nil {
+			level.Remove(elem)
+			c.dropped++
+			return
+		}
+	}
+}
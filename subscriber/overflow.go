@@ -0,0 +1,57 @@
+package subscriber
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//Overflow is the policy applied when the subscriber buffer is full
+type Overflow string
+
+const (
+	//OverflowReject rejects the new event with ErrBufferFull
+	OverflowReject Overflow = "reject"
+	//OverflowBlock blocks the publisher until the buffer has space or BlockTimeout elapsed
+	OverflowBlock Overflow = "block"
+	//OverflowDropNewest silently drops the new event
+	OverflowDropNewest Overflow = "drop_newest"
+	//OverflowDropOldest drops the oldest event of the lowest priority to make space
+	OverflowDropOldest Overflow = "drop_oldest"
+	//OverflowSpill writes the overflowing events to a file inside SpillDir
+	OverflowSpill Overflow = "spill"
+	//OverflowLag rejects the new event with ErrBufferFull, the server marks the subscriber as lagging
+	//and catches it up from the event store
+	OverflowLag Overflow = "lag"
+
+	//DefaultBlockTimeout is the maximum wait of the blocked publisher
+	DefaultBlockTimeout = time.Second
+)
+
+//OverflowConfig is the overflow policy configuration
+type OverflowConfig struct {
+	Policy       Overflow
+	BlockTimeout time.Duration
+	SpillDir     string
+}
+
+//Validate checks the policy and sets the default values
+func (o *OverflowConfig) Validate() error {
+	switch o.Policy {
+	case "":
+		o.Policy = OverflowReject
+	case OverflowReject, OverflowDropNewest, OverflowDropOldest, OverflowLag:
+	case OverflowBlock:
+		if o.BlockTimeout <= 0 {
+			o.BlockTimeout = DefaultBlockTimeout
+		}
+	case OverflowSpill:
+		if o.SpillDir == "" {
+			return errors.New("spill dir is required for spill overflow policy")
+		}
+	default:
+		return errors.New(fmt.Sprint("unknown overflow policy ", o.Policy))
+	}
+
+	return nil
+}
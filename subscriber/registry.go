@@ -0,0 +1,137 @@
+package subscriber
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrSubscriberExists = errors.New("subscriber exists")
+)
+
+//Registry is the concurrent subscriber pool, indexed by name and by topic
+//the listing functions return snapshot, so the caller can iterate without holding the lock
+type Registry struct {
+	mux     sync.RWMutex
+	byName  map[string]Client
+	byTopic map[string]map[string]Client
+}
+
+//NewRegistry creates empty subscriber registry
+func NewRegistry() *Registry {
+	return &Registry{
+		byName:  make(map[string]Client),
+		byTopic: make(map[string]map[string]Client),
+	}
+}
+
+//Add adds the subscriber, it fails when the name is already registered
+func (r *Registry) Add(name string, c Client) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, ok := r.byName[name]; ok {
+		return ErrSubscriberExists
+	}
+
+	r.put(name, c)
+	return nil
+}
+
+//Put adds or replaces the subscriber
+func (r *Registry) Put(name string, c Client) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.remove(name)
+	r.put(name, c)
+}
+
+//Get gets the subscriber by name
+func (r *Registry) Get(name string) (Client, bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	c, ok := r.byName[name]
+	return c, ok
+}
+
+//Remove removes the subscriber by name
+func (r *Registry) Remove(name string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.remove(name)
+}
+
+//ByTopic returns snapshot of the topic subscribers keyed by name
+func (r *Registry) ByTopic(topic string) map[string]Client {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	subs := make(map[string]Client, len(r.byTopic[topic]))
+	for name, c := range r.byTopic[topic] {
+		subs[name] = c
+	}
+	return subs
+}
+
+//Snapshot returns snapshot of all subscribers keyed by name
+func (r *Registry) Snapshot() map[string]Client {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	subs := make(map[string]Client, len(r.byName))
+	for name, c := range r.byName {
+		subs[name] = c
+	}
+	return subs
+}
+
+//Topics returns the sorted topic names having subscriber
+func (r *Registry) Topics() []string {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	topics := make([]string, 0, len(r.byTopic))
+	for topic := range r.byTopic {
+		topics = append(topics, topic)
+	}
+
+	sort.Strings(topics)
+	return topics
+}
+
+//Len returns number of subscribers
+func (r *Registry) Len() int {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return len(r.byName)
+}
+
+//put adds the subscriber to both indexes, the caller should hold the lock
+func (r *Registry) put(name string, c Client) {
+	r.byName[name] = c
+
+	topic := c.GetTopicName()
+	if r.byTopic[topic] == nil {
+		r.byTopic[topic] = make(map[string]Client)
+	}
+	r.byTopic[topic][name] = c
+}
+
+//remove removes the subscriber from both indexes, the caller should hold the lock
+func (r *Registry) remove(name string) {
+	c, ok := r.byName[name]
+	if !ok {
+		return
+	}
+
+	delete(r.byName, name)
+
+	topic := c.GetTopicName()
+	delete(r.byTopic[topic], name)
+	if len(r.byTopic[topic]) == 0 {
+		delete(r.byTopic, topic)
+	}
+}
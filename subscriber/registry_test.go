@@ -0,0 +1,171 @@
+package subscriber
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/syariatifaris/genggar/logger"
+)
+
+func newTestClient(t testing.TB, name, topic string) Client {
+	c, err := NewClient(Property{
+		Name:      name,
+		Topic:     topic,
+		MaxBuffer: 8,
+		Logger:    logger.Nop{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRegistryGet(t *testing.T) {
+	r := NewRegistry()
+	a := newTestClient(t, "a", "orders")
+
+	if err := r.Add("a", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Add("a", newTestClient(t, "a", "orders")); err != ErrSubscriberExists {
+		t.Fatalf("add existing subscriber, got %v want %v", err, ErrSubscriberExists)
+	}
+
+	c, ok := r.Get("a")
+	if !ok || c != a {
+		t.Fatalf("get a, got %v %v", c, ok)
+	}
+	if _, ok := r.Get("b"); ok {
+		t.Fatal("get unknown subscriber should fail")
+	}
+}
+
+func TestRegistryByTopic(t *testing.T) {
+	r := NewRegistry()
+	r.Put("a", newTestClient(t, "a", "orders"))
+	r.Put("b", newTestClient(t, "b", "orders"))
+	r.Put("c", newTestClient(t, "c", "payments"))
+
+	tests := []struct {
+		topic string
+		want  []string
+	}{
+		{"orders", []string{"a", "b"}},
+		{"payments", []string{"c"}},
+		{"unknown", nil},
+	}
+
+	for _, test := range tests {
+		subs := r.ByTopic(test.topic)
+		if len(subs) != len(test.want) {
+			t.Fatalf("topic %s, got %d subscribers want %d", test.topic, len(subs), len(test.want))
+		}
+		for _, name := range test.want {
+			if _, ok := subs[name]; !ok {
+				t.Fatalf("topic %s, missing subscriber %s", test.topic, name)
+			}
+		}
+	}
+
+	if topics := fmt.Sprint(r.Topics()); topics != "[orders payments]" {
+		t.Fatalf("topics, got %s", topics)
+	}
+}
+
+func TestRegistrySnapshot(t *testing.T) {
+	r := NewRegistry()
+	r.Put("a", newTestClient(t, "a", "orders"))
+	r.Put("b", newTestClient(t, "b", "orders"))
+
+	byTopic := r.ByTopic("orders")
+	all := r.Snapshot()
+
+	//the snapshots are not changed by the later update
+	r.Remove("a")
+	r.Put("c", newTestClient(t, "c", "orders"))
+
+	if len(byTopic) != 2 || len(all) != 2 {
+		t.Fatalf("snapshot changed, got %d and %d subscribers", len(byTopic), len(all))
+	}
+	if _, ok := byTopic["c"]; ok {
+		t.Fatal("snapshot contains subscriber added later")
+	}
+
+	//changing the snapshot does not change the registry
+	delete(all, "b")
+	if _, ok := r.Get("b"); !ok {
+		t.Fatal("registry changed by the snapshot")
+	}
+}
+
+func TestRegistryRemove(t *testing.T) {
+	r := NewRegistry()
+	r.Put("a", newTestClient(t, "a", "orders"))
+	r.Remove("a")
+	r.Remove("unknown")
+
+	if _, ok := r.Get("a"); ok {
+		t.Fatal("removed subscriber is found")
+	}
+	if len(r.ByTopic("orders")) != 0 || len(r.Topics()) != 0 || r.Len() != 0 {
+		t.Fatal("removed subscriber is kept in the topic index")
+	}
+}
+
+func TestRegistryPutReplacesTopic(t *testing.T) {
+	r := NewRegistry()
+	r.Put("a", newTestClient(t, "a", "orders"))
+	r.Put("a", newTestClient(t, "a", "payments"))
+
+	if len(r.ByTopic("orders")) != 0 {
+		t.Fatal("replaced subscriber is kept in the old topic")
+	}
+	if len(r.ByTopic("payments")) != 1 || r.Len() != 1 {
+		t.Fatal("replaced subscriber is not in the new topic")
+	}
+}
+
+//TestRegistryConcurrent should be run with -race
+func TestRegistryConcurrent(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		clients := make([]Client, 100)
+		for j := range clients {
+			clients[j] = newTestClient(t, fmt.Sprint(i, "-", j), fmt.Sprint("topic-", j%3))
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j, c := range clients {
+				r.Put(c.GetName(), c)
+				if j%2 == 0 {
+					r.Remove(c.GetName())
+				}
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, c := range r.ByTopic(fmt.Sprint("topic-", j%3)) {
+					c.GetBufferLen()
+				}
+				for name := range r.Snapshot() {
+					r.Get(name)
+				}
+				r.Topics()
+				r.Len()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if r.Len() != 8*50 {
+		t.Fatalf("got %d subscribers want %d", r.Len(), 8*50)
+	}
+}
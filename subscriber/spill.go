@@ -0,0 +1,301 @@
+package subscriber
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//spillClient keeps at most headSize events in memory and spills the rest to a file backed queue,
+//so a subscriber offline for long time holds up to MaxBuffer events without keeping them in memory
+//priority is kept among the events in memory and restored when the spilled events are moved back to memory,
+//the spilled events are served in fifo order, the spill file is reopened with its events after restart
+type spillClient struct {
+	*clientImpl
+	headSize int
+	disk     *diskQueue
+}
+
+//NewSpillClient creates subscriber client spilling the events beyond headSize into a file inside dir
+func NewSpillClient(prop Property, dir string, headSize int) (Client, error) {
+	if headSize <= 0 {
+		return nil, errors.New("head size should more than 0")
+	}
+
+	if prop.MaxBuffer < headSize {
+		return nil, errors.New("buffer length should not less than head size")
+	}
+
+	if prop.Overflow.Policy == OverflowSpill {
+		return nil, errors.New("spill client does not support spill overflow policy")
+	}
+
+	head, err := NewClient(prop)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	disk, err := newDiskQueue(filepath.Join(dir, spillName(prop.Name)+".queue"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillClient{
+		clientImpl: head.(*clientImpl),
+		headSize:   headSize,
+		disk:       disk,
+	}, nil
+}
+
+//PushBack pushes the event to memory head, or to the disk when the head is full
+//when MaxBuffer is reached the overflow policy is applied like the memory client
+func (s *spillClient) PushBack(data interface{}) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.pushBack(data, s.blockDeadline())
+}
+
+func (s *spillClient) TryPushBack(data interface{}) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.pushBack(data, time.Time{})
+}
+
+//PushReserved waits for the earlier reservations, then pushes like PushBack
+func (s *spillClient) PushReserved(ticket uint64, data interface{}) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	deadline := s.blockDeadline()
+	if !s.waitTurn(ticket, deadline) {
+		return ErrBufferFull
+	}
+	defer s.nextTurn()
+
+	return s.pushBack(data, deadline)
+}
+
+//pushBack pushes the event to the head or the disk, the block policy waits for space until the deadline
+//the caller should hold the lock
+func (s *spillClient) pushBack(data interface{}, deadline time.Time) error {
+	if s.full() {
+		switch s.prop.Overflow.Policy {
+		case OverflowBlock:
+			if !s.waitSpill(deadline) {
+				return ErrBufferFull
+			}
+		case OverflowDropNewest:
+			s.dropped++
+			return nil
+		case OverflowDropOldest:
+			err := s.dropSpilled()
+			if err != nil {
+				return err
+			}
+		default:
+			return ErrBufferFull
+		}
+	}
+
+	//keep fifo order while the spilled events are not drained
+	if s.disk.len() > 0 || s.len() >= s.headSize {
+		return s.disk.push(data)
+	}
+
+	item := newBufferItem(data)
+	s.level(item.priority).PushBack(item)
+	return nil
+}
+
+//PushFront pushes the event in front of the memory head, the last event of the full head is moved to the disk
+func (s *spillClient) PushFront(data interface{}) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.len() >= s.headSize {
+		err := s.demoteBack()
+		if err != nil {
+			return err
+		}
+	}
+
+	item := s.requeued(data)
+	s.level(item.priority).PushFront(item)
+	return nil
+}
+
+//PopFront pops the event from memory head and refills the head from the disk
+func (s *spillClient) PopFront() (interface{}, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	data, err := s.popFront()
+	if err != nil {
+		if s.disk.len() == 0 {
+			return nil, err
+		}
+
+		data, _, err = s.disk.pop()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for s.len() < s.headSize && s.disk.len() > 0 {
+		raw, priority, err := s.disk.pop()
+		if err != nil {
+			s.prop.Logger.Error("refill from disk fail", "subscriber", s.prop.Name, "error", err)
+			break
+		}
+
+		item := newBufferItem(raw)
+		item.priority = priority
+		s.level(priority).PushBack(item)
+	}
+
+	return data, nil
+}
+
+func (s *spillClient) GetBufferLen() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.len() + s.disk.len()
+}
+
+//SetOverflow changes the overflow policy, spill policy is not supported
+func (s *spillClient) SetOverflow(cfg OverflowConfig) error {
+	if cfg.Policy == OverflowSpill {
+		return errors.New("spill client does not support spill overflow policy")
+	}
+	return s.clientImpl.SetOverflow(cfg)
+}
+
+func (s *spillClient) LogAllElemFront() {
+	s.clientImpl.LogAllElemFront()
+	s.prop.Logger.Info("spilled data", "subscriber", s.prop.Name, "count", s.disk.len())
+}
+
+//full reports the head and the disk reached MaxBuffer, the caller should hold the lock
+func (s *spillClient) full() bool {
+	return s.len()+s.disk.len() > s.prop.MaxBuffer
+}
+
+//waitSpill waits until the head and the disk have space or the deadline, the caller should hold the lock
+func (s *spillClient) waitSpill(deadline time.Time) bool {
+	for s.full() {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		s.mux.Unlock()
+		time.Sleep(time.Millisecond)
+		s.mux.Lock()
+	}
+	return true
+}
+
+//dropSpilled drops the oldest event, it is in the head unless the head is empty, the caller should hold the lock
+func (s *spillClient) dropSpilled() error {
+	if s.len() > 0 {
+		s.dropOldest()
+		return nil
+	}
+
+	_, _, err := s.disk.pop()
+	if err != nil {
+		return err
+	}
+	s.dropped++
+	return nil
+}
+
+//demoteBack moves the last event of the lowest priority to the disk front, the caller should hold the lock
+func (s *spillClient) demoteBack() error {
+	for _, level := range s.evtBuffer {
+		elem := level.Back()
+		if elem == nil {
+			continue
+		}
+
+		item := elem.Value.(*bufferItem)
+		err := s.disk.pushFront(item.data, item.priority)
+		if err != nil {
+			return err
+		}
+
+		level.Remove(elem)
+		return nil
+	}
+	return nil
+}
+
+//spillName converts subscriber name into file name
+func spillName(name string) string {
+	return strings.NewReplacer(":", "_", "/", "_", "[", "", "]", "").Replace(name)
+}
+
+//spillQueues are the extensions of the disk queues of the spill client and the spill policy
+var spillQueues = []string{".queue", ".spill"}
+
+//CleanSpill removes the spill files inside dir of the subscribers which are not active, when they are not written
+//within the retention, the udp subscriber registers with another port after restart, so the spilled events
+//of its previous name are never read again, it returns the number of the removed queues
+func CleanSpill(dir string, active []string, retention time.Duration) (int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	keep := make(map[string]bool)
+	for _, name := range active {
+		keep[spillName(name)] = true
+	}
+
+	//the queue file and its front, offset and compact files are removed together
+	queues := make(map[string][]os.FileInfo)
+	for _, file := range files {
+		name := file.Name()
+		for _, ext := range []string{".front", ".offset", ".compact"} {
+			name = strings.TrimSuffix(name, ext)
+		}
+
+		ext := filepath.Ext(name)
+		for _, queue := range spillQueues {
+			if ext == queue && !keep[strings.TrimSuffix(name, ext)] {
+				queues[name] = append(queues[name], file)
+			}
+		}
+	}
+
+	removed := 0
+	expired := time.Now().Add(-retention)
+	for _, files := range queues {
+		written := false
+		for _, file := range files {
+			written = written || file.ModTime().After(expired)
+		}
+		if written {
+			continue
+		}
+
+		for _, file := range files {
+			err := os.Remove(filepath.Join(dir, file.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,95 @@
+package subscriber
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//newSpilledClient spills the events of the subscriber into dir
+func newSpilledClient(t *testing.T, dir, name string) Client {
+	client, err := NewSpillClient(Property{
+		Address:   &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4000},
+		Name:      name,
+		Topic:     "ORDER",
+		MaxBuffer: 10,
+	}, dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err := client.PushBack("event")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return client
+}
+
+func TestCleanSpill(t *testing.T) {
+	tests := []struct {
+		name      string
+		active    bool
+		written   time.Duration
+		retention time.Duration
+		removed   bool
+	}{
+		{"unregistered expired", false, -2 * time.Hour, time.Hour, true},
+		{"unregistered written recently", false, -time.Minute, time.Hour, false},
+		{"registered expired", true, -2 * time.Hour, time.Hour, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			newSpilledClient(t, dir, "127.0.0.1:4000")
+
+			//the restarted client registers with another port
+			newSpilledClient(t, dir, "127.0.0.1:4001")
+
+			written := time.Now().Add(test.written)
+			files, err := filepath.Glob(filepath.Join(dir, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				err := os.Chtimes(file, written, written)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			active := []string{"127.0.0.1:4001"}
+			if test.active {
+				active = append(active, "127.0.0.1:4000")
+			}
+
+			removed, err := CleanSpill(dir, active, test.retention)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (removed == 1) != test.removed {
+				t.Fatalf("got %d removed", removed)
+			}
+
+			old, _ := filepath.Glob(filepath.Join(dir, "127.0.0.1_4000.*"))
+			if (len(old) == 0) != test.removed {
+				t.Fatalf("got files %v", old)
+			}
+
+			//the files of the active subscriber are never removed
+			cur, _ := filepath.Glob(filepath.Join(dir, "127.0.0.1_4001.*"))
+			if len(cur) != 3 {
+				t.Fatalf("got files %v of the active subscriber", cur)
+			}
+		})
+	}
+
+	removed, err := CleanSpill(filepath.Join(t.TempDir(), "missing"), nil, time.Hour)
+	if err != nil || removed != 0 {
+		t.Fatalf("got %d, %v for the missing dir", removed, err)
+	}
+}
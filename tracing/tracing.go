@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"context"
+)
+
+//w3c trace context header names, they are the keys of Headers
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+//Headers carries the trace context of the event from the publisher to the subscribers
+type Headers map[string]string
+
+//Span is the traced unit of work, it is the event processor callback on the subscriber client
+type Span interface {
+	//SetError marks the span as failed
+	SetError(err error)
+	End()
+}
+
+//Tracer starts the spans and propagates their context through the event headers,
+//it is implemented by W3C or by an adapter of another tracing library such as OpenTelemetry
+type Tracer interface {
+	//Inject writes the trace context of ctx into the headers
+	Inject(ctx context.Context, headers Headers)
+	//Extract returns ctx carrying the trace context of the headers as the remote parent
+	Extract(ctx context.Context, headers Headers) context.Context
+	//Start starts the child span of the trace context in ctx
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+//Nop does not trace, it is used when the tracer is not configured
+type Nop struct{}
+
+func (Nop) Inject(ctx context.Context, headers Headers) {}
+
+func (Nop) Extract(ctx context.Context, headers Headers) context.Context {
+	return ctx
+}
+
+func (Nop) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetError(err error) {}
+func (nopSpan) End()               {}
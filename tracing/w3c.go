@@ -0,0 +1,157 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const flagSampled = 0x01
+
+//SpanContext is the w3c trace context of a span
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	State   string
+	Remote  bool
+}
+
+//IsValid is false for the zero trace id or span id
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+//IsSampled reports the sampled flag of the trace
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+//TraceParent formats the span context as traceparent header value
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), sc.Flags)
+}
+
+//ParseTraceParent reads the traceparent header value, the version 00 format is read from the later versions
+func ParseTraceParent(val string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(val), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errors.New(fmt.Sprint("invalid traceparent ", val))
+	}
+
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errors.New(fmt.Sprint("invalid traceparent version ", val))
+	}
+
+	var flags [1]byte
+	_, errTrace := hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	_, errSpan := hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	_, errFlags := hex.Decode(flags[:], []byte(parts[3]))
+	if errTrace != nil || errSpan != nil || errFlags != nil || !sc.IsValid() {
+		return SpanContext{}, errors.New(fmt.Sprint("invalid traceparent ", val))
+	}
+
+	sc.Flags = flags[0]
+	sc.Remote = true
+	return sc, nil
+}
+
+type spanKey struct{}
+
+//ContextWithSpan returns ctx carrying the span context, it is the parent of the next span and the injected context
+func ContextWithSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+//SpanFromContext returns the span context of ctx, ok is false when ctx has none
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+//SpanData is the finished span of W3C tracer
+type SpanData struct {
+	Name   string
+	Parent SpanContext
+	SpanContext
+	Attrs map[string]string
+	Start time.Time
+	End   time.Time
+	Err   error
+}
+
+//W3C propagates the w3c trace context without a tracing backend,
+//the finished spans are passed to OnEnd when it is set
+type W3C struct {
+	OnEnd func(span *SpanData)
+}
+
+func (t *W3C) Inject(ctx context.Context, headers Headers) {
+	sc, ok := SpanFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	headers[HeaderTraceParent] = sc.TraceParent()
+	if sc.State != "" {
+		headers[HeaderTraceState] = sc.State
+	}
+}
+
+func (t *W3C) Extract(ctx context.Context, headers Headers) context.Context {
+	sc, err := ParseTraceParent(headers[HeaderTraceParent])
+	if err != nil {
+		return ctx
+	}
+
+	sc.State = headers[HeaderTraceState]
+	return ContextWithSpan(ctx, sc)
+}
+
+//Start continues the trace of the parent span, the span without parent starts a sampled trace
+func (t *W3C) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	parent, ok := SpanFromContext(ctx)
+
+	sc := SpanContext{Flags: flagSampled}
+	if ok {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.State = parent.State
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+
+	span := &w3cSpan{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Parent:      parent,
+			SpanContext: sc,
+			Attrs:       attrs,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpan(ctx, sc), span
+}
+
+type w3cSpan struct {
+	tracer *W3C
+	data   SpanData
+}
+
+func (s *w3cSpan) SetError(err error) {
+	s.data.Err = err
+}
+
+func (s *w3cSpan) End() {
+	s.data.End = time.Now()
+	if s.tracer.OnEnd != nil {
+		s.tracer.OnEnd(&s.data)
+	}
+}
@@ -0,0 +1,107 @@
+package util
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+//crockford base32 alphabet, keeps the id lexicographically sortable
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ErrIDOverflow = errors.New("id entropy overflow within the same millisecond")
+
+	defaultIDGen = NewULIDGenerator()
+)
+
+//IDGenerator generates unique identifier for the events
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+//ULIDGenerator generates monotonic, time sortable identifier (ULID)
+type ULIDGenerator struct {
+	mux     sync.Mutex
+	entropy io.Reader
+	lastMs  uint64
+	lastRnd [10]byte
+	now     func() time.Time
+}
+
+//NewULIDGenerator creates ulid generator using crypto random as entropy
+func NewULIDGenerator() *ULIDGenerator {
+	return &ULIDGenerator{
+		entropy: rand.Reader,
+		now:     time.Now,
+	}
+}
+
+//NewID returns the next ulid, ids generated on the same millisecond are strictly increasing
+func (g *ULIDGenerator) NewID() (string, error) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	ms := uint64(g.now().UnixNano() / int64(time.Millisecond))
+	if ms <= g.lastMs {
+		//keep monotonic order when clock does not move forward
+		ms = g.lastMs
+		if !incrementBytes(g.lastRnd[:]) {
+			return "", ErrIDOverflow
+		}
+	} else {
+		if _, err := io.ReadFull(g.entropy, g.lastRnd[:]); err != nil {
+			return "", err
+		}
+		g.lastMs = ms
+	}
+
+	var raw [16]byte
+	raw[0] = byte(ms >> 40)
+	raw[1] = byte(ms >> 32)
+	raw[2] = byte(ms >> 24)
+	raw[3] = byte(ms >> 16)
+	raw[4] = byte(ms >> 8)
+	raw[5] = byte(ms)
+	copy(raw[6:], g.lastRnd[:])
+
+	return encodeCrockford(raw), nil
+}
+
+//NewID generates id using the default generator
+func NewID() (string, error) {
+	return defaultIDGen.NewID()
+}
+
+//incrementBytes adds one to big endian bytes, return false on overflow
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//encodeCrockford encodes 128 bits into 26 chars of crockford base32
+func encodeCrockford(raw [16]byte) string {
+	out := make([]byte, 26)
+	//26 chars carry 130 bits, so the first char only holds the top 3 bits
+	out[0] = crockford[raw[0]>>5]
+	idx := 1
+	carry := uint(raw[0] & 0x1f)
+	bits := uint(5)
+	for i := 1; i < len(raw); i++ {
+		carry = (carry<<8 | uint(raw[i])) & 0x1fff
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[idx] = crockford[(carry>>bits)&0x1f]
+			idx++
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,182 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//bigCrockford encodes the 128 bits as number in crockford base32, the reference of encodeCrockford
+func bigCrockford(raw [16]byte) string {
+	n := new(big.Int).SetBytes(raw[:])
+	out := []byte(strings.Repeat("0", 26))
+	base := big.NewInt(32)
+	mod := new(big.Int)
+	for i := len(out) - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = crockford[mod.Int64()]
+	}
+	return string(out)
+}
+
+func TestEncodeCrockford(t *testing.T) {
+	var ff [16]byte
+	for i := range ff {
+		ff[i] = 0xff
+	}
+
+	tests := []struct {
+		name string
+		raw  [16]byte
+		want string
+	}{
+		{"zero", [16]byte{}, "00000000000000000000000000"},
+		{"max", ff, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		{"first millisecond", [16]byte{5: 1}, "00000000010000000000000000"},
+		{"last bit", [16]byte{15: 1}, "00000000000000000000000001"},
+		{"top bit", [16]byte{0: 0x80}, "40000000000000000000000000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := encodeCrockford(test.raw); got != test.want {
+				t.Fatalf("got %s want %s", got, test.want)
+			}
+		})
+	}
+
+	for i := 0; i < 1000; i++ {
+		var raw [16]byte
+		_, err := rand.Read(raw[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := encodeCrockford(raw), bigCrockford(raw); got != want {
+			t.Fatalf("got %s want %s for %x", got, want, raw)
+		}
+	}
+}
+
+//newTestGenerator creates generator having the controlled clock
+func newTestGenerator(now *time.Time, entropy []byte) *ULIDGenerator {
+	g := NewULIDGenerator()
+	g.now = func() time.Time { return *now }
+	if entropy != nil {
+		g.entropy = bytes.NewReader(bytes.Repeat(entropy, 100))
+	}
+	return g
+}
+
+func TestNewIDOrder(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	g := newTestGenerator(&now, nil)
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		same    bool
+	}{
+		{"same millisecond", 0, true},
+		{"within millisecond", 500 * time.Microsecond, true},
+		{"next millisecond", 500 * time.Microsecond, false},
+		{"clock moved back", -time.Second, true},
+		{"clock caught up", 2 * time.Second, false},
+	}
+
+	last, err := g.NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			now = now.Add(step.advance)
+			for i := 0; i < 100; i++ {
+				id, err := g.NewID()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if id <= last {
+					t.Fatalf("got %s after %s", id, last)
+				}
+				if same := id[:10] == last[:10]; same != step.same && i == 0 {
+					t.Fatalf("got time %s after %s", id[:10], last[:10])
+				}
+				last = id
+			}
+		})
+	}
+}
+
+func TestNewIDOverflow(t *testing.T) {
+	now := time.Now()
+	g := newTestGenerator(&now, []byte{0xff})
+
+	_, err := g.NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.NewID(); err != ErrIDOverflow {
+		t.Fatalf("got %v want %v", err, ErrIDOverflow)
+	}
+
+	now = now.Add(time.Millisecond)
+	if _, err := g.NewID(); err != nil {
+		t.Fatalf("got %v on the next millisecond", err)
+	}
+}
+
+func TestNewIDConcurrent(t *testing.T) {
+	const workers, perWorker = 16, 500
+
+	var wg sync.WaitGroup
+	ids := make(chan string, workers*perWorker)
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last string
+			for i := 0; i < perWorker; i++ {
+				id, err := NewID()
+				if err != nil {
+					errs <- err
+					return
+				}
+				//ids of the same caller are increasing
+				if id <= last {
+					errs <- errors.New(fmt.Sprint("got ", id, " after ", last))
+					return
+				}
+				last = id
+				ids <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		if len(id) != 26 || strings.Trim(id, crockford) != "" {
+			t.Fatalf("got invalid id %s", id)
+		}
+		if seen[id] {
+			t.Fatalf("got duplicate id %s", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != workers*perWorker {
+		t.Fatalf("got %d ids want %d", len(seen), workers*perWorker)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"strings"
 )
 
+//GetV4UUID generates uuid using uuidgen binary
+//
+//Deprecated: use NewID or an IDGenerator, it does not depend on external binary
 func GetV4UUID() (string, error) {
 	//use satori uuid library
 	out, err := exec.Command("uuidgen").Output()